@@ -0,0 +1,45 @@
+// Package cleanup controls how the C resources behind record.Record, file.File,
+// filter.Filter, memheap.MemHeap and ring.Ring are released when a wrapper is
+// garbage collected without calling Free or Close.
+//
+// By default nothing is released automatically and a forgotten Free leaks the
+// underlying C memory. Call SetAutoRelease(true) at the start of the program
+// to let the garbage collector release such resources.
+//
+// Building with the libnf_debug tag reports every wrapper that was garbage
+// collected without an explicit Free or Close through the log package,
+// together with the stack trace of its allocation:
+//
+//	go build -tags libnf_debug ./...
+package cleanup
+
+import "github.com/matejnesuta/libnf-go/api/internal/handle"
+
+// SetAutoRelease enables or disables releasing of the C resources of wrappers that
+// become unreachable without being freed. The setting applies to wrappers
+// allocated after the call.
+//
+// Wrappers must still be kept reachable for as long as they are used, which is
+// the case whenever they are freed explicitly in the end.
+func SetAutoRelease(enabled bool) {
+	handle.SetAutoRelease(enabled)
+}
+
+// AutoRelease reports whether auto release is enabled.
+func AutoRelease() bool {
+	return handle.AutoRelease()
+}
+
+// Live returns the number of wrappers holding C resources that were neither
+// freed explicitly nor garbage collected. A steadily growing value points to
+// a missing Free or Close.
+func Live() int64 {
+	return handle.Live()
+}
+
+// Collected returns the number of wrappers that were garbage collected without
+// being freed. Only wrappers allocated with auto release enabled, or in a build
+// with the libnf_debug tag, are counted.
+func Collected() uint64 {
+	return handle.Collected()
+}
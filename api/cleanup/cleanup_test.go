@@ -0,0 +1,62 @@
+package cleanup_test
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/matejnesuta/libnf-go/api/cleanup"
+	"github.com/matejnesuta/libnf-go/api/record"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplicitFree(t *testing.T) {
+	live := cleanup.Live()
+	rec, err := record.NewRecord()
+	assert.Nil(t, err)
+	assert.Equal(t, live+1, cleanup.Live())
+
+	err = rec.Free()
+	assert.Nil(t, err)
+	assert.Equal(t, live, cleanup.Live())
+}
+
+func TestAutoRelease(t *testing.T) {
+	cleanup.SetAutoRelease(true)
+	defer cleanup.SetAutoRelease(false)
+	assert.Equal(t, true, cleanup.AutoRelease())
+
+	collected := cleanup.Collected()
+	live := cleanup.Live()
+	func() {
+		rec, err := record.NewRecord()
+		assert.Nil(t, err)
+		assert.Equal(t, true, rec.Allocated())
+	}()
+
+	for i := 0; i < 100 && cleanup.Collected() == collected; i++ {
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, collected+1, cleanup.Collected())
+	assert.Equal(t, live, cleanup.Live())
+}
+
+func TestAutoReleaseAfterFree(t *testing.T) {
+	cleanup.SetAutoRelease(true)
+	defer cleanup.SetAutoRelease(false)
+
+	collected := cleanup.Collected()
+	func() {
+		rec, err := record.NewRecord()
+		assert.Nil(t, err)
+		assert.Nil(t, rec.Free())
+	}()
+
+	for i := 0; i < 10; i++ {
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, collected, cleanup.Collected())
+}
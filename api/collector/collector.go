@@ -0,0 +1,120 @@
+// Package collector receives NetFlow v5, NetFlow v9, IPFIX and sFlow v5 flow
+// exports over UDP, similarly to nfcapd and sfcapd, and converts them into records.
+//
+// The information elements of the exported flows are mapped onto the fields
+// constants. Every sFlow flow sample becomes a flow of its own, with the bytes
+// and packets of the sampled packet scaled by the sampling rate. Decoded flows
+// are converted to record.Record and written to any record.Writer, such as
+// a file.File opened with OpenWrite or a ring.Ring. The Decoder can also be used
+// on its own, e.g. on packets read from a pcap file.
+package collector
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/matejnesuta/libnf-go/api/flow"
+	"github.com/matejnesuta/libnf-go/api/record"
+)
+
+// MaxPacketSize is the size of the receive buffer, the largest possible UDP payload.
+const MaxPacketSize = 65535
+
+// Collector receives flow exports on a UDP socket.
+type Collector struct {
+	conn    *net.UDPConn
+	decoder *Decoder
+}
+
+// Listen returns a collector listening on the UDP address, e.g. ":2055" or "[::]:4739".
+func Listen(address string) (*Collector, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Collector{conn: conn, decoder: NewDecoder()}, nil
+}
+
+// Addr returns the local address the collector listens on.
+func (c *Collector) Addr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// Stats returns the counters of the decoder of the collector.
+func (c *Collector) Stats() Stats {
+	return c.decoder.Stats()
+}
+
+// Close closes the socket of the collector.
+func (c *Collector) Close() error {
+	return c.conn.Close()
+}
+
+// Run receives packets until the context is canceled and writes every decoded
+// flow as a record to w. Malformed packets and packets of unsupported versions
+// are skipped and counted in Stats.
+//
+// Run returns ctx.Err() once the context is canceled, or the first error
+// returned by the socket or by w.
+func (c *Collector) Run(ctx context.Context, w record.Writer) error {
+	rec, err := record.NewRecord()
+	if err != nil {
+		return err
+	}
+	defer rec.Free()
+
+	return c.run(ctx, func(flows []flow.Flow) error {
+		for i := range flows {
+			if err := rec.FromFlow(&flows[i]); err != nil {
+				return err
+			}
+			if err := w.WriteRecord(&rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RunFlows works like Run, but passes the decoded flows of every packet to handle
+// instead of converting them to records. The slice is reused for the next packet.
+func (c *Collector) RunFlows(ctx context.Context, handle func(flows []flow.Flow) error) error {
+	return c.run(ctx, handle)
+}
+
+func (c *Collector) run(ctx context.Context, handle func(flows []flow.Flow) error) error {
+	// Unblock the pending read once the context is done.
+	stop := context.AfterFunc(ctx, func() {
+		c.conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	buf := make([]byte, MaxPacketSize)
+	var flows []flow.Flow
+	for {
+		n, addr, err := c.conn.ReadFromUDPAddrPort(buf)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		} else if err != nil {
+			return err
+		}
+
+		flows, _ = c.decoder.Decode(exporterAddr(addr), buf[:n], flows[:0])
+		if len(flows) == 0 {
+			continue
+		}
+		if err := handle(flows); err != nil {
+			return err
+		}
+	}
+}
+
+func exporterAddr(addr netip.AddrPort) netip.Addr {
+	return addr.Addr().Unmap()
+}
@@ -0,0 +1,301 @@
+package collector_test
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matejnesuta/libnf-go/api/collector"
+	"github.com/matejnesuta/libnf-go/api/errors"
+	"github.com/matejnesuta/libnf-go/api/fields"
+	"github.com/matejnesuta/libnf-go/api/flow"
+	"github.com/matejnesuta/libnf-go/api/record"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var exporter = netip.MustParseAddr("10.1.1.1")
+
+// fixture decodes a hex dump of a UDP payload, as printed by tcpdump -x.
+func fixture(dump string) []byte {
+	data, err := hex.DecodeString(strings.Join(strings.Fields(dump), ""))
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// A NetFlow v5 packet with two records, exported at 1496001024 s with 100 s of uptime.
+var netflowV5 = fixture(`
+	0005 0002 0001 86a0 592b 2a00 0000 0000 0000 002a 0102 0000
+	c0a8 0001 c0a8 0002 0a00 0001 0003 0004 0000 0014 0000 3039
+	0001 7318 0001 8308 0463 0050 001b 0600 fde8 fde9 1818 0000
+	0a00 0001 0a00 0002 0000 0000 0001 0002 0000 0001 0000 0040
+	0001 86a0 0001 86a0 0035 0035 0000 1100 0000 0000 0000 0000
+`)
+
+// A NetFlow v9 packet of source ID 7 with a template and a data flowset with one IPv6 flow.
+var netflowV9 = fixture(`
+	0009 0002 0001 86a0 592b 2a00 0000 0001 0000 0007
+	0000 0028 0100 0008
+	001b 0010 001c 0010 0007 0002 000b 0002 0004 0001 0001 0004 0016 0004 0015 0004
+	0100 0038
+	2001 0db8 0000 0000 0000 0000 0000 0001 2001 0db8 0000 0000 0000 0000 0000 0002
+	d431 01bb 06 0000 05dc 0001 7318 0001 8308 000000
+`)
+
+// A NetFlow v9 packet of source ID 8 with only the data flowset of netflowV9.
+var netflowV9NoTemplate = fixture(`
+	0009 0001 0001 86a0 592b 2a00 0000 0002 0000 0008
+	0100 0038
+	2001 0db8 0000 0000 0000 0000 0000 0001 2001 0db8 0000 0000 0000 0000 0000 0002
+	d431 01bb 06 0000 05dc 0001 7318 0001 8308 000000
+`)
+
+// An IPFIX message with a template and a data set with one flow, which uses
+// millisecond timestamps and a variable length field of an enterprise element.
+var ipfix = fixture(`
+	000a 0060 592b 2a00 0000 0001 0000 0003
+	0002 0028 0100 0007
+	0008 0004 000c 0004 0004 0001 0002 0008 0098 0008 0099 0008 8001 ffff 0000 0009
+	0100 0028
+	c0a8 0001 c0a8 0002 11 0000 0000 0000 0003 0000 015c 509b fc78 0000 015c 509c 0c18 02 abcd
+`)
+
+// An sFlow v5 datagram with a flow sample of a raw Ethernet header with an
+// extended switch record, a counter sample and an expanded flow sample of
+// IPv6 data with an extended gateway record.
+var sflow = fixture(`
+	0000 0005 0000 0001 0a00 00fe 0000 0000 0000 0001 0001 86a0
+	0000 0003 0000 0001 0000 008c 0000 0001 0000 0003 0000 0200
+	0000 0400 0000 0000 0000 0003 0000 0005 0000 0002 0000 0001
+	0000 004c 0000 0001 0000 03fe 0000 0004 0000 003a 0011 2233
+	4455 6677 8899 aabb 8100 0064 0800 4500 03e8 0000 4000 4006
+	0000 c0a8 0001 c0a8 0002 0463 0050 0000 0004 0000 0004 5018
+	ffff 0000 0000 0000 0000 03e9 0000 0010 0000 0064 0000 0000
+	0000 00c8 0000 0000 0000 0002 0000 0008 0000 0000 0000 0000
+	0000 0003 0000 00a4 0000 0001 0000 0000 0000 0003 0000 0064
+	0000 03e8 0000 0000 0000 0000 0000 0007 0000 0002 0000 0002
+	0000 0002 0000 0004 0000 0038 0000 0050 0000 0011 2001 0db8
+	0000 0000 0000 0000 0000 0001 2001 0db8 0000 0000 0000 0000
+	0000 0002 0000 0035 0000 14e9 0000 0000 0000 0000 0000 03eb
+	0000 0030 0000 0001 0a00 0001 0000 fde8 0000 fde9 0000 fdea
+	0000 0001 0000 0002 0000 0002 0000 fdeb 0000 fdec 0000 0000
+	0000 0064
+`)
+
+func TestDecodeNetflowV5(t *testing.T) {
+	d := collector.NewDecoder()
+	flows, err := d.Decode(exporter, netflowV5, nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(flows))
+
+	f := flows[0]
+	assert.Equal(t, netip.MustParseAddr("192.168.0.1"), f.SrcAddr)
+	assert.Equal(t, netip.MustParseAddr("192.168.0.2"), f.DstAddr)
+	assert.Equal(t, netip.MustParseAddr("10.0.0.1"), f.NextHop)
+	assert.Equal(t, uint16(1123), f.SrcPort)
+	assert.Equal(t, uint16(80), f.DstPort)
+	assert.Equal(t, uint8(6), f.Prot)
+	assert.Equal(t, uint8(0x1b), f.TcpFlags)
+	assert.Equal(t, uint64(20), f.Packets)
+	assert.Equal(t, uint64(12345), f.Bytes)
+	assert.Equal(t, uint32(65000), f.SrcAS)
+	assert.Equal(t, uint8(24), f.SrcMask)
+	assert.Equal(t, uint8(1), f.EngineType)
+	assert.Equal(t, uint8(2), f.EngineId)
+	assert.Equal(t, int64(1496001019000), f.First.UnixMilli())
+	assert.Equal(t, int64(1496001023080), f.Last.UnixMilli())
+	assert.Equal(t, uint64(1), f.Flows)
+	assert.Equal(t, exporter, f.IpRouter)
+	assert.Equal(t, true, f.Has(fields.Received))
+	assert.Equal(t, false, f.Has(fields.SamplerInterval))
+
+	assert.Equal(t, uint16(53), flows[1].DstPort)
+	assert.Equal(t, collector.Stats{Packets: 1, Flows: 2}, d.Stats())
+}
+
+func TestDecodeNetflowV9(t *testing.T) {
+	d := collector.NewDecoder()
+	flows, err := d.Decode(exporter, netflowV9, nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(flows))
+
+	f := flows[0]
+	assert.Equal(t, netip.MustParseAddr("2001:db8::1"), f.SrcAddr)
+	assert.Equal(t, netip.MustParseAddr("2001:db8::2"), f.DstAddr)
+	assert.Equal(t, uint16(54321), f.SrcPort)
+	assert.Equal(t, uint16(443), f.DstPort)
+	assert.Equal(t, uint64(1500), f.Bytes)
+	assert.Equal(t, int64(1496001019000), f.First.UnixMilli())
+	assert.Equal(t, int64(1496001023080), f.Last.UnixMilli())
+	assert.Equal(t, false, f.Has(fields.Dpkts))
+
+	// Templates are kept per exporter and source ID.
+	flows, err = d.Decode(exporter, netflowV9NoTemplate, nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(flows))
+	assert.Equal(t, uint64(1), d.Stats().MissingTemplates)
+}
+
+func TestDecodeIPFIX(t *testing.T) {
+	d := collector.NewDecoder()
+	flows, err := d.Decode(exporter, ipfix, nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(flows))
+
+	f := flows[0]
+	assert.Equal(t, netip.MustParseAddr("192.168.0.1"), f.SrcAddr)
+	assert.Equal(t, uint8(17), f.Prot)
+	assert.Equal(t, uint64(3), f.Packets)
+	assert.Equal(t, int64(1496001019000), f.First.UnixMilli())
+	assert.Equal(t, int64(1496001023000), f.Last.UnixMilli())
+}
+
+func TestDecodeSFlow(t *testing.T) {
+	d := collector.NewDecoder()
+	flows, err := d.Decode(exporter, sflow, nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(flows))
+
+	f := flows[0]
+	assert.Equal(t, netip.MustParseAddr("192.168.0.1"), f.SrcAddr)
+	assert.Equal(t, netip.MustParseAddr("192.168.0.2"), f.DstAddr)
+	assert.Equal(t, uint16(1123), f.SrcPort)
+	assert.Equal(t, uint16(80), f.DstPort)
+	assert.Equal(t, uint8(6), f.Prot)
+	assert.Equal(t, uint8(0x18), f.TcpFlags)
+	assert.Equal(t, flow.MAC{0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb}, f.InSrcMac)
+	assert.Equal(t, flow.MAC{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}, f.OutDstMac)
+	assert.Equal(t, uint16(100), f.SrcVlan)
+	assert.Equal(t, uint16(200), f.DstVlan)
+	assert.Equal(t, uint32(3), f.Input)
+	assert.Equal(t, uint32(5), f.Output)
+	assert.Equal(t, uint32(512), f.SamplerInterval)
+	// The IP packet of 1000 bytes without the Ethernet header and the FCS.
+	assert.Equal(t, uint64(1000*512), f.Bytes)
+	assert.Equal(t, uint64(512), f.Packets)
+	assert.Equal(t, uint64(1), f.Flows)
+	assert.Equal(t, f.First, f.Last)
+	assert.Equal(t, true, f.Has(fields.First))
+
+	f = flows[1]
+	assert.Equal(t, netip.MustParseAddr("2001:db8::1"), f.SrcAddr)
+	assert.Equal(t, netip.MustParseAddr("2001:db8::2"), f.DstAddr)
+	assert.Equal(t, uint16(53), f.SrcPort)
+	assert.Equal(t, uint16(5353), f.DstPort)
+	assert.Equal(t, uint8(17), f.Prot)
+	assert.Equal(t, uint32(7), f.Input)
+	assert.Equal(t, uint32(0), f.Output)
+	assert.Equal(t, uint64(80*100), f.Bytes)
+	assert.Equal(t, uint64(100), f.Packets)
+	assert.Equal(t, netip.MustParseAddr("10.0.0.1"), f.BgpNextHop)
+	assert.Equal(t, uint32(65001), f.SrcAS)
+	assert.Equal(t, uint32(65004), f.DstAS)
+	assert.Equal(t, uint32(65003), f.BgpNextAdjacentAS)
+	assert.Equal(t, false, f.Has(fields.SrcVlan))
+
+	_, err = d.Decode(exporter, sflow[:len(sflow)-8], nil)
+	assert.ErrorIs(t, err, errors.ErrMalformedPacket)
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	d := collector.NewDecoder()
+
+	_, err := d.Decode(exporter, []byte{0, 7, 0, 0}, nil)
+	assert.ErrorIs(t, err, errors.ErrUnsupportedVersion)
+
+	flows, err := d.Decode(exporter, netflowV5[:len(netflowV5)-1], nil)
+	assert.ErrorIs(t, err, errors.ErrMalformedPacket)
+	assert.Equal(t, 0, len(flows))
+
+	flows, err = d.Decode(exporter, netflowV9[:len(netflowV9)-10], nil)
+	assert.ErrorIs(t, err, errors.ErrMalformedPacket)
+	assert.Equal(t, 0, len(flows))
+
+	_, err = d.Decode(exporter, ipfix[:20], nil)
+	assert.ErrorIs(t, err, errors.ErrMalformedPacket)
+	assert.Equal(t, uint64(3), d.Stats().Malformed)
+}
+
+func send(t *testing.T, addr net.Addr, packets ...[]byte) {
+	conn, err := net.Dial("udp", addr.String())
+	assert.Equal(t, nil, err)
+	defer conn.Close()
+	for _, p := range packets {
+		_, err = conn.Write(p)
+		assert.Equal(t, nil, err)
+	}
+}
+
+func TestCollectorLoopback(t *testing.T) {
+	c, err := collector.Listen("127.0.0.1:0")
+	assert.Equal(t, nil, err)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	received := make(chan flow.Flow, 10)
+	done := make(chan error)
+	go func() {
+		done <- c.RunFlows(ctx, func(flows []flow.Flow) error {
+			for _, f := range flows {
+				received <- f
+			}
+			return nil
+		})
+	}()
+
+	send(t, c.Addr(), netflowV5, netflowV9, ipfix)
+	var ports []uint16
+	for range 4 {
+		select {
+		case f := <-received:
+			assert.Equal(t, netip.MustParseAddr("127.0.0.1"), f.IpRouter)
+			ports = append(ports, f.DstPort)
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for flows")
+		}
+	}
+	assert.Equal(t, []uint16{80, 53, 443, 0}, ports)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.Equal(t, uint64(4), c.Stats().Flows)
+}
+
+type recordSlice struct {
+	flows []flow.Flow
+}
+
+func (s *recordSlice) WriteRecord(r *record.Record) error {
+	f, err := r.ToFlow()
+	s.flows = append(s.flows, f)
+	return err
+}
+
+func TestCollectorRun(t *testing.T) {
+	c, err := collector.Listen("127.0.0.1:0")
+	assert.Equal(t, nil, err)
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var out recordSlice
+	done := make(chan error)
+	go func() { done <- c.Run(ctx, &out) }()
+
+	send(t, c.Addr(), netflowV5)
+	for start := time.Now(); c.Stats().Flows < 2 && time.Since(start) < 5*time.Second; {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	assert.Equal(t, 2, len(out.flows))
+	assert.Equal(t, uint64(12345), out.flows[0].Bytes)
+	assert.Equal(t, netip.MustParseAddr("192.168.0.2"), out.flows[0].DstAddr)
+}
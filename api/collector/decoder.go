@@ -0,0 +1,399 @@
+package collector
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/matejnesuta/libnf-go/api/errors"
+	"github.com/matejnesuta/libnf-go/api/fields"
+	"github.com/matejnesuta/libnf-go/api/flow"
+)
+
+// A list of supported export protocol versions.
+const (
+	NetflowV5 uint16 = 5
+	NetflowV9 uint16 = 9
+	IPFIX     uint16 = 10
+)
+
+const (
+	v5HeaderLen    = 24
+	v5RecordLen    = 48
+	v9HeaderLen    = 20
+	ipfixHeaderLen = 16
+	setHeaderLen   = 4
+
+	// Set IDs of template sets. Data sets use IDs of 256 and more.
+	v9TemplateSet           = 0
+	v9OptionsTemplateSet    = 1
+	ipfixTemplateSet        = 2
+	ipfixOptionsTemplateSet = 3
+	minDataSet              = 256
+
+	// variableLength marks an IPFIX field whose length is given in the data record.
+	variableLength = 0xffff
+	enterpriseBit  = 0x8000
+)
+
+// Stats holds the counters of a Decoder.
+type Stats struct {
+	Packets          uint64 // Packets decoded, including malformed ones.
+	Flows            uint64 // Flow records decoded.
+	Malformed        uint64 // Packets which could not be decoded completely.
+	MissingTemplates uint64 // Data sets skipped because their template was not received yet.
+}
+
+// templateKey identifies a template of an exporter. The source ID of NetFlow v9
+// and the observation domain ID of IPFIX both scope template IDs.
+type templateKey struct {
+	exporter netip.Addr
+	version  uint16
+	domain   uint32
+	id       uint16
+}
+
+type templateField struct {
+	id         uint16
+	length     uint16
+	enterprise bool
+}
+
+type template struct {
+	fields  []templateField
+	minLen  int  // Length of a data record with empty variable length fields.
+	options bool // Options data records describe the exporter, not flows, and are skipped.
+}
+
+// Decoder decodes NetFlow v5, NetFlow v9, IPFIX and sFlow v5 packets into flows.
+//
+// NetFlow v9 and IPFIX templates are remembered per exporter, so a single
+// Decoder should be used for all packets of an exporter. A Decoder is safe
+// for concurrent use.
+type Decoder struct {
+	mu        sync.Mutex
+	templates map[templateKey]*template
+	stats     Stats
+	now       func() time.Time
+}
+
+// NewDecoder returns a new decoder without any templates.
+func NewDecoder() *Decoder {
+	return &Decoder{templates: make(map[templateKey]*template), now: time.Now}
+}
+
+// Stats returns the counters of the decoder.
+func (d *Decoder) Stats() Stats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stats
+}
+
+// Decode appends the flows of the packet received from exporter to dst and
+// returns the extended slice.
+//
+// Every flow has fields.Received set to the time of decoding, fields.IpRouter
+// to the exporter address and fields.AggrFlows to 1 unless exported otherwise.
+// Templates are stored for later packets. If the packet is malformed, the flows
+// decoded so far are returned together with an error wrapping
+// errors.ErrMalformedPacket. Data sets whose template is unknown are skipped
+// and counted in Stats.
+func (d *Decoder) Decode(exporter netip.Addr, packet []byte, dst []flow.Flow) ([]flow.Flow, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stats.Packets++
+	exporter = exporter.Unmap()
+
+	if len(packet) < 2 {
+		d.stats.Malformed++
+		return dst, fmt.Errorf("%w: packet of %d bytes", errors.ErrMalformedPacket, len(packet))
+	}
+	n := len(dst)
+	now := d.now()
+	var err error
+	switch version := binary.BigEndian.Uint16(packet); {
+	case len(packet) >= 4 && binary.BigEndian.Uint32(packet) == SFlowV5:
+		dst, err = decodeSFlow(packet, now, dst)
+	case version == NetflowV5:
+		dst, err = d.decodeV5(packet, dst)
+	case version == NetflowV9:
+		dst, err = d.decodeV9(exporter, packet, dst)
+	case version == IPFIX:
+		dst, err = d.decodeIPFIX(exporter, packet, dst)
+	default:
+		return dst, fmt.Errorf("%w: %d", errors.ErrUnsupportedVersion, version)
+	}
+	if err != nil {
+		d.stats.Malformed++
+	}
+
+	received := uint64(now.UnixMilli())
+	for i := n; i < len(dst); i++ {
+		f := &dst[i]
+		f.Received = received
+		f.Present.Add(fields.Received)
+		f.IpRouter = exporter
+		f.Present.Add(fields.IpRouter)
+		if !f.Present.Has(fields.AggrFlows) {
+			f.Flows = 1
+			f.Present.Add(fields.AggrFlows)
+		}
+	}
+	d.stats.Flows += uint64(len(dst) - n)
+	return dst, err
+}
+
+func malformed(format string, args ...any) error {
+	return fmt.Errorf("%w: "+format, append([]any{errors.ErrMalformedPacket}, args...)...)
+}
+
+// decodeV5 decodes a NetFlow v5 packet, whose records have a fixed layout.
+func (d *Decoder) decodeV5(packet []byte, dst []flow.Flow) ([]flow.Flow, error) {
+	if len(packet) < v5HeaderLen {
+		return dst, malformed("NetFlow v5 header of %d bytes", len(packet))
+	}
+	count := int(binary.BigEndian.Uint16(packet[2:]))
+	c := exportContext{
+		exportTime: time.Unix(int64(binary.BigEndian.Uint32(packet[8:])), int64(binary.BigEndian.Uint32(packet[12:]))),
+		uptime:     binary.BigEndian.Uint32(packet[4:]),
+		hasUptime:  true,
+	}
+	engineType, engineId := packet[20], packet[21]
+	sampling := binary.BigEndian.Uint16(packet[22:])
+	if len(packet) < v5HeaderLen+count*v5RecordLen {
+		return dst, malformed("NetFlow v5 packet of %d bytes with %d records", len(packet), count)
+	}
+
+	for i := range count {
+		b := packet[v5HeaderLen+i*v5RecordLen:]
+		var f flow.Flow
+		f.SrcAddr = netip.AddrFrom4([4]byte(b[0:4]))
+		f.DstAddr = netip.AddrFrom4([4]byte(b[4:8]))
+		f.NextHop = netip.AddrFrom4([4]byte(b[8:12]))
+		f.Input = uint32(binary.BigEndian.Uint16(b[12:]))
+		f.Output = uint32(binary.BigEndian.Uint16(b[14:]))
+		f.Packets = uint64(binary.BigEndian.Uint32(b[16:]))
+		f.Bytes = uint64(binary.BigEndian.Uint32(b[20:]))
+		f.First, _ = c.relative(binary.BigEndian.Uint32(b[24:]))
+		f.Last, _ = c.relative(binary.BigEndian.Uint32(b[28:]))
+		f.SrcPort = binary.BigEndian.Uint16(b[32:])
+		f.DstPort = binary.BigEndian.Uint16(b[34:])
+		f.TcpFlags = b[37]
+		f.Prot = b[38]
+		f.Tos = b[39]
+		f.SrcAS = uint32(binary.BigEndian.Uint16(b[40:]))
+		f.DstAS = uint32(binary.BigEndian.Uint16(b[42:]))
+		f.SrcMask = b[44]
+		f.DstMask = b[45]
+		f.EngineType = engineType
+		f.EngineId = engineId
+		for _, field := range v5Fields {
+			f.Present.Add(field)
+		}
+		if sampling&0x3fff != 0 {
+			f.SamplerMode = sampling >> 14
+			f.SamplerInterval = uint32(sampling & 0x3fff)
+			f.Present.Add(fields.SamplerMode)
+			f.Present.Add(fields.SamplerInterval)
+		}
+		dst = append(dst, f)
+	}
+	return dst, nil
+}
+
+// v5Fields lists the fields set in every NetFlow v5 flow.
+var v5Fields = []int{
+	fields.SrcAddr, fields.DstAddr, fields.IpNextHop, fields.Input, fields.Output,
+	fields.Dpkts, fields.Doctets, fields.First, fields.Last, fields.SrcPort, fields.DstPort,
+	fields.TcpFlags, fields.Prot, fields.Tos, fields.SrcAS, fields.DstAS, fields.SrcMask,
+	fields.DstMask, fields.EngineType, fields.EngineId,
+}
+
+// decodeV9 decodes a NetFlow v9 packet. The count in its header is not checked,
+// as exporters disagree on whether it counts records or sets.
+func (d *Decoder) decodeV9(exporter netip.Addr, packet []byte, dst []flow.Flow) ([]flow.Flow, error) {
+	if len(packet) < v9HeaderLen {
+		return dst, malformed("NetFlow v9 header of %d bytes", len(packet))
+	}
+	c := exportContext{
+		exportTime: time.Unix(int64(binary.BigEndian.Uint32(packet[8:])), 0),
+		uptime:     binary.BigEndian.Uint32(packet[4:]),
+		hasUptime:  true,
+	}
+	domain := binary.BigEndian.Uint32(packet[16:])
+	return d.decodeSets(templateKey{exporter: exporter, version: NetflowV9, domain: domain}, packet[v9HeaderLen:], &c, dst)
+}
+
+// decodeIPFIX decodes an IPFIX message.
+func (d *Decoder) decodeIPFIX(exporter netip.Addr, packet []byte, dst []flow.Flow) ([]flow.Flow, error) {
+	if len(packet) < ipfixHeaderLen {
+		return dst, malformed("IPFIX header of %d bytes", len(packet))
+	}
+	length := int(binary.BigEndian.Uint16(packet[2:]))
+	if length < ipfixHeaderLen || length > len(packet) {
+		return dst, malformed("IPFIX message length %d in a packet of %d bytes", length, len(packet))
+	}
+	c := exportContext{exportTime: time.Unix(int64(binary.BigEndian.Uint32(packet[4:])), 0)}
+	domain := binary.BigEndian.Uint32(packet[12:])
+	return d.decodeSets(templateKey{exporter: exporter, version: IPFIX, domain: domain}, packet[ipfixHeaderLen:length], &c, dst)
+}
+
+// decodeSets decodes the template and data sets (flowsets in NetFlow v9) of a packet.
+func (d *Decoder) decodeSets(key templateKey, b []byte, c *exportContext, dst []flow.Flow) ([]flow.Flow, error) {
+	for len(b) > 0 {
+		if len(b) < setHeaderLen {
+			return dst, malformed("set header of %d bytes", len(b))
+		}
+		id := binary.BigEndian.Uint16(b)
+		length := int(binary.BigEndian.Uint16(b[2:]))
+		if length < setHeaderLen || length > len(b) {
+			return dst, malformed("set length %d with %d bytes left", length, len(b))
+		}
+		body := b[setHeaderLen:length]
+		b = b[length:]
+
+		var err error
+		switch {
+		case key.version == NetflowV9 && id == v9TemplateSet,
+			key.version == IPFIX && id == ipfixTemplateSet:
+			err = d.decodeTemplates(key, body, false)
+		case key.version == NetflowV9 && id == v9OptionsTemplateSet:
+			err = d.decodeV9OptionsTemplates(key, body)
+		case key.version == IPFIX && id == ipfixOptionsTemplateSet:
+			err = d.decodeTemplates(key, body, true)
+		case id >= minDataSet:
+			key.id = id
+			t, ok := d.templates[key]
+			if !ok {
+				d.stats.MissingTemplates++
+				continue
+			}
+			dst, err = decodeData(t, body, c, dst)
+		}
+		if err != nil {
+			return dst, err
+		}
+	}
+	return dst, nil
+}
+
+// decodeTemplates decodes the template records of a template set or, if options
+// is set, of an IPFIX options template set. An IPFIX template record without
+// fields withdraws the template.
+func (d *Decoder) decodeTemplates(key templateKey, b []byte, options bool) error {
+	for len(b) >= 4 {
+		key.id = binary.BigEndian.Uint16(b)
+		count := int(binary.BigEndian.Uint16(b[2:]))
+		b = b[4:]
+		if count == 0 {
+			delete(d.templates, key)
+			continue
+		}
+		if options {
+			if len(b) < 2 {
+				return malformed("options template %d without a scope field count", key.id)
+			}
+			b = b[2:]
+		}
+
+		t := &template{options: options, fields: make([]templateField, 0, count)}
+		for range count {
+			if len(b) < 4 {
+				return malformed("template %d with %d bytes left", key.id, len(b))
+			}
+			field := templateField{id: binary.BigEndian.Uint16(b), length: binary.BigEndian.Uint16(b[2:])}
+			b = b[4:]
+			if key.version == IPFIX && field.id&enterpriseBit != 0 {
+				if len(b) < 4 {
+					return malformed("template %d with %d bytes left", key.id, len(b))
+				}
+				field.id &^= enterpriseBit
+				field.enterprise = true
+				b = b[4:]
+			}
+			t.add(field)
+		}
+		if key.id < minDataSet {
+			return malformed("template ID %d", key.id)
+		}
+		d.templates[key] = t
+	}
+	// The rest is padding.
+	return nil
+}
+
+// decodeV9OptionsTemplates decodes a NetFlow v9 options template set.
+// Only the lengths of the fields are kept, so the options data can be skipped.
+func (d *Decoder) decodeV9OptionsTemplates(key templateKey, b []byte) error {
+	for len(b) >= 6 {
+		key.id = binary.BigEndian.Uint16(b)
+		scopeLen := int(binary.BigEndian.Uint16(b[2:]))
+		optionLen := int(binary.BigEndian.Uint16(b[4:]))
+		b = b[6:]
+		if (scopeLen+optionLen)%4 != 0 || scopeLen+optionLen > len(b) {
+			return malformed("options template %d with scope length %d and option length %d", key.id, scopeLen, optionLen)
+		}
+		t := &template{options: true}
+		for i := 0; i < scopeLen+optionLen; i += 4 {
+			t.add(templateField{id: binary.BigEndian.Uint16(b[i:]), length: binary.BigEndian.Uint16(b[i+2:])})
+		}
+		b = b[scopeLen+optionLen:]
+		if key.id < minDataSet {
+			return malformed("template ID %d", key.id)
+		}
+		d.templates[key] = t
+	}
+	return nil
+}
+
+func (t *template) add(field templateField) {
+	t.fields = append(t.fields, field)
+	if field.length == variableLength {
+		t.minLen++
+	} else {
+		t.minLen += int(field.length)
+	}
+}
+
+// decodeData decodes the records of a data set described by the template.
+func decodeData(t *template, b []byte, c *exportContext, dst []flow.Flow) ([]flow.Flow, error) {
+	if t.minLen == 0 {
+		return dst, nil
+	}
+	for len(b) >= t.minLen {
+		var f flow.Flow
+		for _, field := range t.fields {
+			length := int(field.length)
+			if field.length == variableLength {
+				if len(b) < 1 {
+					return dst, malformed("variable length field %d truncated", field.id)
+				}
+				length, b = int(b[0]), b[1:]
+				if length == 255 {
+					if len(b) < 2 {
+						return dst, malformed("variable length field %d truncated", field.id)
+					}
+					length, b = int(binary.BigEndian.Uint16(b)), b[2:]
+				}
+			}
+			if length > len(b) {
+				return dst, malformed("field %d of %d bytes with %d bytes left", field.id, length, len(b))
+			}
+			value := b[:length]
+			b = b[length:]
+			if t.options || field.enterprise {
+				continue
+			}
+			if e, ok := elements[field.id]; ok && e.set(&f, value, c) {
+				f.Present.Add(e.field)
+			}
+		}
+		if !t.options {
+			dst = append(dst, f)
+		}
+	}
+	// The rest is padding.
+	return dst, nil
+}
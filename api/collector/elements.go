@@ -0,0 +1,213 @@
+package collector
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/matejnesuta/libnf-go/api/fields"
+	"github.com/matejnesuta/libnf-go/api/flow"
+)
+
+// exportContext holds the header values needed to decode the fields of a data record.
+type exportContext struct {
+	exportTime time.Time // Time the packet was exported.
+	uptime     uint32    // System uptime of the exporter in milliseconds, NetFlow v9 only.
+	hasUptime  bool
+}
+
+// relative returns the time of an event reported in milliseconds of system uptime.
+func (c *exportContext) relative(ms uint32) (time.Time, bool) {
+	if !c.hasUptime {
+		return time.Time{}, false
+	}
+	return c.exportTime.Add(-time.Duration(c.uptime-ms) * time.Millisecond), true
+}
+
+// element decodes one information element into a flow. The value has the
+// length given by the template. It returns false if the value cannot be used.
+type element struct {
+	field int
+	set   func(f *flow.Flow, b []byte, c *exportContext) bool
+}
+
+// beUint decodes a big-endian unsigned integer of 1 to 8 bytes, the reduced-size
+// encoding allowed by NetFlow v9 and IPFIX.
+func beUint(b []byte) (uint64, bool) {
+	if len(b) == 0 || len(b) > 8 {
+		return 0, false
+	}
+	var v uint64
+	for _, x := range b {
+		v = v<<8 | uint64(x)
+	}
+	return v, true
+}
+
+func uintElement[T uint8 | uint16 | uint32 | uint64](field int, dst func(f *flow.Flow) *T) element {
+	return element{field, func(f *flow.Flow, b []byte, c *exportContext) bool {
+		v, ok := beUint(b)
+		*dst(f) = T(v)
+		return ok
+	}}
+}
+
+func addrElement(field int, dst func(f *flow.Flow) *netip.Addr) element {
+	return element{field, func(f *flow.Flow, b []byte, c *exportContext) bool {
+		switch len(b) {
+		case 4:
+			*dst(f) = netip.AddrFrom4([4]byte(b))
+		case 16:
+			*dst(f) = netip.AddrFrom16([16]byte(b))
+		default:
+			return false
+		}
+		return true
+	}}
+}
+
+func macElement(field int, dst func(f *flow.Flow) *flow.MAC) element {
+	return element{field, func(f *flow.Flow, b []byte, c *exportContext) bool {
+		if len(b) != 6 {
+			return false
+		}
+		*dst(f) = flow.MAC(b)
+		return true
+	}}
+}
+
+// timeElement decodes an absolute timestamp counted in units since the Unix epoch.
+func timeElement(field int, unit time.Duration, dst func(f *flow.Flow) *time.Time) element {
+	return element{field, func(f *flow.Flow, b []byte, c *exportContext) bool {
+		v, ok := beUint(b)
+		*dst(f) = time.Unix(0, 0).Add(time.Duration(v) * unit)
+		return ok
+	}}
+}
+
+// uptimeElement decodes a timestamp in milliseconds of system uptime.
+func uptimeElement(field int, dst func(f *flow.Flow) *time.Time) element {
+	return element{field, func(f *flow.Flow, b []byte, c *exportContext) bool {
+		v, ok := beUint(b)
+		if !ok {
+			return false
+		}
+		*dst(f), ok = c.relative(uint32(v))
+		return ok
+	}}
+}
+
+// deltaElement decodes a timestamp in microseconds before the export time.
+func deltaElement(field int, dst func(f *flow.Flow) *time.Time) element {
+	return element{field, func(f *flow.Flow, b []byte, c *exportContext) bool {
+		v, ok := beUint(b)
+		*dst(f) = c.exportTime.Add(-time.Duration(v) * time.Microsecond)
+		return ok
+	}}
+}
+
+// icmpElement decodes the ICMP type and code exported as type*256+code.
+// Like nfcapd, the value is also stored as the destination port.
+func icmpElement() element {
+	return element{fields.IcmpType, func(f *flow.Flow, b []byte, c *exportContext) bool {
+		v, ok := beUint(b)
+		f.IcmpType, f.IcmpCode, f.DstPort = uint8(v>>8), uint8(v), uint16(v)
+		f.Present.Add(fields.IcmpCode)
+		f.Present.Add(fields.DstPort)
+		return ok
+	}}
+}
+
+func mplsElement(i int) element {
+	return element{fields.MplsLabel, func(f *flow.Flow, b []byte, c *exportContext) bool {
+		v, ok := beUint(b)
+		f.MplsLabel[i] = uint32(v)
+		return ok
+	}}
+}
+
+// elements maps the NetFlow v9 field types and IPFIX information element IDs
+// (which share their numbers) to the flow fields they are stored in.
+var elements = map[uint16]element{
+	1:   uintElement(fields.Doctets, func(f *flow.Flow) *uint64 { return &f.Bytes }),
+	2:   uintElement(fields.Dpkts, func(f *flow.Flow) *uint64 { return &f.Packets }),
+	3:   uintElement(fields.AggrFlows, func(f *flow.Flow) *uint64 { return &f.Flows }),
+	4:   uintElement(fields.Prot, func(f *flow.Flow) *uint8 { return &f.Prot }),
+	5:   uintElement(fields.Tos, func(f *flow.Flow) *uint8 { return &f.Tos }),
+	6:   uintElement(fields.TcpFlags, func(f *flow.Flow) *uint8 { return &f.TcpFlags }),
+	7:   uintElement(fields.SrcPort, func(f *flow.Flow) *uint16 { return &f.SrcPort }),
+	8:   addrElement(fields.SrcAddr, func(f *flow.Flow) *netip.Addr { return &f.SrcAddr }),
+	9:   uintElement(fields.SrcMask, func(f *flow.Flow) *uint8 { return &f.SrcMask }),
+	10:  uintElement(fields.Input, func(f *flow.Flow) *uint32 { return &f.Input }),
+	11:  uintElement(fields.DstPort, func(f *flow.Flow) *uint16 { return &f.DstPort }),
+	12:  addrElement(fields.DstAddr, func(f *flow.Flow) *netip.Addr { return &f.DstAddr }),
+	13:  uintElement(fields.DstMask, func(f *flow.Flow) *uint8 { return &f.DstMask }),
+	14:  uintElement(fields.Output, func(f *flow.Flow) *uint32 { return &f.Output }),
+	15:  addrElement(fields.IpNextHop, func(f *flow.Flow) *netip.Addr { return &f.NextHop }),
+	16:  uintElement(fields.SrcAS, func(f *flow.Flow) *uint32 { return &f.SrcAS }),
+	17:  uintElement(fields.DstAS, func(f *flow.Flow) *uint32 { return &f.DstAS }),
+	18:  addrElement(fields.BgpNextHop, func(f *flow.Flow) *netip.Addr { return &f.BgpNextHop }),
+	21:  uptimeElement(fields.Last, func(f *flow.Flow) *time.Time { return &f.Last }),
+	22:  uptimeElement(fields.First, func(f *flow.Flow) *time.Time { return &f.First }),
+	23:  uintElement(fields.OutBytes, func(f *flow.Flow) *uint64 { return &f.OutBytes }),
+	24:  uintElement(fields.OutPkts, func(f *flow.Flow) *uint64 { return &f.OutPackets }),
+	27:  addrElement(fields.SrcAddr, func(f *flow.Flow) *netip.Addr { return &f.SrcAddr }),
+	28:  addrElement(fields.DstAddr, func(f *flow.Flow) *netip.Addr { return &f.DstAddr }),
+	29:  uintElement(fields.SrcMask, func(f *flow.Flow) *uint8 { return &f.SrcMask }),
+	30:  uintElement(fields.DstMask, func(f *flow.Flow) *uint8 { return &f.DstMask }),
+	32:  icmpElement(),
+	34:  uintElement(fields.SamplerInterval, func(f *flow.Flow) *uint32 { return &f.SamplerInterval }),
+	35:  uintElement(fields.SamplerMode, func(f *flow.Flow) *uint16 { return &f.SamplerMode }),
+	38:  uintElement(fields.EngineType, func(f *flow.Flow) *uint8 { return &f.EngineType }),
+	39:  uintElement(fields.EngineId, func(f *flow.Flow) *uint8 { return &f.EngineId }),
+	55:  uintElement(fields.DstTos, func(f *flow.Flow) *uint8 { return &f.DstTos }),
+	56:  macElement(fields.InSrcMac, func(f *flow.Flow) *flow.MAC { return &f.InSrcMac }),
+	57:  macElement(fields.OutDstMac, func(f *flow.Flow) *flow.MAC { return &f.OutDstMac }),
+	58:  uintElement(fields.SrcVlan, func(f *flow.Flow) *uint16 { return &f.SrcVlan }),
+	59:  uintElement(fields.DstVlan, func(f *flow.Flow) *uint16 { return &f.DstVlan }),
+	61:  uintElement(fields.Dir, func(f *flow.Flow) *uint8 { return &f.Dir }),
+	62:  addrElement(fields.IpNextHop, func(f *flow.Flow) *netip.Addr { return &f.NextHop }),
+	63:  addrElement(fields.BgpNextHop, func(f *flow.Flow) *netip.Addr { return &f.BgpNextHop }),
+	80:  macElement(fields.InDstMac, func(f *flow.Flow) *flow.MAC { return &f.InDstMac }),
+	81:  macElement(fields.OutSrcMac, func(f *flow.Flow) *flow.MAC { return &f.OutSrcMac }),
+	85:  uintElement(fields.Doctets, func(f *flow.Flow) *uint64 { return &f.Bytes }),
+	86:  uintElement(fields.Dpkts, func(f *flow.Flow) *uint64 { return &f.Packets }),
+	89:  uintElement(fields.FwdStatus, func(f *flow.Flow) *uint8 { return &f.FwdStatus }),
+	128: uintElement(fields.BgpNextAdjacentAS, func(f *flow.Flow) *uint32 { return &f.BgpNextAdjacentAS }),
+	129: uintElement(fields.BgpPrevAdjacentAS, func(f *flow.Flow) *uint32 { return &f.BgpPrevAdjacentAS }),
+	139: icmpElement(),
+	148: uintElement(fields.ConnId, func(f *flow.Flow) *uint32 { return &f.ConnId }),
+	150: timeElement(fields.First, time.Second, func(f *flow.Flow) *time.Time { return &f.First }),
+	151: timeElement(fields.Last, time.Second, func(f *flow.Flow) *time.Time { return &f.Last }),
+	152: timeElement(fields.First, time.Millisecond, func(f *flow.Flow) *time.Time { return &f.First }),
+	153: timeElement(fields.Last, time.Millisecond, func(f *flow.Flow) *time.Time { return &f.Last }),
+	158: deltaElement(fields.First, func(f *flow.Flow) *time.Time { return &f.First }),
+	159: deltaElement(fields.Last, func(f *flow.Flow) *time.Time { return &f.Last }),
+	176: uintElement(fields.IcmpType, func(f *flow.Flow) *uint8 { return &f.IcmpType }),
+	177: uintElement(fields.IcmpCode, func(f *flow.Flow) *uint8 { return &f.IcmpCode }),
+	178: uintElement(fields.IcmpType, func(f *flow.Flow) *uint8 { return &f.IcmpType }),
+	179: uintElement(fields.IcmpCode, func(f *flow.Flow) *uint8 { return &f.IcmpCode }),
+	225: addrElement(fields.XlateSrcIp, func(f *flow.Flow) *netip.Addr { return &f.XlateSrcIp }),
+	226: addrElement(fields.XlateDstIp, func(f *flow.Flow) *netip.Addr { return &f.XlateDstIp }),
+	227: uintElement(fields.XlateSrcPort, func(f *flow.Flow) *uint16 { return &f.XlateSrcPort }),
+	228: uintElement(fields.XlateDstPort, func(f *flow.Flow) *uint16 { return &f.XlateDstPort }),
+	230: uintElement(fields.EventFlag, func(f *flow.Flow) *uint8 { return &f.EventFlag }),
+	233: uintElement(fields.FwEvent, func(f *flow.Flow) *uint8 { return &f.FwEvent }),
+	234: uintElement(fields.IngressVrfid, func(f *flow.Flow) *uint32 { return &f.IngressVrfid }),
+	235: uintElement(fields.EgressVrfid, func(f *flow.Flow) *uint32 { return &f.EgressVrfid }),
+	281: addrElement(fields.XlateSrcIp, func(f *flow.Flow) *netip.Addr { return &f.XlateSrcIp }),
+	282: addrElement(fields.XlateDstIp, func(f *flow.Flow) *netip.Addr { return &f.XlateDstIp }),
+	323: uintElement(fields.EventTime, func(f *flow.Flow) *uint64 { return &f.EventTime }),
+	361: uintElement(fields.BlockStart, func(f *flow.Flow) *uint16 { return &f.BlockStart }),
+	362: uintElement(fields.BlockEnd, func(f *flow.Flow) *uint16 { return &f.BlockEnd }),
+	363: uintElement(fields.BlockStep, func(f *flow.Flow) *uint16 { return &f.BlockStep }),
+	364: uintElement(fields.BlockSize, func(f *flow.Flow) *uint16 { return &f.BlockSize }),
+	// Cisco NSEL extended event, only exported by NetFlow v9.
+	33002: uintElement(fields.FwXEvent, func(f *flow.Flow) *uint16 { return &f.FwXEvent }),
+}
+
+func init() {
+	// MPLS_LABEL_1 to MPLS_LABEL_10
+	for i := range len(fields.Mpls{}) {
+		elements[uint16(70+i)] = mplsElement(i)
+	}
+}
@@ -0,0 +1,271 @@
+package collector
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"time"
+
+	"github.com/matejnesuta/libnf-go/api/fields"
+	"github.com/matejnesuta/libnf-go/api/flow"
+	"github.com/matejnesuta/libnf-go/api/internal/packet"
+)
+
+// SFlowV5 is the version of sFlow datagrams, which unlike NetFlow start
+// with a 32-bit version number.
+const SFlowV5 uint32 = 5
+
+// sFlow sample and flow record formats of the standard enterprise (0).
+const (
+	sflowFlowSample         = 1
+	sflowExpandedFlowSample = 3
+
+	sflowRawHeader       = 1
+	sflowEthernetFrame   = 2
+	sflowIPv4            = 3
+	sflowIPv6            = 4
+	sflowExtendedSwitch  = 1001
+	sflowExtendedRouter  = 1002
+	sflowExtendedGateway = 1003
+
+	// Protocols of raw packet headers.
+	sflowHeaderEthernet = 1
+	sflowHeaderIPv4     = 11
+	sflowHeaderIPv6     = 12
+)
+
+// xdrReader reads the XDR encoded values of an sFlow datagram. After the first
+// read past the end of the data, err is set and every read returns zero values.
+type xdrReader struct {
+	b   []byte
+	err error
+}
+
+func (r *xdrReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.b) {
+		r.err = malformed("sFlow value of %d bytes with %d bytes left", n, len(r.b))
+		r.b = nil
+		return nil
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b
+}
+
+func (r *xdrReader) uint32() uint32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+// opaque reads n bytes padded to a multiple of 4 bytes.
+func (r *xdrReader) opaque(n int) []byte {
+	b := r.next(n)
+	r.next((4 - n%4) % 4)
+	return b
+}
+
+// addr reads an address preceded by its type.
+func (r *xdrReader) addr() netip.Addr {
+	switch r.uint32() {
+	case 1:
+		if b := r.next(4); b != nil {
+			return netip.AddrFrom4([4]byte(b))
+		}
+	case 2:
+		if b := r.next(16); b != nil {
+			return netip.AddrFrom16([16]byte(b))
+		}
+	}
+	return netip.Addr{}
+}
+
+// decodeSFlow decodes an sFlow v5 datagram. Every flow sample becomes one flow
+// starting and ending at the time of decoding, with the bytes and packets of
+// the sampled packet multiplied by the sampling rate. Counter samples are skipped.
+func decodeSFlow(datagram []byte, now time.Time, dst []flow.Flow) ([]flow.Flow, error) {
+	r := xdrReader{b: datagram[4:]}
+	r.addr()
+	r.next(12) // Sub-agent ID, sequence number and uptime.
+	count := r.uint32()
+	for range count {
+		format := r.uint32()
+		data := r.opaque(int(r.uint32()))
+		if r.err != nil {
+			return dst, r.err
+		}
+		if format != sflowFlowSample && format != sflowExpandedFlowSample {
+			continue
+		}
+		f, err := decodeFlowSample(data, format == sflowExpandedFlowSample, now)
+		if err != nil {
+			return dst, err
+		}
+		dst = append(dst, f)
+	}
+	return dst, nil
+}
+
+func decodeFlowSample(b []byte, expanded bool, now time.Time) (flow.Flow, error) {
+	var f flow.Flow
+	r := xdrReader{b: b}
+	if expanded {
+		r.next(12) // Sequence number, source ID type and index.
+		f.SamplerInterval = r.uint32()
+		r.next(8) // Sample pool and drops.
+		inFormat, inValue := r.uint32(), r.uint32()
+		outFormat, outValue := r.uint32(), r.uint32()
+		f.Input, f.Output = ifIndex(inFormat, inValue), ifIndex(outFormat, outValue)
+	} else {
+		r.next(8) // Sequence number and source ID.
+		f.SamplerInterval = r.uint32()
+		r.next(8) // Sample pool and drops.
+		input, output := r.uint32(), r.uint32()
+		f.Input, f.Output = ifIndex(input>>30, input&0x3fffffff), ifIndex(output>>30, output&0x3fffffff)
+	}
+	if f.SamplerInterval == 0 {
+		f.SamplerInterval = 1
+	}
+	f.First, f.Last = now, now
+	mark(&f, fields.First, fields.Last, fields.SamplerInterval, fields.Input, fields.Output)
+
+	var length uint32
+	count := r.uint32()
+	for range count {
+		format := r.uint32()
+		data := r.opaque(int(r.uint32()))
+		if r.err != nil {
+			return f, r.err
+		}
+		rec := xdrReader{b: data}
+		switch format {
+		case sflowRawHeader:
+			length = decodeRawHeader(&f, &rec)
+		case sflowEthernetFrame:
+			rec.uint32() // Frame length, the IP length is taken from the header.
+			src, dst := rec.opaque(6), rec.opaque(6)
+			if rec.err == nil {
+				f.InSrcMac, f.OutDstMac = flow.MAC(src), flow.MAC(dst)
+				mark(&f, fields.InSrcMac, fields.OutDstMac)
+			}
+		case sflowIPv4, sflowIPv6:
+			size := 4
+			if format == sflowIPv6 {
+				size = 16
+			}
+			n := rec.uint32()
+			f.Prot = uint8(rec.uint32())
+			src, dst := rec.next(size), rec.next(size)
+			f.SrcPort, f.DstPort = uint16(rec.uint32()), uint16(rec.uint32())
+			f.TcpFlags, f.Tos = uint8(rec.uint32()), uint8(rec.uint32())
+			if rec.err == nil {
+				f.SrcAddr, _ = netip.AddrFromSlice(src)
+				f.DstAddr, _ = netip.AddrFromSlice(dst)
+				mark(&f, fields.Prot, fields.SrcAddr, fields.DstAddr, fields.SrcPort, fields.DstPort,
+					fields.TcpFlags, fields.Tos)
+				if length == 0 {
+					length = n
+				}
+			}
+		case sflowExtendedSwitch:
+			f.SrcVlan = uint16(rec.uint32())
+			rec.uint32()
+			f.DstVlan = uint16(rec.uint32())
+			mark(&f, fields.SrcVlan, fields.DstVlan)
+		case sflowExtendedRouter:
+			f.NextHop = rec.addr()
+			f.SrcMask, f.DstMask = uint8(rec.uint32()), uint8(rec.uint32())
+			mark(&f, fields.IpNextHop, fields.SrcMask, fields.DstMask)
+		case sflowExtendedGateway:
+			decodeGateway(&f, &rec)
+		}
+		if rec.err != nil {
+			return f, rec.err
+		}
+	}
+	if r.err != nil {
+		return f, r.err
+	}
+
+	f.Packets = uint64(f.SamplerInterval)
+	f.Bytes = uint64(length) * uint64(f.SamplerInterval)
+	mark(&f, fields.Dpkts, fields.Doctets)
+	return f, nil
+}
+
+// ifIndex returns the index of an interface. Formats other than a single
+// interface (discarded packets or multiple interfaces) are returned as 0.
+func ifIndex(format, value uint32) uint32 {
+	if format != 0 {
+		return 0
+	}
+	return value
+}
+
+// decodeGateway decodes the BGP information of an extended gateway record.
+// The destination AS is the last AS of the AS path.
+func decodeGateway(f *flow.Flow, r *xdrReader) {
+	f.BgpNextHop = r.addr()
+	r.uint32() // AS of the router.
+	f.SrcAS = r.uint32()
+	f.BgpPrevAdjacentAS = r.uint32()
+	mark(f, fields.BgpNextHop, fields.SrcAS, fields.BgpPrevAdjacentAS)
+	segments := r.uint32()
+	for range segments {
+		if r.err != nil {
+			return
+		}
+		r.uint32() // Segment type.
+		n := r.uint32()
+		for i := range n {
+			as := r.uint32()
+			if i == 0 && !f.Has(fields.BgpNextAdjacentAS) {
+				f.BgpNextAdjacentAS = as
+				mark(f, fields.BgpNextAdjacentAS)
+			}
+			f.DstAS = as
+			mark(f, fields.DstAS)
+			if r.err != nil {
+				return
+			}
+		}
+	}
+}
+
+// decodeRawHeader decodes the sampled packet header and returns the length of
+// the IP packet, the same quantity NetFlow exporters count in bytes.
+func decodeRawHeader(f *flow.Flow, r *xdrReader) uint32 {
+	protocol := r.uint32()
+	frameLength := r.uint32()
+	stripped := r.uint32()
+	header := r.opaque(int(r.uint32()))
+	if r.err != nil {
+		return 0
+	}
+
+	offset := 0
+	switch protocol {
+	case sflowHeaderEthernet:
+		offset, _ = packet.Ethernet(f, header)
+	case sflowHeaderIPv4:
+		packet.IPv4(f, header)
+	case sflowHeaderIPv6:
+		packet.IPv6(f, header)
+	default:
+		return 0
+	}
+	if offset < 0 || frameLength < stripped+uint32(offset) {
+		return 0
+	}
+	return frameLength - stripped - uint32(offset)
+}
+
+func mark(f *flow.Flow, list ...int) {
+	for _, field := range list {
+		f.Present.Add(field)
+	}
+}
@@ -0,0 +1,287 @@
+package columnar
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Constants of the Arrow IPC format, see the Schema.fbs, Message.fbs and
+// File.fbs files of the Arrow format specification.
+const (
+	arrowMetadataV5 = 4
+
+	arrowHeaderSchema      = 1
+	arrowHeaderRecordBatch = 3
+
+	arrowTypeInt             = 2
+	arrowTypeFloatingPoint   = 3
+	arrowTypeUtf8            = 5
+	arrowTypeTimestamp       = 10
+	arrowTypeFixedSizeBinary = 15
+
+	arrowPrecisionDouble = 2
+	arrowMillisecond     = 1
+
+	arrowContinuation = 0xffffffff
+)
+
+var arrowMagic = []byte("ARROW1")
+
+// arrowBlock locates a record batch in an Arrow IPC file.
+type arrowBlock struct {
+	offset         int64
+	metadataLength int32
+	bodyLength     int64
+}
+
+// ArrowWriter writes batches in the Arrow IPC format, as record batches of
+// the schema of the columns. Every column is nullable, rows which are not
+// valid are null.
+//
+// Columns are mapped to the Arrow types uint8 to uint64, float64,
+// timestamp[ms, tz=UTC], fixed_size_binary and utf8. The columns of IP
+// addresses hold 16 bytes, with IPv4 addresses mapped into IPv6.
+type ArrowWriter struct {
+	w       io.Writer
+	columns []Column
+	schema  fbTable
+	file    bool
+	offset  int64
+	blocks  []arrowBlock
+	body    []byte // Body of the record batch being written.
+	scratch []byte // Values of the column being written.
+	closed  bool
+}
+
+// NewArrowWriter returns a writer of the Arrow IPC streaming format, which can
+// be written to pipes and sockets, and writes the schema of the columns to w.
+func NewArrowWriter(w io.Writer, columns []Column) (*ArrowWriter, error) {
+	return newArrowWriter(w, columns, false)
+}
+
+// NewArrowFileWriter returns a writer of the Arrow IPC file format (.arrow
+// or Feather V2 files), which supports random access to the record batches,
+// and writes the header and the schema of the columns to w.
+func NewArrowFileWriter(w io.Writer, columns []Column) (*ArrowWriter, error) {
+	return newArrowWriter(w, columns, true)
+}
+
+func newArrowWriter(w io.Writer, columns []Column, file bool) (*ArrowWriter, error) {
+	a := &ArrowWriter{w: w, columns: append([]Column(nil), columns...), file: file}
+	fieldList := make([]fbTable, len(columns))
+	for i, column := range columns {
+		typ, value, err := arrowType(column)
+		if err != nil {
+			return nil, err
+		}
+		// name, nullable, type_type, type, dictionary, children
+		fieldList[i] = fbTable{fbString(column.Name), fbBool(true), fbUint8(typ), value, nil, []fbTable{}}
+	}
+	// endianness, fields
+	a.schema = fbTable{fbInt16(0), fieldList}
+
+	if file {
+		if err := a.write(arrowMagic, []byte{0, 0}); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := a.message(arrowHeaderSchema, a.schema, 0); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// arrowType returns the type of the Arrow field storing the column.
+func arrowType(column Column) (uint8, fbTable, error) {
+	switch column.Type {
+	case Uint8, Uint16, Uint32, Uint64:
+		// bitWidth, is_signed
+		return arrowTypeInt, fbTable{fbInt32(int32(8 * column.width())), fbBool(false)}, nil
+	case Float64:
+		return arrowTypeFloatingPoint, fbTable{fbInt16(arrowPrecisionDouble)}, nil
+	case Timestamp:
+		return arrowTypeTimestamp, fbTable{fbInt16(arrowMillisecond), fbString("UTC")}, nil
+	case FixedSizeBinary:
+		return arrowTypeFixedSizeBinary, fbTable{fbInt32(int32(column.Size))}, nil
+	case String:
+		return arrowTypeUtf8, fbTable{}, nil
+	}
+	return 0, nil, fmt.Errorf("columnar: column %q of unknown type %v", column.Name, column.Type)
+}
+
+// width returns the number of bytes per value of an integer column.
+func (c Column) width() int {
+	switch c.Type {
+	case Uint8:
+		return 1
+	case Uint16:
+		return 2
+	case Uint32:
+		return 4
+	}
+	return 8
+}
+
+func (a *ArrowWriter) write(parts ...[]byte) error {
+	for _, p := range parts {
+		n, err := a.w.Write(p)
+		a.offset += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// message writes an encapsulated message with the given header and body,
+// and returns the length of its metadata.
+func (a *ArrowWriter) message(headerType uint8, header fbTable, bodyLength int64) (int32, error) {
+	// version, header_type, header, bodyLength
+	metadata, err := finish(fbTable{fbInt16(arrowMetadataV5), fbUint8(headerType), header, fbInt64(bodyLength)})
+	if err != nil {
+		return 0, err
+	}
+	var prefix [8]byte
+	binary.LittleEndian.PutUint32(prefix[:], arrowContinuation)
+	binary.LittleEndian.PutUint32(prefix[4:], uint32(len(metadata)))
+	return int32(len(prefix) + len(metadata)), a.write(prefix[:], metadata)
+}
+
+// WriteBatch writes the batch as one record batch. The batch must hold the
+// columns the writer was created with.
+func (a *ArrowWriter) WriteBatch(b *Batch) error {
+	if a.closed {
+		return fmt.Errorf("columnar: write to a closed ArrowWriter")
+	}
+	if len(b.Vectors) != len(a.columns) {
+		return fmt.Errorf("columnar: batch of %d columns written to a schema of %d columns", len(b.Vectors), len(a.columns))
+	}
+
+	a.body = a.body[:0]
+	var nodes, buffers []byte
+	buffer := func(data []byte) {
+		buffers = binary.LittleEndian.AppendUint64(buffers, uint64(len(a.body)))
+		buffers = binary.LittleEndian.AppendUint64(buffers, uint64(len(data)))
+		a.body = append(a.body, data...)
+		for len(a.body)%8 != 0 {
+			a.body = append(a.body, 0)
+		}
+	}
+	for i := range b.Vectors {
+		v := &b.Vectors[i]
+		if v.Column != a.columns[i] {
+			return fmt.Errorf("columnar: batch column %q written to schema column %q", v.Column.Name, a.columns[i].Name)
+		}
+		validity, nulls := bitmap(v.Valid)
+		nodes = binary.LittleEndian.AppendUint64(nodes, uint64(b.Rows))
+		nodes = binary.LittleEndian.AppendUint64(nodes, uint64(nulls))
+		buffer(validity)
+
+		data := a.scratch[:0]
+		switch v.Column.Type {
+		case Uint8:
+			for _, x := range v.Uints {
+				data = append(data, uint8(x))
+			}
+		case Uint16:
+			for _, x := range v.Uints {
+				data = binary.LittleEndian.AppendUint16(data, uint16(x))
+			}
+		case Uint32:
+			for _, x := range v.Uints {
+				data = binary.LittleEndian.AppendUint32(data, uint32(x))
+			}
+		case Uint64:
+			for _, x := range v.Uints {
+				data = binary.LittleEndian.AppendUint64(data, x)
+			}
+		case Float64:
+			for _, x := range v.Floats {
+				data = binary.LittleEndian.AppendUint64(data, math.Float64bits(x))
+			}
+		case Timestamp:
+			for _, x := range v.Millis {
+				data = binary.LittleEndian.AppendUint64(data, uint64(x))
+			}
+		case FixedSizeBinary:
+			data = append(data, v.Bytes...)
+		case String:
+			// The offsets of the strings precede the buffer of their characters.
+			offset := 0
+			data = binary.LittleEndian.AppendUint32(data, 0)
+			for _, s := range v.Strings {
+				offset += len(s)
+				data = binary.LittleEndian.AppendUint32(data, uint32(offset))
+			}
+			buffer(data)
+			data = data[:0]
+			for _, s := range v.Strings {
+				data = append(data, s...)
+			}
+		}
+		buffer(data)
+		a.scratch = data
+	}
+
+	// length, nodes, buffers
+	header := fbTable{fbInt64(int64(b.Rows)), fbStructs{16, nodes}, fbStructs{16, buffers}}
+	block := arrowBlock{offset: a.offset, bodyLength: int64(len(a.body))}
+	var err error
+	if block.metadataLength, err = a.message(arrowHeaderRecordBatch, header, block.bodyLength); err != nil {
+		return err
+	}
+	if err := a.write(a.body); err != nil {
+		return err
+	}
+	a.blocks = append(a.blocks, block)
+	return nil
+}
+
+// bitmap returns the validity bitmap of the values and the number of nulls.
+// The bitmap is empty if there are no nulls.
+func bitmap(valid []bool) ([]byte, int) {
+	nulls := 0
+	for _, ok := range valid {
+		if !ok {
+			nulls++
+		}
+	}
+	if nulls == 0 {
+		return nil, 0
+	}
+	bits := make([]byte, (len(valid)+7)/8)
+	for i, ok := range valid {
+		if ok {
+			bits[i/8] |= 1 << (i % 8)
+		}
+	}
+	return bits, nulls
+}
+
+// Close writes the end of the stream, and the footer of an Arrow IPC file.
+// It does not close the underlying writer.
+func (a *ArrowWriter) Close() error {
+	if a.closed {
+		return nil
+	}
+	a.closed = true
+	eos := binary.LittleEndian.AppendUint32(binary.LittleEndian.AppendUint32(nil, arrowContinuation), 0)
+	if err := a.write(eos); err != nil || !a.file {
+		return err
+	}
+
+	var blocks []byte
+	for _, block := range a.blocks {
+		blocks = binary.LittleEndian.AppendUint64(blocks, uint64(block.offset))
+		blocks = binary.LittleEndian.AppendUint64(blocks, uint64(uint32(block.metadataLength)))
+		blocks = binary.LittleEndian.AppendUint64(blocks, uint64(block.bodyLength))
+	}
+	// version, schema, dictionaries, recordBatches
+	footer, err := finish(fbTable{fbInt16(arrowMetadataV5), a.schema, fbStructs{24, nil}, fbStructs{24, blocks}})
+	if err != nil {
+		return err
+	}
+	return a.write(footer, binary.LittleEndian.AppendUint32(nil, uint32(len(footer))), arrowMagic)
+}
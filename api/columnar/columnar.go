@@ -0,0 +1,467 @@
+// Package columnar converts streams of flow records into column batches and
+// writes them as Apache Arrow record batches or Parquet row groups.
+//
+// The schema of a batch is derived from fields.FieldTypes. Every column is a
+// plain Go slice of one of a few physical types, so the batches can be handed
+// to other columnar writers without converting the values row by row:
+//
+//	Uint8 .. Uint64  unsigned integers
+//	Float64          computed fields (e.g. fields.CalcBps)
+//	Timestamp        milliseconds since the Unix epoch, UTC
+//	FixedSizeBinary  IP addresses (16 bytes, IPv4 as IPv4-mapped IPv6),
+//	                 MAC addresses (6 bytes) and MPLS label stacks (40 bytes)
+//	String           variable length strings
+//
+// A Builder collects records from file.File or ring.Ring into batches of a
+// configurable size and Export passes every batch to a callback. ArrowWriter
+// writes the batches in the Arrow IPC streaming or file format and
+// ParquetWriter as the row groups of a Parquet file, both read by pyarrow,
+// DuckDB, Polars and Spark. The package implements the formats itself and has
+// no dependency on the Arrow or Parquet libraries. ExportArrow streams a file
+// or a ring to an Arrow IPC stream, ExportParquet to a Parquet file:
+//
+//	var f file.File
+//	f.OpenRead("nfcapd.201705281555", false, false)
+//	defer f.Close()
+//	out, _ := os.Create("flows.arrows")
+//	defer out.Close()
+//	n, err := columnar.ExportArrow(ctx, f.Records(), out, columnar.Options{Fields: []int{fields.Brec1}})
+package columnar
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"iter"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/matejnesuta/libnf-go/api/errors"
+	"github.com/matejnesuta/libnf-go/api/fields"
+	"github.com/matejnesuta/libnf-go/api/record"
+)
+
+// Type is the physical type of a column.
+type Type int
+
+// A list of column types.
+const (
+	Uint8 Type = iota
+	Uint16
+	Uint32
+	Uint64
+	Float64
+	Timestamp
+	FixedSizeBinary
+	String
+)
+
+var typeNames = [...]string{"uint8", "uint16", "uint32", "uint64", "float64", "timestamp[ms]", "fixed_size_binary", "string"}
+
+func (t Type) String() string {
+	if t < 0 || int(t) >= len(typeNames) {
+		return fmt.Sprintf("Type(%d)", int(t))
+	}
+	return typeNames[t]
+}
+
+// DefaultBatchSize is the number of rows per batch used if none is given.
+const DefaultBatchSize = 64 * 1024
+
+// Column describes a column of a batch.
+type Column struct {
+	Name  string // libnf name of the field, e.g. "srcip".
+	Field int    // Field stored in the column.
+	Type  Type
+	Size  int // Number of bytes per value of FixedSizeBinary columns, 0 otherwise.
+}
+
+// Schema returns the columns storing the given fields, in order. Fields of
+// the fields.Acl type are expanded into one column per member field and
+// fields.Brec1 is expanded into its member fields. Pair fields are not accepted.
+func Schema(fieldList []int) ([]Column, error) {
+	var columns []Column
+	for _, field := range fieldList {
+		info, ok := fields.Lookup(field)
+		if !ok || info.Pair {
+			return nil, fmt.Errorf("%w: %d", errors.ErrUnknownFld, field)
+		}
+		if members, ok := expanded[field]; ok {
+			more, err := Schema(members)
+			if err != nil {
+				return nil, err
+			}
+			columns = append(columns, more...)
+			continue
+		}
+
+		column := Column{Name: info.Name, Field: field}
+		switch fields.FieldTypes[field].(type) {
+		case uint8:
+			column.Type = Uint8
+		case uint16:
+			column.Type = Uint16
+		case uint32:
+			column.Type = Uint32
+		case uint64:
+			column.Type = Uint64
+		case float64:
+			column.Type = Float64
+		case time.Time:
+			column.Type = Timestamp
+		case net.IP:
+			column.Type, column.Size = FixedSizeBinary, 16
+		case net.HardwareAddr:
+			column.Type, column.Size = FixedSizeBinary, 6
+		case fields.Mpls:
+			column.Type, column.Size = FixedSizeBinary, 4*len(fields.Mpls{})
+		case string:
+			column.Type = String
+		default:
+			return nil, fmt.Errorf("%w: %d", errors.ErrUnknownFld, field)
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// expanded lists the fields whose values are stored in the columns of other fields.
+var expanded = map[int][]int{
+	fields.IngressAcl: {fields.IngressAclId, fields.IngressAceId, fields.IngressXaceId},
+	fields.EgressAcl:  {fields.EgressAclId, fields.EgressAceId, fields.EgressXaceId},
+	fields.Brec1: {fields.First, fields.Last, fields.SrcAddr, fields.DstAddr, fields.Prot,
+		fields.SrcPort, fields.DstPort, fields.Doctets, fields.Dpkts, fields.AggrFlows},
+}
+
+// Vector holds the values of one column of a batch. Only the slice matching
+// the type of the column is used. Valid reports for every row whether the field
+// was set in the record; the values of rows which are not valid are zero.
+type Vector struct {
+	Column  Column
+	Valid   []bool
+	Uints   []uint64  // Uint8, Uint16, Uint32 and Uint64 columns.
+	Floats  []float64 // Float64 columns.
+	Millis  []int64   // Timestamp columns.
+	Bytes   []byte    // FixedSizeBinary columns, Column.Size bytes per row.
+	Strings []string  // String columns.
+}
+
+// Batch is a set of rows stored column by column.
+type Batch struct {
+	Rows    int
+	Vectors []Vector
+}
+
+// Builder appends records to a batch.
+type Builder struct {
+	columns   []Column
+	batchSize int
+	batch     *Batch
+	ip        [16]byte
+	mac       [6]byte
+}
+
+// NewBuilder returns a builder of batches with the given columns and at most
+// batchSize rows, or DefaultBatchSize rows if batchSize is not positive.
+func NewBuilder(columns []Column, batchSize int) *Builder {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	b := &Builder{columns: append([]Column(nil), columns...), batchSize: batchSize}
+	b.reset()
+	return b
+}
+
+func (b *Builder) reset() {
+	b.batch = &Batch{Vectors: make([]Vector, len(b.columns))}
+	for i, column := range b.columns {
+		v := &b.batch.Vectors[i]
+		v.Column = column
+		v.Valid = make([]bool, 0, b.batchSize)
+		switch column.Type {
+		case Float64:
+			v.Floats = make([]float64, 0, b.batchSize)
+		case Timestamp:
+			v.Millis = make([]int64, 0, b.batchSize)
+		case FixedSizeBinary:
+			v.Bytes = make([]byte, 0, b.batchSize*column.Size)
+		case String:
+			v.Strings = make([]string, 0, b.batchSize)
+		default:
+			v.Uints = make([]uint64, 0, b.batchSize)
+		}
+	}
+}
+
+// Len returns the number of rows in the current batch.
+func (b *Builder) Len() int {
+	return b.batch.Rows
+}
+
+// Full reports whether the current batch has reached the batch size.
+func (b *Builder) Full() bool {
+	return b.batch.Rows >= b.batchSize
+}
+
+// Append adds the record as a new row of the current batch.
+func (b *Builder) Append(r *record.Record) error {
+	if !r.Allocated() {
+		return errors.ErrRecordNotAllocated
+	}
+	for i := range b.batch.Vectors {
+		if err := b.appendValue(&b.batch.Vectors[i], r); err != nil {
+			// Drop the values already appended for this row.
+			for j := range b.batch.Vectors[:i] {
+				truncate(&b.batch.Vectors[j], b.batch.Rows)
+			}
+			return err
+		}
+	}
+	b.batch.Rows++
+	return nil
+}
+
+func (b *Builder) appendValue(v *Vector, r *record.Record) error {
+	var err error
+	field := v.Column.Field
+	switch v.Column.Type {
+	case Uint8:
+		var x uint8
+		x, err = r.GetUint8(field)
+		v.Uints = append(v.Uints, uint64(x))
+	case Uint16:
+		var x uint16
+		x, err = r.GetUint16(field)
+		v.Uints = append(v.Uints, uint64(x))
+	case Uint32:
+		var x uint32
+		x, err = r.GetUint32(field)
+		v.Uints = append(v.Uints, uint64(x))
+	case Uint64:
+		var x uint64
+		x, err = r.GetUint64(field)
+		v.Uints = append(v.Uints, x)
+	case Float64:
+		var x float64
+		x, err = r.GetFloat64(field)
+		v.Floats = append(v.Floats, x)
+	case Timestamp:
+		var t time.Time
+		t, err = r.GetTime(field)
+		var ms int64
+		if err == nil {
+			ms = t.UnixMilli()
+		}
+		v.Millis = append(v.Millis, ms)
+	case FixedSizeBinary:
+		v.Bytes, err = b.appendBinary(v.Bytes, v.Column, r)
+	case String:
+		var s string
+		s, err = record.Get[string](r, field)
+		v.Strings = append(v.Strings, s)
+	}
+
+	if err == errors.ErrNotSet {
+		truncate(v, len(v.Valid))
+		appendZero(v)
+		v.Valid = append(v.Valid, false)
+		return nil
+	} else if err != nil {
+		truncate(v, len(v.Valid))
+		return err
+	}
+	v.Valid = append(v.Valid, true)
+	return nil
+}
+
+func (b *Builder) appendBinary(dst []byte, column Column, r *record.Record) ([]byte, error) {
+	switch column.Size {
+	case 16:
+		addr, err := r.GetAddr(column.Field)
+		if err != nil {
+			return dst, err
+		}
+		b.ip = addr.As16()
+		return append(dst, b.ip[:]...), nil
+	case 6:
+		if err := r.GetMacInto(column.Field, &b.mac); err != nil {
+			return dst, err
+		}
+		return append(dst, b.mac[:]...), nil
+	default:
+		mpls, err := record.Get[fields.Mpls](r, column.Field)
+		if err != nil {
+			return dst, err
+		}
+		for _, entry := range mpls {
+			dst = binary.BigEndian.AppendUint32(dst, entry)
+		}
+		return dst, nil
+	}
+}
+
+// truncate shortens the vector to the given number of rows.
+func truncate(v *Vector, rows int) {
+	v.Valid = v.Valid[:min(len(v.Valid), rows)]
+	switch v.Column.Type {
+	case Float64:
+		v.Floats = v.Floats[:min(len(v.Floats), rows)]
+	case Timestamp:
+		v.Millis = v.Millis[:min(len(v.Millis), rows)]
+	case FixedSizeBinary:
+		v.Bytes = v.Bytes[:min(len(v.Bytes), rows*v.Column.Size)]
+	case String:
+		v.Strings = v.Strings[:min(len(v.Strings), rows)]
+	default:
+		v.Uints = v.Uints[:min(len(v.Uints), rows)]
+	}
+}
+
+// appendZero appends a zero value to the vector.
+func appendZero(v *Vector) {
+	switch v.Column.Type {
+	case Float64:
+		v.Floats = append(v.Floats, 0)
+	case Timestamp:
+		v.Millis = append(v.Millis, 0)
+	case FixedSizeBinary:
+		v.Bytes = append(v.Bytes, make([]byte, v.Column.Size)...)
+	case String:
+		v.Strings = append(v.Strings, "")
+	default:
+		v.Uints = append(v.Uints, 0)
+	}
+}
+
+// Flush returns the current batch and starts a new one.
+// It returns nil if the current batch is empty.
+func (b *Builder) Flush() *Batch {
+	if b.batch.Rows == 0 {
+		return nil
+	}
+	batch := b.batch
+	b.reset()
+	return batch
+}
+
+// Options configure Export.
+type Options struct {
+	Fields    []int // Fields stored in the columns, see Schema.
+	BatchSize int   // Rows per batch and Parquet row group, DefaultBatchSize if not positive.
+
+	// FlushInterval is the longest time a record waits in a batch which is not
+	// full. It is needed for streams which do not end, like the records of a
+	// blocking ring.Ring, whose batches are otherwise written only when full.
+	// If 0, batches are written only when full and at the end of the stream.
+	FlushInterval time.Duration
+}
+
+// Export appends every record of the stream, e.g. file.File.Records or
+// ring.Ring.Records, to batches of the given fields and passes each batch to
+// write as soon as it is full, or once its first record is older than the
+// flush interval. The last batch is written at the end of the stream. Calls
+// of write do not overlap, but batches flushed by the interval are written
+// from another goroutine.
+//
+// Records of the stream with a weak error are skipped, other errors and errors
+// returned by write stop the export. The context is checked after every record.
+// Returns the number of records exported.
+func Export(ctx context.Context, records iter.Seq2[*record.Record, error], opts Options, write func(*Batch) error) (int, error) {
+	columns, err := Schema(opts.Fields)
+	if err != nil {
+		return 0, err
+	}
+	b := NewBuilder(columns, opts.BatchSize)
+
+	var (
+		mu       sync.Mutex
+		timer    *time.Timer
+		batchID  int   // Incremented with every written batch.
+		timedErr error // Error of a write of a batch flushed by the interval.
+	)
+	// flush writes the current batch, with mu held.
+	flush := func() error {
+		if timer != nil {
+			timer.Stop()
+			timer = nil
+		}
+		batchID++
+		if batch := b.Flush(); batch != nil {
+			return write(batch)
+		}
+		return nil
+	}
+	add := func(r *record.Record) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if timedErr != nil {
+			return timedErr
+		}
+		if err := b.Append(r); err != nil {
+			return err
+		}
+		if b.Full() {
+			return flush()
+		}
+		if b.Len() == 1 && opts.FlushInterval > 0 {
+			id := batchID
+			timer = time.AfterFunc(opts.FlushInterval, func() {
+				mu.Lock()
+				defer mu.Unlock()
+				if id == batchID && timedErr == nil {
+					timedErr = flush()
+				}
+			})
+		}
+		return nil
+	}
+
+	n := 0
+	for r, err := range records {
+		if errors.IsWeak(err) {
+			continue
+		} else if err == nil {
+			err = add(r)
+		}
+		if err == nil {
+			n++
+			err = ctx.Err()
+		}
+		if err != nil {
+			mu.Lock()
+			if timer != nil {
+				timer.Stop()
+			}
+			mu.Unlock()
+			return n, err
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if timedErr != nil {
+		return n, timedErr
+	}
+	return n, flush()
+}
+
+// ExportArrow exports the stream like Export and writes the batches to w in
+// the Arrow IPC streaming format, see ArrowWriter. The end of the stream is
+// written also when the export fails.
+func ExportArrow(ctx context.Context, records iter.Seq2[*record.Record, error], w io.Writer, opts Options) (int, error) {
+	columns, err := Schema(opts.Fields)
+	if err != nil {
+		return 0, err
+	}
+	aw, err := NewArrowWriter(w, columns)
+	if err != nil {
+		return 0, err
+	}
+	n, err := Export(ctx, records, opts, aw.WriteBatch)
+	if cerr := aw.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
@@ -0,0 +1,531 @@
+package columnar_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"iter"
+	"math"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/matejnesuta/libnf-go/api/columnar"
+	"github.com/matejnesuta/libnf-go/api/errors"
+	"github.com/matejnesuta/libnf-go/api/fields"
+	"github.com/matejnesuta/libnf-go/api/file"
+	"github.com/matejnesuta/libnf-go/api/record"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchema(t *testing.T) {
+	columns, err := columnar.Schema([]int{fields.First, fields.SrcAddr, fields.InSrcMac, fields.DstPort, fields.CalcBps, fields.Username, fields.IngressAcl})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []columnar.Column{
+		{Name: "first", Field: fields.First, Type: columnar.Timestamp},
+		{Name: "srcip", Field: fields.SrcAddr, Type: columnar.FixedSizeBinary, Size: 16},
+		{Name: "insrcmac", Field: fields.InSrcMac, Type: columnar.FixedSizeBinary, Size: 6},
+		{Name: "dstport", Field: fields.DstPort, Type: columnar.Uint16},
+		{Name: "bps", Field: fields.CalcBps, Type: columnar.Float64},
+		{Name: "username", Field: fields.Username, Type: columnar.String},
+		{Name: "iacl", Field: fields.IngressAclId, Type: columnar.Uint32},
+		{Name: "iace", Field: fields.IngressAceId, Type: columnar.Uint32},
+		{Name: "ixace", Field: fields.IngressXaceId, Type: columnar.Uint32},
+	}, columns)
+
+	columns, err = columnar.Schema([]int{fields.Brec1})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 10, len(columns))
+
+	_, err = columnar.Schema([]int{fields.PairPort})
+	assert.ErrorIs(t, err, errors.ErrUnknownFld)
+	_, err = columnar.Schema([]int{-1})
+	assert.ErrorIs(t, err, errors.ErrUnknownFld)
+}
+
+func TestExportFile(t *testing.T) {
+	var ptr file.File
+	err := ptr.OpenRead("../testfiles/nfcapd.201705281555", false, false)
+	assert.Equal(t, nil, err)
+	defer ptr.Close()
+
+	var batches []*columnar.Batch
+	opts := columnar.Options{Fields: []int{fields.First, fields.SrcAddr, fields.Doctets}, BatchSize: 1000}
+	n, err := columnar.Export(context.Background(), ptr.Records(), opts, func(b *columnar.Batch) error {
+		batches = append(batches, b)
+		return nil
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2035, n)
+	assert.Equal(t, 3, len(batches))
+	assert.Equal(t, 1000, batches[0].Rows)
+	assert.Equal(t, 35, batches[2].Rows)
+	for _, b := range batches {
+		assert.Equal(t, b.Rows, len(b.Vectors[0].Millis))
+		assert.Equal(t, 16*b.Rows, len(b.Vectors[1].Bytes))
+		assert.Equal(t, b.Rows, len(b.Vectors[2].Uints))
+	}
+}
+
+func TestBuilderValues(t *testing.T) {
+	rec, err := record.NewRecord()
+	assert.Equal(t, nil, err)
+	defer rec.Free()
+	assert.Equal(t, nil, record.SetField(&rec, fields.First, time.UnixMilli(1496000000123)))
+	assert.Equal(t, nil, record.SetField(&rec, fields.SrcAddr, netip.MustParseAddr("192.168.0.1")))
+
+	columns, err := columnar.Schema([]int{fields.First, fields.SrcAddr})
+	assert.Equal(t, nil, err)
+	b := columnar.NewBuilder(columns, 2)
+	assert.Equal(t, nil, b.Append(&rec))
+	assert.Equal(t, false, b.Full())
+	assert.Equal(t, nil, b.Append(&rec))
+	assert.Equal(t, true, b.Full())
+
+	batch := b.Flush()
+	assert.Equal(t, 2, batch.Rows)
+	assert.Equal(t, []int64{1496000000123, 1496000000123}, batch.Vectors[0].Millis)
+	mapped := netip.MustParseAddr("::ffff:192.168.0.1").As16()
+	assert.Equal(t, mapped[:], batch.Vectors[1].Bytes[:16])
+	assert.Equal(t, []bool{true, true}, batch.Vectors[0].Valid)
+	assert.Equal(t, 0, b.Len())
+	assert.Equal(t, (*columnar.Batch)(nil), b.Flush())
+
+	var unallocated record.Record
+	assert.Equal(t, errors.ErrRecordNotAllocated, b.Append(&unallocated))
+}
+
+func TestExportFlushInterval(t *testing.T) {
+	rec, err := record.NewRecord()
+	assert.Equal(t, nil, err)
+	defer rec.Free()
+
+	// The stream stays quiet after the first record, like an idle ring.
+	written := make(chan int, 2)
+	records := iter.Seq2[*record.Record, error](func(yield func(*record.Record, error) bool) {
+		if !yield(&rec, nil) {
+			return
+		}
+		select {
+		case <-written:
+		case <-time.After(time.Second):
+			t.Error("the batch was not flushed")
+		}
+	})
+	opts := columnar.Options{Fields: []int{fields.SrcPort}, FlushInterval: 20 * time.Millisecond}
+	batches := 0
+	n, err := columnar.Export(context.Background(), records, opts, func(b *columnar.Batch) error {
+		batches++
+		written <- b.Rows
+		return nil
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 1, batches)
+}
+
+// arrowBatch returns a batch of every column type, whose second row is null.
+func arrowBatch(t *testing.T) ([]columnar.Column, *columnar.Batch) {
+	columns, err := columnar.Schema([]int{fields.First, fields.SrcAddr, fields.InSrcMac, fields.Prot,
+		fields.DstPort, fields.SrcAS, fields.Doctets, fields.CalcBps, fields.Username})
+	assert.Equal(t, nil, err)
+	b := &columnar.Batch{Rows: 3}
+	for _, column := range columns {
+		v := columnar.Vector{Column: column, Valid: []bool{true, false, true}}
+		switch column.Type {
+		case columnar.Timestamp:
+			v.Millis = []int64{1496001019000, 0, 1496001024123}
+		case columnar.FixedSizeBinary:
+			v.Bytes = make([]byte, 3*column.Size)
+			v.Bytes[column.Size-1] = 1
+		case columnar.Float64:
+			v.Floats = []float64{1.5, 0, 2.5}
+		case columnar.String:
+			v.Strings = []string{"alice", "", "bob"}
+		default:
+			v.Uints = []uint64{1, 0, 200}
+		}
+		b.Vectors = append(b.Vectors, v)
+	}
+	return columns, b
+}
+
+// The expected files were read back with the Arrow Go library.
+func TestArrowWriter(t *testing.T) {
+	columns, batch := arrowBatch(t)
+	for name, create := range map[string]func(w *bytes.Buffer) (*columnar.ArrowWriter, error){
+		"../testfiles/columns.arrows": func(w *bytes.Buffer) (*columnar.ArrowWriter, error) { return columnar.NewArrowWriter(w, columns) },
+		"../testfiles/columns.arrow":  func(w *bytes.Buffer) (*columnar.ArrowWriter, error) { return columnar.NewArrowFileWriter(w, columns) },
+	} {
+		var buf bytes.Buffer
+		w, err := create(&buf)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, nil, w.WriteBatch(batch))
+		assert.Equal(t, nil, w.WriteBatch(batch))
+		assert.Equal(t, nil, w.Close())
+
+		expected, err := os.ReadFile(name)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, expected, buf.Bytes(), name)
+	}
+}
+
+func TestArrowWriterReadBack(t *testing.T) {
+	columns, batch := arrowBatch(t)
+	for name, test := range map[string]struct {
+		create func(w *bytes.Buffer) (*columnar.ArrowWriter, error)
+		decode func(t *testing.T, data []byte, columns []columnar.Column) []*columnar.Batch
+	}{
+		"stream": {func(w *bytes.Buffer) (*columnar.ArrowWriter, error) { return columnar.NewArrowWriter(w, columns) }, decodeArrowStream},
+		"file":   {func(w *bytes.Buffer) (*columnar.ArrowWriter, error) { return columnar.NewArrowFileWriter(w, columns) }, decodeArrowFile},
+	} {
+		var buf bytes.Buffer
+		w, err := test.create(&buf)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, nil, w.WriteBatch(batch))
+		assert.Equal(t, nil, w.WriteBatch(batch))
+		assert.Equal(t, nil, w.Close())
+		assert.Equal(t, []*columnar.Batch{batch, batch}, test.decode(t, buf.Bytes(), columns), name)
+	}
+}
+
+func TestParquetWriter(t *testing.T) {
+	columns, batch := arrowBatch(t)
+	var buf bytes.Buffer
+	w, err := columnar.NewParquetWriter(&buf, columns)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, w.WriteBatch(batch))
+	assert.Equal(t, nil, w.WriteBatch(batch))
+	assert.Equal(t, nil, w.Close())
+	assert.Equal(t, []*columnar.Batch{batch, batch}, decodeParquet(t, buf.Bytes(), columns))
+
+	assert.NotNil(t, w.WriteBatch(batch))
+	w, err = columnar.NewParquetWriter(&buf, columns[1:])
+	assert.Equal(t, nil, err)
+	assert.NotNil(t, w.WriteBatch(batch))
+}
+
+func TestExportReadBack(t *testing.T) {
+	opts := columnar.Options{Fields: []int{fields.First, fields.SrcAddr, fields.Prot, fields.Doctets}, BatchSize: 1000}
+	columns, err := columnar.Schema(opts.Fields)
+	assert.Equal(t, nil, err)
+
+	// The values of the records, column by column.
+	expected := make([]columnar.Vector, len(columns))
+	var ptr file.File
+	err = ptr.OpenRead("../testfiles/nfcapd.201705281555", false, false)
+	assert.Equal(t, nil, err)
+	for rec, err := range ptr.Records() {
+		assert.Equal(t, nil, err)
+		first, _ := rec.GetTime(fields.First)
+		expected[0].Millis = append(expected[0].Millis, first.UnixMilli())
+		addr, _ := rec.GetAddr(fields.SrcAddr)
+		ip := addr.As16()
+		expected[1].Bytes = append(expected[1].Bytes, ip[:]...)
+		prot, _ := rec.GetUint8(fields.Prot)
+		expected[2].Uints = append(expected[2].Uints, uint64(prot))
+		bytes, _ := rec.GetUint64(fields.Doctets)
+		expected[3].Uints = append(expected[3].Uints, bytes)
+	}
+	ptr.Close()
+
+	for name, test := range map[string]struct {
+		export func(f *file.File, w io.Writer) (int, error)
+		decode func(t *testing.T, data []byte, columns []columnar.Column) []*columnar.Batch
+	}{
+		"arrow": {func(f *file.File, w io.Writer) (int, error) {
+			return columnar.ExportArrow(context.Background(), f.Records(), w, opts)
+		}, decodeArrowStream},
+		"parquet": {func(f *file.File, w io.Writer) (int, error) {
+			return columnar.ExportParquet(context.Background(), f.Records(), w, opts)
+		}, decodeParquet},
+	} {
+		err := ptr.OpenRead("../testfiles/nfcapd.201705281555", false, false)
+		assert.Equal(t, nil, err)
+		var buf bytes.Buffer
+		n, err := test.export(&ptr, &buf)
+		ptr.Close()
+		assert.Equal(t, nil, err)
+		assert.Equal(t, 2035, n)
+
+		batches := test.decode(t, buf.Bytes(), columns)
+		assert.Equal(t, 3, len(batches), name)
+		got := make([]columnar.Vector, len(columns))
+		for _, b := range batches {
+			for i, v := range b.Vectors {
+				got[i].Millis = append(got[i].Millis, v.Millis...)
+				got[i].Bytes = append(got[i].Bytes, v.Bytes...)
+				got[i].Uints = append(got[i].Uints, v.Uints...)
+			}
+		}
+		assert.Equal(t, expected, got, name)
+	}
+}
+
+func TestArrowWriterMismatchingBatch(t *testing.T) {
+	columns, batch := arrowBatch(t)
+	var buf bytes.Buffer
+	w, err := columnar.NewArrowWriter(&buf, columns[1:])
+	assert.Equal(t, nil, err)
+	assert.NotNil(t, w.WriteBatch(batch))
+	assert.Equal(t, nil, w.Close())
+	assert.NotNil(t, w.WriteBatch(batch))
+}
+
+// A minimal reader of the Arrow IPC and Parquet formats written by the
+// package, which decodes the batches written by the writers.
+
+func u16(buf []byte, pos int) int { return int(binary.LittleEndian.Uint16(buf[pos:])) }
+func u32(buf []byte, pos int) int { return int(binary.LittleEndian.Uint32(buf[pos:])) }
+func u64(buf []byte, pos int) int { return int(binary.LittleEndian.Uint64(buf[pos:])) }
+
+// fbField returns the position of the field of the flatbuffer table at pos.
+func fbField(buf []byte, table, slot int) (int, bool) {
+	vtable := table - int(int32(binary.LittleEndian.Uint32(buf[table:])))
+	if 4+2*slot >= u16(buf, vtable) || u16(buf, vtable+4+2*slot) == 0 {
+		return 0, false
+	}
+	return table + u16(buf, vtable+4+2*slot), true
+}
+
+// fbDeref returns the position of the object referred to by the offset at pos.
+func fbDeref(buf []byte, pos int) int {
+	return pos + u32(buf, pos)
+}
+
+// fbRef returns the position of the object referred to by the offset field.
+func fbRef(buf []byte, table, slot int) int {
+	pos, _ := fbField(buf, table, slot)
+	return fbDeref(buf, pos)
+}
+
+// decodeArrowMessage decodes the message at the start of data. It returns the
+// batch of a record batch message, nil for other messages, and the length of
+// the message, which is 0 at the end of the stream.
+func decodeArrowMessage(t *testing.T, data []byte, columns []columnar.Column) (*columnar.Batch, int) {
+	assert.Equal(t, 0xffffffff, u32(data, 0))
+	metadata := data[8 : 8+u32(data, 4)]
+	if len(metadata) == 0 {
+		return nil, 0
+	}
+	message := u32(metadata, 0)
+	pos, _ := fbField(metadata, message, 3)
+	body := data[8+len(metadata) : 8+len(metadata)+u64(metadata, pos)]
+	length := 8 + len(metadata) + len(body)
+	pos, _ = fbField(metadata, message, 1)
+	header := fbRef(metadata, message, 2)
+	if metadata[pos] == 1 {
+		fieldList := fbRef(metadata, header, 1)
+		assert.Equal(t, len(columns), u32(metadata, fieldList))
+		for i, column := range columns {
+			name := fbRef(metadata, fbDeref(metadata, fieldList+4+4*i), 0)
+			assert.Equal(t, column.Name, string(metadata[name+4:name+4+u32(metadata, name)]))
+		}
+		return nil, length
+	}
+
+	nodes, buffers := fbRef(metadata, header, 1)+4, fbRef(metadata, header, 2)+4
+	buffer := func() []byte {
+		offset, size := u64(metadata, buffers), u64(metadata, buffers+8)
+		buffers += 16
+		return body[offset : offset+size]
+	}
+	batch := &columnar.Batch{Rows: u64(metadata, nodes)}
+	for _, column := range columns {
+		v := columnar.Vector{Column: column}
+		validity := buffer()
+		for row := range batch.Rows {
+			v.Valid = append(v.Valid, len(validity) == 0 || validity[row/8]&(1<<(row%8)) != 0)
+		}
+		data := buffer()
+		for row := range batch.Rows {
+			switch column.Type {
+			case columnar.Uint8:
+				v.Uints = append(v.Uints, uint64(data[row]))
+			case columnar.Uint16:
+				v.Uints = append(v.Uints, uint64(u16(data, 2*row)))
+			case columnar.Uint32:
+				v.Uints = append(v.Uints, uint64(u32(data, 4*row)))
+			case columnar.Uint64:
+				v.Uints = append(v.Uints, binary.LittleEndian.Uint64(data[8*row:]))
+			case columnar.Float64:
+				v.Floats = append(v.Floats, math.Float64frombits(binary.LittleEndian.Uint64(data[8*row:])))
+			case columnar.Timestamp:
+				v.Millis = append(v.Millis, int64(u64(data, 8*row)))
+			case columnar.FixedSizeBinary:
+				v.Bytes = append(v.Bytes, data[row*column.Size:(row+1)*column.Size]...)
+			}
+		}
+		if column.Type == columnar.String {
+			chars := buffer()
+			for row := range batch.Rows {
+				v.Strings = append(v.Strings, string(chars[u32(data, 4*row):u32(data, 4*row+4)]))
+			}
+		}
+		batch.Vectors = append(batch.Vectors, v)
+		nodes += 16
+	}
+	return batch, length
+}
+
+// decodeArrowStream returns the batches of an Arrow IPC stream.
+func decodeArrowStream(t *testing.T, data []byte, columns []columnar.Column) []*columnar.Batch {
+	var batches []*columnar.Batch
+	for {
+		batch, n := decodeArrowMessage(t, data, columns)
+		if n == 0 {
+			return batches
+		}
+		if batch != nil {
+			batches = append(batches, batch)
+		}
+		data = data[n:]
+	}
+}
+
+// decodeArrowFile returns the batches listed in the footer of an Arrow IPC file.
+func decodeArrowFile(t *testing.T, data []byte, columns []columnar.Column) []*columnar.Batch {
+	assert.Equal(t, "ARROW1", string(data[:6]))
+	assert.Equal(t, "ARROW1", string(data[len(data)-6:]))
+	footer := data[len(data)-10-u32(data, len(data)-10) : len(data)-10]
+	blocks := fbRef(footer, u32(footer, 0), 3)
+	var batches []*columnar.Batch
+	for i := range u32(footer, blocks) {
+		batch, _ := decodeArrowMessage(t, data[u64(footer, blocks+4+24*i):], columns)
+		batches = append(batches, batch)
+	}
+	// The stream after the header holds the same batches.
+	assert.Equal(t, batches, decodeArrowStream(t, data[8:], columns))
+	return batches
+}
+
+// thriftValue decodes a value of the Thrift compact protocol from the start of
+// data, structs as a map of their fields. It returns the value and its length.
+func thriftValue(data []byte, typ byte) (any, int) {
+	switch typ {
+	case 1, 2:
+		return typ == 1, 0
+	case 3:
+		return int64(int8(data[0])), 1
+	case 5, 6:
+		v, n := binary.Varint(data)
+		return v, n
+	case 8:
+		size, n := binary.Uvarint(data)
+		return string(data[n : n+int(size)]), n + int(size)
+	case 9:
+		size, elem, n := int(data[0]>>4), data[0]&0xf, 1
+		if size == 15 {
+			s, m := binary.Uvarint(data[1:])
+			size, n = int(s), 1+m
+		}
+		list := []any{}
+		for range size {
+			v, m := thriftValue(data[n:], elem)
+			list, n = append(list, v), n+m
+		}
+		return list, n
+	case 12:
+		fields, n, id := map[int16]any{}, 0, int16(0)
+		for data[n] != 0 {
+			header := data[n]
+			n++
+			if header>>4 != 0 {
+				id += int16(header >> 4)
+			} else {
+				v, m := binary.Varint(data[n:])
+				id, n = int16(v), n+m
+			}
+			v, m := thriftValue(data[n:], header&0xf)
+			fields[id], n = v, n+m
+		}
+		return fields, n + 1
+	}
+	panic(fmt.Sprintf("unknown thrift type %d", typ))
+}
+
+// decodeParquet returns the row groups of a Parquet file as batches.
+func decodeParquet(t *testing.T, data []byte, columns []columnar.Column) []*columnar.Batch {
+	assert.Equal(t, "PAR1", string(data[:4]))
+	assert.Equal(t, "PAR1", string(data[len(data)-4:]))
+	footer, _ := thriftValue(data[len(data)-8-u32(data, len(data)-8):], 12)
+	meta := footer.(map[int16]any)
+	schema := meta[2].([]any)
+	assert.Equal(t, len(columns)+1, len(schema))
+	for i, column := range columns {
+		assert.Equal(t, column.Name, schema[i+1].(map[int16]any)[4])
+	}
+
+	var batches []*columnar.Batch
+	rows := int64(0)
+	for _, group := range meta[4].([]any) {
+		group := group.(map[int16]any)
+		batch := &columnar.Batch{Rows: int(group[3].(int64))}
+		rows += group[3].(int64)
+		for i, chunk := range group[1].([]any) {
+			column := columns[i]
+			pos := int(chunk.(map[int16]any)[3].(map[int16]any)[9].(int64))
+			header, n := thriftValue(data[pos:], 12)
+			page := data[pos+n : pos+n+int(header.(map[int16]any)[3].(int64))]
+
+			// The definition levels are runs of equal levels.
+			v := columnar.Vector{Column: column}
+			levels := page[4 : 4+u32(page, 0)]
+			for len(levels) > 0 {
+				run, m := binary.Uvarint(levels)
+				assert.Equal(t, uint64(0), run&1)
+				for range run >> 1 {
+					v.Valid = append(v.Valid, levels[m] == 1)
+				}
+				levels = levels[m+1:]
+			}
+			values := page[4+u32(page, 0):]
+			for _, valid := range v.Valid {
+				if !valid {
+					appendZeroValue(&v)
+					continue
+				}
+				switch column.Type {
+				case columnar.Uint8, columnar.Uint16, columnar.Uint32:
+					v.Uints, values = append(v.Uints, uint64(u32(values, 0))), values[4:]
+				case columnar.Uint64:
+					v.Uints, values = append(v.Uints, binary.LittleEndian.Uint64(values)), values[8:]
+				case columnar.Float64:
+					v.Floats, values = append(v.Floats, math.Float64frombits(binary.LittleEndian.Uint64(values))), values[8:]
+				case columnar.Timestamp:
+					v.Millis, values = append(v.Millis, int64(u64(values, 0))), values[8:]
+				case columnar.FixedSizeBinary:
+					v.Bytes, values = append(v.Bytes, values[:column.Size]...), values[column.Size:]
+				case columnar.String:
+					size := u32(values, 0)
+					v.Strings, values = append(v.Strings, string(values[4:4+size])), values[4+size:]
+				}
+			}
+			assert.Equal(t, 0, len(values))
+			batch.Vectors = append(batch.Vectors, v)
+		}
+		batches = append(batches, batch)
+	}
+	assert.Equal(t, meta[3], rows)
+	return batches
+}
+
+// appendZeroValue appends the value of a null row.
+func appendZeroValue(v *columnar.Vector) {
+	switch v.Column.Type {
+	case columnar.Float64:
+		v.Floats = append(v.Floats, 0)
+	case columnar.Timestamp:
+		v.Millis = append(v.Millis, 0)
+	case columnar.FixedSizeBinary:
+		v.Bytes = append(v.Bytes, make([]byte, v.Column.Size)...)
+	case columnar.String:
+		v.Strings = append(v.Strings, "")
+	default:
+		v.Uints = append(v.Uints, 0)
+	}
+}
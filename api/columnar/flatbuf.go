@@ -0,0 +1,156 @@
+package columnar
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// A minimal FlatBuffers encoder for the metadata of the Arrow IPC format.
+//
+// Objects are written front to back: a table is followed by the objects it
+// refers to, so every offset points forward as the format requires. Scalars
+// are aligned to their size relative to the start of the buffer.
+
+// fbScalar is an inline scalar value of a table.
+type fbScalar struct {
+	size int // 1, 2, 4 or 8 bytes.
+	bits uint64
+}
+
+func fbBool(v bool) fbScalar {
+	if v {
+		return fbScalar{1, 1}
+	}
+	return fbScalar{1, 0}
+}
+func fbUint8(v uint8) fbScalar  { return fbScalar{1, uint64(v)} }
+func fbInt16(v int16) fbScalar  { return fbScalar{2, uint64(uint16(v))} }
+func fbInt32(v int32) fbScalar  { return fbScalar{4, uint64(uint32(v))} }
+func fbInt64(v int64) fbScalar  { return fbScalar{8, uint64(v)} }
+func fbString(s string) *string { return &s }
+
+// fbTable holds the fields of a table by their slot, nil fields are absent.
+// A field is an fbScalar or an offset to a *fbTable, *string, []*fbTable or fbStructs.
+type fbTable []any
+
+// fbStructs is a vector of structs of the given size, stored inline.
+type fbStructs struct {
+	size int // Size of a struct, a multiple of 8 bytes.
+	data []byte
+}
+
+type fbBuilder struct {
+	buf []byte
+}
+
+// finish returns a buffer with the root table, padded to a multiple of 8 bytes.
+func finish(root fbTable) ([]byte, error) {
+	b := fbBuilder{buf: make([]byte, 4, 256)}
+	pos, err := b.object(root)
+	if err != nil {
+		return nil, err
+	}
+	binary.LittleEndian.PutUint32(b.buf, uint32(pos))
+	b.align(8)
+	return b.buf, nil
+}
+
+func (b *fbBuilder) align(n int) {
+	for len(b.buf)%n != 0 {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+// offset points the offset at pos to the object written next.
+func (b *fbBuilder) offset(pos int, object any) error {
+	target, err := b.object(object)
+	if err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(b.buf[pos:], uint32(target-pos))
+	return nil
+}
+
+// object writes the object and returns its position.
+func (b *fbBuilder) object(object any) (int, error) {
+	switch v := object.(type) {
+	case fbTable:
+		return b.table(v)
+	case *string:
+		b.align(4)
+		pos := len(b.buf)
+		b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(*v)))
+		b.buf = append(append(b.buf, *v...), 0)
+		return pos, nil
+	case []fbTable:
+		b.align(4)
+		pos := len(b.buf)
+		b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(v)))
+		b.buf = append(b.buf, make([]byte, 4*len(v))...)
+		for i, t := range v {
+			if err := b.offset(pos+4+4*i, t); err != nil {
+				return 0, err
+			}
+		}
+		return pos, nil
+	case fbStructs:
+		// The structs hold 8-byte values and follow the 4-byte length.
+		b.align(8)
+		b.buf = append(b.buf, 0, 0, 0, 0)
+		pos := len(b.buf)
+		b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(v.data)/v.size))
+		b.buf = append(b.buf, v.data...)
+		return pos, nil
+	}
+	return 0, fmt.Errorf("columnar: unknown flatbuffer object %T", object)
+}
+
+func (b *fbBuilder) table(t fbTable) (int, error) {
+	// The vtable holds the offsets of the fields within the table, which starts
+	// with the signed offset back to the vtable.
+	b.align(2)
+	vtable := len(b.buf)
+	b.buf = append(b.buf, make([]byte, 4+2*len(t))...)
+	binary.LittleEndian.PutUint16(b.buf[vtable:], uint16(4+2*len(t)))
+
+	b.align(8)
+	pos := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(pos-vtable))
+	var refs []int // Positions of the offset fields.
+	for slot, field := range t {
+		if field == nil {
+			continue
+		}
+		s, scalar := field.(fbScalar)
+		if !scalar {
+			s.size = 4
+		}
+		b.align(s.size)
+		binary.LittleEndian.PutUint16(b.buf[vtable+4+2*slot:], uint16(len(b.buf)-pos))
+		if !scalar {
+			refs = append(refs, len(b.buf))
+		}
+		switch s.size {
+		case 1:
+			b.buf = append(b.buf, uint8(s.bits))
+		case 2:
+			b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(s.bits))
+		case 4:
+			b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(s.bits))
+		case 8:
+			b.buf = binary.LittleEndian.AppendUint64(b.buf, s.bits)
+		}
+	}
+	binary.LittleEndian.PutUint16(b.buf[vtable+2:], uint16(len(b.buf)-pos))
+
+	i := 0
+	for _, field := range t {
+		if _, scalar := field.(fbScalar); field != nil && !scalar {
+			if err := b.offset(refs[i], field); err != nil {
+				return 0, err
+			}
+			i++
+		}
+	}
+	return pos, nil
+}
@@ -0,0 +1,276 @@
+package columnar
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"iter"
+	"math"
+
+	"github.com/matejnesuta/libnf-go/api/record"
+)
+
+// Constants of the Parquet format, see the parquet.thrift file of the Parquet
+// format specification.
+const (
+	parquetInt32             = 1
+	parquetInt64             = 2
+	parquetDouble            = 5
+	parquetByteArray         = 6
+	parquetFixedLenByteArray = 7
+
+	parquetOptional = 1
+
+	parquetUTF8            = 0
+	parquetTimestampMillis = 9
+	parquetUint8           = 11
+	parquetUint16          = 12
+	parquetUint32          = 13
+	parquetUint64          = 14
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetUncompressed = 0
+	parquetDataPage     = 0
+)
+
+var parquetMagic = []byte("PAR1")
+
+// ParquetWriter writes batches to a Parquet file, one row group per batch.
+// Every column is optional, rows which are not valid are null. The values are
+// stored in a single data page per column chunk, with the plain encoding and
+// without compression.
+//
+// Columns are mapped to the Parquet types int32 and int64 annotated as unsigned
+// integers, double, int64 annotated as a timestamp in milliseconds adjusted to
+// UTC, fixed_len_byte_array and byte_array annotated as a string. The columns
+// of IP addresses hold 16 bytes, with IPv4 addresses mapped into IPv6.
+type ParquetWriter struct {
+	w         io.Writer
+	columns   []Column
+	offset    int64
+	rows      int64
+	rowGroups []tStruct
+	page      []byte // Data of the page being written.
+	closed    bool
+}
+
+// NewParquetWriter returns a writer of a Parquet file with the columns, and
+// writes the header of the file to w. The footer with the schema is written
+// by Close.
+func NewParquetWriter(w io.Writer, columns []Column) (*ParquetWriter, error) {
+	p := &ParquetWriter{w: w, columns: append([]Column(nil), columns...)}
+	for _, column := range columns {
+		if _, err := parquetSchema(column); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.write(parquetMagic); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// parquetType returns the physical type of the column.
+func parquetType(column Column) int32 {
+	switch column.Type {
+	case Uint8, Uint16, Uint32:
+		return parquetInt32
+	case Float64:
+		return parquetDouble
+	case FixedSizeBinary:
+		return parquetFixedLenByteArray
+	case String:
+		return parquetByteArray
+	}
+	return parquetInt64
+}
+
+// parquetSchema returns the schema element of the column.
+func parquetSchema(column Column) (tStruct, error) {
+	// type, type_length, repetition_type, name, converted_type, logicalType
+	switch column.Type {
+	case Uint8, Uint16, Uint32, Uint64:
+		converted := [...]int32{Uint8: parquetUint8, Uint16: parquetUint16, Uint32: parquetUint32, Uint64: parquetUint64}[column.Type]
+		// IntType: bitWidth, isSigned
+		logical := tStruct{{10, tStruct{{1, int8(8 * column.width())}, {2, false}}}}
+		return tStruct{{1, parquetType(column)}, {3, int32(parquetOptional)}, {4, column.Name}, {6, converted}, {10, logical}}, nil
+	case Float64:
+		return tStruct{{1, parquetType(column)}, {3, int32(parquetOptional)}, {4, column.Name}}, nil
+	case Timestamp:
+		// TimestampType: isAdjustedToUTC, unit MILLIS
+		logical := tStruct{{8, tStruct{{1, true}, {2, tStruct{{1, tStruct{}}}}}}}
+		return tStruct{{1, parquetType(column)}, {3, int32(parquetOptional)}, {4, column.Name}, {6, int32(parquetTimestampMillis)}, {10, logical}}, nil
+	case FixedSizeBinary:
+		return tStruct{{1, parquetType(column)}, {2, int32(column.Size)}, {3, int32(parquetOptional)}, {4, column.Name}}, nil
+	case String:
+		// StringType
+		logical := tStruct{{1, tStruct{}}}
+		return tStruct{{1, parquetType(column)}, {3, int32(parquetOptional)}, {4, column.Name}, {6, int32(parquetUTF8)}, {10, logical}}, nil
+	}
+	return nil, fmt.Errorf("columnar: column %q of unknown type %v", column.Name, column.Type)
+}
+
+func (p *ParquetWriter) write(parts ...[]byte) error {
+	for _, part := range parts {
+		n, err := p.w.Write(part)
+		p.offset += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteBatch writes the batch as one row group. The batch must hold the
+// columns the writer was created with.
+func (p *ParquetWriter) WriteBatch(b *Batch) error {
+	if p.closed {
+		return fmt.Errorf("columnar: write to a closed ParquetWriter")
+	}
+	if len(b.Vectors) != len(p.columns) {
+		return fmt.Errorf("columnar: batch of %d columns written to a schema of %d columns", len(b.Vectors), len(p.columns))
+	}
+	for i := range b.Vectors {
+		if b.Vectors[i].Column != p.columns[i] {
+			return fmt.Errorf("columnar: batch column %q written to schema column %q", b.Vectors[i].Column.Name, p.columns[i].Name)
+		}
+	}
+
+	var chunks []tStruct
+	var size int64
+	for i := range b.Vectors {
+		chunk, n, err := p.writeColumn(&b.Vectors[i], b.Rows)
+		if err != nil {
+			return err
+		}
+		chunks = append(chunks, chunk)
+		size += n
+	}
+	// columns, total_byte_size, num_rows
+	p.rowGroups = append(p.rowGroups, tStruct{{1, chunks}, {2, size}, {3, int64(b.Rows)}})
+	p.rows += int64(b.Rows)
+	return nil
+}
+
+// writeColumn writes the vector as a column chunk of a single data page, and
+// returns the chunk and its size.
+func (p *ParquetWriter) writeColumn(v *Vector, rows int) (tStruct, int64, error) {
+	// The definition levels of the optional column, 1 for valid rows, are
+	// prefixed by their length. There are no repetition levels.
+	data := binary.LittleEndian.AppendUint32(p.page[:0], 0)
+	data = appendLevels(data, v.Valid)
+	binary.LittleEndian.PutUint32(data, uint32(len(data)-4))
+
+	// Only the values of valid rows are stored.
+	for row, valid := range v.Valid {
+		if !valid {
+			continue
+		}
+		switch v.Column.Type {
+		case Uint8, Uint16, Uint32:
+			data = binary.LittleEndian.AppendUint32(data, uint32(v.Uints[row]))
+		case Uint64:
+			data = binary.LittleEndian.AppendUint64(data, v.Uints[row])
+		case Float64:
+			data = binary.LittleEndian.AppendUint64(data, math.Float64bits(v.Floats[row]))
+		case Timestamp:
+			data = binary.LittleEndian.AppendUint64(data, uint64(v.Millis[row]))
+		case FixedSizeBinary:
+			data = append(data, v.Bytes[row*v.Column.Size:(row+1)*v.Column.Size]...)
+		case String:
+			data = binary.LittleEndian.AppendUint32(data, uint32(len(v.Strings[row])))
+			data = append(data, v.Strings[row]...)
+		}
+	}
+	p.page = data
+
+	// num_values, encoding, definition_level_encoding, repetition_level_encoding
+	dataPage := tStruct{{1, int32(rows)}, {2, int32(parquetPlain)}, {3, int32(parquetRLE)}, {4, int32(parquetRLE)}}
+	// type, uncompressed_page_size, compressed_page_size, data_page_header
+	header, err := tStruct{{1, int32(parquetDataPage)}, {2, int32(len(data))}, {3, int32(len(data))}, {5, dataPage}}.encode(nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset := p.offset
+	if err := p.write(header, data); err != nil {
+		return nil, 0, err
+	}
+
+	size := int64(len(header) + len(data))
+	// type, encodings, path_in_schema, codec, num_values, total_uncompressed_size,
+	// total_compressed_size, data_page_offset
+	meta := tStruct{{1, parquetType(v.Column)}, {2, []int32{parquetPlain, parquetRLE}}, {3, []string{v.Column.Name}},
+		{4, int32(parquetUncompressed)}, {5, int64(rows)}, {6, size}, {7, size}, {9, offset}}
+	// file_offset, meta_data
+	return tStruct{{2, offset}, {3, meta}}, size, nil
+}
+
+// appendLevels appends the definition levels of the rows in the RLE encoding,
+// as runs of equal levels of bit width 1.
+func appendLevels(dst []byte, valid []bool) []byte {
+	for start := 0; start < len(valid); {
+		end := start + 1
+		for end < len(valid) && valid[end] == valid[start] {
+			end++
+		}
+		dst = binary.AppendUvarint(dst, uint64(end-start)<<1)
+		if valid[start] {
+			dst = append(dst, 1)
+		} else {
+			dst = append(dst, 0)
+		}
+		start = end
+	}
+	return dst
+}
+
+// Close writes the footer of the file with the schema and the row groups.
+// It does not close the underlying writer.
+func (p *ParquetWriter) Close() error {
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+
+	// The root of the schema is a group of the columns: name, num_children.
+	schema := []tStruct{{{4, "schema"}, {5, int32(len(p.columns))}}}
+	for _, column := range p.columns {
+		element, err := parquetSchema(column)
+		if err != nil {
+			return err
+		}
+		schema = append(schema, element)
+	}
+	rowGroups := p.rowGroups
+	if rowGroups == nil {
+		rowGroups = []tStruct{}
+	}
+	// version, schema, num_rows, row_groups, created_by
+	footer, err := tStruct{{1, int32(1)}, {2, schema}, {3, p.rows}, {4, rowGroups}, {6, "libnf-go"}}.encode(nil)
+	if err != nil {
+		return err
+	}
+	return p.write(footer, binary.LittleEndian.AppendUint32(nil, uint32(len(footer))), parquetMagic)
+}
+
+// ExportParquet exports the stream like Export and writes the batches to w as
+// a Parquet file, see ParquetWriter. Options.BatchSize sets the number of rows
+// of a row group. The footer of the file is written also when the export fails.
+func ExportParquet(ctx context.Context, records iter.Seq2[*record.Record, error], w io.Writer, opts Options) (int, error) {
+	columns, err := Schema(opts.Fields)
+	if err != nil {
+		return 0, err
+	}
+	pw, err := NewParquetWriter(w, columns)
+	if err != nil {
+		return 0, err
+	}
+	n, err := Export(ctx, records, opts, pw.WriteBatch)
+	if cerr := pw.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
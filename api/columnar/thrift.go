@@ -0,0 +1,127 @@
+package columnar
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// A minimal encoder of the Thrift compact protocol for the metadata of the
+// Parquet format.
+//
+// Structs are lists of fields in ascending order of their IDs. A field value
+// is a bool, int8, int32, int64, string, tStruct or a list of int32, string or
+// tStruct values.
+
+// tField is a field of a struct.
+type tField struct {
+	id    int16
+	value any
+}
+
+// tStruct holds the fields of a struct, in ascending order of their IDs.
+type tStruct []tField
+
+// Types of the compact protocol.
+const (
+	compactTrue   = 1
+	compactFalse  = 2
+	compactByte   = 3
+	compactI32    = 5
+	compactI64    = 6
+	compactBinary = 8
+	compactList   = 9
+	compactStruct = 12
+)
+
+// encode appends the struct to dst.
+func (s tStruct) encode(dst []byte) ([]byte, error) {
+	last := int16(0)
+	for _, f := range s {
+		typ, err := tType(f.value)
+		if err != nil {
+			return nil, err
+		}
+		if v, ok := f.value.(bool); ok && !v {
+			typ = compactFalse
+		}
+		if delta := f.id - last; delta > 0 && delta <= 15 {
+			dst = append(dst, byte(delta)<<4|typ)
+		} else {
+			dst = binary.AppendVarint(append(dst, typ), int64(f.id))
+		}
+		last = f.id
+		if _, ok := f.value.(bool); ok {
+			continue // The value is stored in the type.
+		}
+		if dst, err = tValue(dst, f.value); err != nil {
+			return nil, err
+		}
+	}
+	return append(dst, 0), nil
+}
+
+// tType returns the type of a field value.
+func tType(value any) (byte, error) {
+	switch value.(type) {
+	case bool:
+		return compactTrue, nil
+	case int8:
+		return compactByte, nil
+	case int32:
+		return compactI32, nil
+	case int64:
+		return compactI64, nil
+	case string:
+		return compactBinary, nil
+	case tStruct:
+		return compactStruct, nil
+	case []int32, []string, []tStruct:
+		return compactList, nil
+	}
+	return 0, fmt.Errorf("columnar: unknown thrift value %T", value)
+}
+
+// tValue appends a value which is not a bool to dst.
+func tValue(dst []byte, value any) ([]byte, error) {
+	switch v := value.(type) {
+	case int8:
+		return append(dst, byte(v)), nil
+	case int32:
+		return binary.AppendVarint(dst, int64(v)), nil
+	case int64:
+		return binary.AppendVarint(dst, v), nil
+	case string:
+		return append(binary.AppendUvarint(dst, uint64(len(v))), v...), nil
+	case tStruct:
+		return v.encode(dst)
+	case []int32:
+		dst = tListHeader(dst, compactI32, len(v))
+		for _, x := range v {
+			dst = binary.AppendVarint(dst, int64(x))
+		}
+		return dst, nil
+	case []string:
+		dst = tListHeader(dst, compactBinary, len(v))
+		for _, x := range v {
+			dst = append(binary.AppendUvarint(dst, uint64(len(x))), x...)
+		}
+		return dst, nil
+	case []tStruct:
+		dst = tListHeader(dst, compactStruct, len(v))
+		for _, x := range v {
+			var err error
+			if dst, err = x.encode(dst); err != nil {
+				return nil, err
+			}
+		}
+		return dst, nil
+	}
+	return nil, fmt.Errorf("columnar: unknown thrift value %T", value)
+}
+
+func tListHeader(dst []byte, elem byte, n int) []byte {
+	if n < 15 {
+		return append(dst, byte(n)<<4|elem)
+	}
+	return binary.AppendUvarint(append(dst, 0xf0|elem), uint64(n))
+}
@@ -0,0 +1,308 @@
+package encoding
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"iter"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/matejnesuta/libnf-go/api/errors"
+	"github.com/matejnesuta/libnf-go/api/fields"
+	"github.com/matejnesuta/libnf-go/api/record"
+)
+
+// CSVTimeLayout is the layout of timestamps in CSV files, RFC 3339 with milliseconds.
+// Timestamps are written in UTC.
+const CSVTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// DefaultCSVFields is the field list used by NewCSVWriter if none is given.
+var DefaultCSVFields = []int{
+	fields.First, fields.Last, fields.Prot, fields.SrcAddr, fields.SrcPort,
+	fields.DstAddr, fields.DstPort, fields.TcpFlags, fields.Dpkts, fields.Doctets, fields.AggrFlows,
+}
+
+// checkCSVField returns an error for fields which cannot be stored in a CSV column.
+// Computed fields can only be written, not read.
+func checkCSVField(field int, reading bool) error {
+	info, ok := fields.Lookup(field)
+	if !ok || info.Pair || field == fields.Brec1 || reading && info.Computed {
+		return fmt.Errorf("%w: %d", errors.ErrUnknownFld, field)
+	}
+	return nil
+}
+
+// CSVWriter writes records as CSV with one column per selected field.
+// The first row is a header with the libnf names of the fields.
+//
+// Values are written as in record.Record.MarshalJSON: numbers in decimal,
+// addresses in their text form and timestamps in CSVTimeLayout. ACLs are written
+// as "acl/ace/xace" and MPLS label stacks as space separated label stack entries.
+// Fields which are not set in a record are left empty.
+type CSVWriter struct {
+	w             *csv.Writer
+	fields        []int
+	headerWritten bool
+	row           []string
+}
+
+// NewCSVWriter returns a new writer of the given fields, or of DefaultCSVFields
+// if fieldList is empty. Pair fields and fields.Brec1 cannot be written.
+func NewCSVWriter(w io.Writer, fieldList []int) (*CSVWriter, error) {
+	if len(fieldList) == 0 {
+		fieldList = DefaultCSVFields
+	}
+	for _, field := range fieldList {
+		if err := checkCSVField(field, false); err != nil {
+			return nil, err
+		}
+	}
+	return &CSVWriter{
+		w:      csv.NewWriter(w),
+		fields: append([]int(nil), fieldList...),
+		row:    make([]string, len(fieldList)),
+	}, nil
+}
+
+// WriteHeader writes the header row unless it was already written.
+// It is called by Write before the first record.
+func (w *CSVWriter) WriteHeader() error {
+	if w.headerWritten {
+		return nil
+	}
+	w.headerWritten = true
+	for i, field := range w.fields {
+		w.row[i] = fields.Name(field)
+	}
+	return w.w.Write(w.row)
+}
+
+// Write writes the record as one row.
+func (w *CSVWriter) Write(r *record.Record) error {
+	if err := w.WriteHeader(); err != nil {
+		return err
+	}
+	for i, field := range w.fields {
+		value, err := r.GetField(field)
+		if err == errors.ErrNotSet {
+			w.row[i] = ""
+			continue
+		} else if err != nil {
+			return err
+		}
+		w.row[i] = formatCSVValue(value)
+	}
+	return w.w.Write(w.row)
+}
+
+// Flush writes any buffered data to the underlying writer.
+func (w *CSVWriter) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// WriteAll writes the header and every record of the stream and flushes the output.
+// Returns the number of records written.
+func (w *CSVWriter) WriteAll(records iter.Seq2[*record.Record, error]) (int, error) {
+	if err := w.WriteHeader(); err != nil {
+		return 0, err
+	}
+	return writeAll(records, w.Write, w.Flush)
+}
+
+func formatCSVValue(value any) string {
+	switch v := value.(type) {
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.UTC().Format(CSVTimeLayout)
+	case fields.Acl:
+		return fmt.Sprintf("%d/%d/%d", v.AclId, v.AceId, v.XaceId)
+	case fields.Mpls:
+		n := len(v)
+		for n > 0 && v[n-1] == 0 {
+			n--
+		}
+		entries := make([]string, n)
+		for i := range entries {
+			entries[i] = strconv.FormatUint(uint64(v[i]), 10)
+		}
+		return strings.Join(entries, " ")
+	default:
+		// net.IP, net.HardwareAddr and string
+		return fmt.Sprint(v)
+	}
+}
+
+// CSVReader reads records from CSV written by CSVWriter or by hand.
+//
+// The first row must be a header naming the field of every column. Both the
+// libnf names and their aliases (e.g. "sa" and "dp") are accepted. Timestamps may
+// also be given as numbers of milliseconds since the Unix epoch. Empty cells
+// leave the field unset.
+type CSVReader struct {
+	r      *csv.Reader
+	fields []int
+	names  []string
+}
+
+// NewCSVReader reads the header row from r and returns a reader of the rows
+// which follow. An error wrapping errors.ErrUnknownFld is returned if a column
+// does not name a field which can be set.
+func NewCSVReader(r io.Reader) (*CSVReader, error) {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("csv: missing header")
+	} else if err != nil {
+		return nil, err
+	}
+
+	reader := &CSVReader{r: cr, fields: make([]int, len(header)), names: make([]string, len(header))}
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		field, ok := fields.ByName(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", errors.ErrUnknownFld, name)
+		} else if err := checkCSVField(field, true); err != nil {
+			return nil, fmt.Errorf("%w: %q", errors.ErrUnknownFld, name)
+		}
+		reader.fields[i] = field
+		reader.names[i] = name
+	}
+	return reader, nil
+}
+
+// Fields returns the fields of the columns, in order.
+func (r *CSVReader) Fields() []int {
+	return append([]int(nil), r.fields...)
+}
+
+// Read replaces the contents of the allocated record with the next row.
+// Returns io.EOF at the end of the input. Invalid values are reported
+// together with their line and column.
+func (r *CSVReader) Read(rec *record.Record) error {
+	row, err := r.r.Read()
+	if err != nil {
+		return err
+	}
+	if err := rec.Clear(); err != nil {
+		return err
+	}
+	for i, value := range row {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if err := setCSVValue(rec, r.fields[i], value); err != nil {
+			line, _ := r.r.FieldPos(i)
+			return fmt.Errorf("csv: line %d, column %q: invalid value %q: %w", line, r.names[i], value, err)
+		}
+	}
+	return nil
+}
+
+// ReadAll reads every remaining row and writes it to w, e.g. a file.File
+// opened with OpenWrite. Returns the number of records written.
+func (r *CSVReader) ReadAll(w record.Writer) (int, error) {
+	return readAll(r.Read, w)
+}
+
+// Records returns an iterator over the remaining rows.
+//
+// The yielded record is allocated once and reused for every step, so it is
+// only valid until the next iteration. It is freed when the loop ends.
+// Iteration stops silently at the end of the input. Any other error is yielded
+// once together with a nil record.
+func (r *CSVReader) Records() iter.Seq2[*record.Record, error] {
+	return readRecords(r.Read)
+}
+
+func setCSVValue(rec *record.Record, field int, value string) error {
+	switch fields.FieldTypes[field].(type) {
+	case uint8:
+		return setUint[uint8](rec, field, value, 8)
+	case uint16:
+		return setUint[uint16](rec, field, value, 16)
+	case uint32:
+		return setUint[uint32](rec, field, value, 32)
+	case uint64:
+		return setUint[uint64](rec, field, value, 64)
+	case string:
+		return record.SetField(rec, field, value)
+	case net.IP:
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return err
+		}
+		return record.SetField(rec, field, addr)
+	case net.HardwareAddr:
+		mac, err := net.ParseMAC(value)
+		if err != nil {
+			return err
+		} else if len(mac) != 6 {
+			return fmt.Errorf("not a 48-bit MAC address")
+		}
+		return record.SetField(rec, field, mac)
+	case time.Time:
+		if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return record.SetField(rec, field, time.UnixMilli(ms))
+		}
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return err
+		}
+		return record.SetField(rec, field, t)
+	case fields.Acl:
+		var acl fields.Acl
+		parts := strings.Split(value, "/")
+		if len(parts) != 3 {
+			return fmt.Errorf("expected acl/ace/xace")
+		}
+		for i, dst := range []*uint32{&acl.AclId, &acl.AceId, &acl.XaceId} {
+			v, err := strconv.ParseUint(parts[i], 10, 32)
+			if err != nil {
+				return err
+			}
+			*dst = uint32(v)
+		}
+		return record.SetField(rec, field, acl)
+	case fields.Mpls:
+		var mpls fields.Mpls
+		entries := strings.Fields(value)
+		if len(entries) > len(mpls) {
+			return fmt.Errorf("more than %d MPLS labels", len(mpls))
+		}
+		for i, entry := range entries {
+			v, err := strconv.ParseUint(entry, 10, 32)
+			if err != nil {
+				return err
+			}
+			mpls[i] = uint32(v)
+		}
+		return record.SetField(rec, field, mpls)
+	default:
+		return errors.ErrUnknownFld
+	}
+}
+
+func setUint[T uint8 | uint16 | uint32 | uint64](rec *record.Record, field int, value string, bitSize int) error {
+	v, err := strconv.ParseUint(value, 10, bitSize)
+	if err != nil {
+		return err
+	}
+	return record.SetField(rec, field, T(v))
+}
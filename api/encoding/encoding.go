@@ -0,0 +1,162 @@
+// Package encoding streams flow records in text formats: newline delimited JSON
+// (NDJSON), one JSON object per record as produced by record.Record.MarshalJSON,
+// and CSV with a selectable list of fields.
+//
+// An Encoder or a CSVWriter writes the records of any record stream, such as
+// file.File.Records or ring.Ring.Records, and a Decoder or a CSVReader reads the
+// records back, e.g. to write them into an nfdump file with file.File.WriteRecord.
+//
+// The EncodeAll and WriteAll methods skip the weak errors of the stream (see
+// errors.IsWeak) and stop at any other error.
+package encoding
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"iter"
+
+	"github.com/matejnesuta/libnf-go/api/errors"
+	"github.com/matejnesuta/libnf-go/api/record"
+)
+
+// Encoder writes records as NDJSON to an output stream.
+type Encoder struct {
+	w   *bufio.Writer
+	buf []byte
+}
+
+// NewEncoder returns a new encoder writing to w. The output is buffered,
+// call Flush after the last record if the records are written with Encode.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: bufio.NewWriter(w)}
+}
+
+// Encode writes the record as one line of JSON.
+func (e *Encoder) Encode(r *record.Record) error {
+	var err error
+	e.buf, err = r.AppendJSON(e.buf[:0])
+	if err != nil {
+		return err
+	}
+	e.buf = append(e.buf, '\n')
+	_, err = e.w.Write(e.buf)
+	return err
+}
+
+// Flush writes any buffered data to the underlying writer.
+func (e *Encoder) Flush() error {
+	return e.w.Flush()
+}
+
+// EncodeAll writes every record of the stream and flushes the output.
+// Returns the number of records written.
+func (e *Encoder) EncodeAll(records iter.Seq2[*record.Record, error]) (int, error) {
+	return writeAll(records, e.Encode, e.Flush)
+}
+
+// Decoder reads records from an NDJSON input stream.
+// Objects may also be separated by any other JSON whitespace.
+type Decoder struct {
+	dec *json.Decoder
+}
+
+// NewDecoder returns a new decoder reading from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{dec: json.NewDecoder(r)}
+}
+
+// Decode replaces the contents of the allocated record with the next JSON object
+// of the input, see record.Record.UnmarshalJSON. Returns io.EOF at the end of the input.
+func (d *Decoder) Decode(r *record.Record) error {
+	var raw json.RawMessage
+	if err := d.dec.Decode(&raw); err != nil {
+		return err
+	}
+	return r.UnmarshalJSON(raw)
+}
+
+// DecodeAll decodes every remaining record of the input and writes it to w.
+// Returns the number of records written.
+func (d *Decoder) DecodeAll(w record.Writer) (int, error) {
+	return readAll(d.Decode, w)
+}
+
+// Records returns an iterator over the records of the input.
+//
+// The yielded record is allocated once and reused for every step, so it is
+// only valid until the next iteration. It is freed when the loop ends.
+// Iteration stops silently at the end of the input. Any other error is yielded
+// once together with a nil record.
+func (d *Decoder) Records() iter.Seq2[*record.Record, error] {
+	return readRecords(d.Decode)
+}
+
+// writeAll writes every record of the stream with write and flushes the output.
+// Weak errors of the stream are skipped, any other error stops the writing.
+func writeAll(records iter.Seq2[*record.Record, error], write func(*record.Record) error, flush func() error) (int, error) {
+	n := 0
+	for r, err := range records {
+		if errors.IsWeak(err) {
+			continue
+		} else if err != nil {
+			flush()
+			return n, err
+		}
+		if err := write(r); err != nil {
+			flush()
+			return n, err
+		}
+		n++
+	}
+	return n, flush()
+}
+
+// readAll reads records with read into a single allocated record until io.EOF
+// and writes each of them to w.
+func readAll(read func(*record.Record) error, w record.Writer) (int, error) {
+	rec, err := record.NewRecord()
+	if err != nil {
+		return 0, err
+	}
+	defer rec.Free()
+
+	n := 0
+	for {
+		err := read(&rec)
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+		if err := w.WriteRecord(&rec); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// readRecords returns an iterator over the records read with read until io.EOF.
+func readRecords(read func(*record.Record) error) iter.Seq2[*record.Record, error] {
+	return func(yield func(*record.Record, error) bool) {
+		rec, err := record.NewRecord()
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer rec.Free()
+
+		for {
+			err = read(&rec)
+			if err == io.EOF {
+				return
+			} else if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(&rec, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package encoding_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/matejnesuta/libnf-go/api/encoding"
+	"github.com/matejnesuta/libnf-go/api/errors"
+	"github.com/matejnesuta/libnf-go/api/fields"
+	"github.com/matejnesuta/libnf-go/api/file"
+	"github.com/matejnesuta/libnf-go/api/flow"
+	"github.com/matejnesuta/libnf-go/api/record"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeFile(t *testing.T) {
+	var ptr file.File
+	err := ptr.OpenRead("../testfiles/nfcapd.201705281555", false, false)
+	assert.Equal(t, nil, err)
+	defer ptr.Close()
+
+	var buf bytes.Buffer
+	n, err := encoding.NewEncoder(&buf).EncodeAll(ptr.Records())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2035, n)
+
+	lines := 0
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var object map[string]any
+		assert.Equal(t, nil, json.Unmarshal(scanner.Bytes(), &object))
+		assert.Contains(t, object, "srcip")
+		lines++
+	}
+	assert.Equal(t, 2035, lines)
+}
+
+func TestDecodeToFile(t *testing.T) {
+	var in file.File
+	err := in.OpenRead("../testfiles/ipv4-file.tmp", false, false)
+	assert.Equal(t, nil, err)
+	var buf bytes.Buffer
+	written, err := encoding.NewEncoder(&buf).EncodeAll(in.Records())
+	assert.Equal(t, nil, err)
+	in.Close()
+
+	var out file.File
+	err = out.OpenWrite("../tmp/json-file.tmp", "", false, file.CompLZO, false)
+	assert.Equal(t, nil, err)
+	n, err := encoding.NewDecoder(&buf).DecodeAll(&out)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, written, n)
+	out.Close()
+
+	var original, decoded file.File
+	assert.Equal(t, nil, original.OpenRead("../testfiles/ipv4-file.tmp", false, false))
+	defer original.Close()
+	assert.Equal(t, nil, decoded.OpenRead("../tmp/json-file.tmp", false, false))
+	defer decoded.Close()
+
+	var expected []flow.Flow
+	for rec, err := range original.Records() {
+		assert.Equal(t, nil, err)
+		f, _ := rec.ToFlow()
+		expected = append(expected, f)
+	}
+	var actual []flow.Flow
+	for rec, err := range decoded.Records() {
+		assert.Equal(t, nil, err)
+		f, _ := rec.ToFlow()
+		actual = append(actual, f)
+	}
+	assert.Equal(t, expected, actual)
+}
+
+func TestDecodeRecords(t *testing.T) {
+	input := `{"srcip": "10.0.0.1", "dstport": 53}
+{"srcip": "10.0.0.2", "dstport": 80}
+`
+	var ports []uint16
+	for rec, err := range encoding.NewDecoder(strings.NewReader(input)).Records() {
+		assert.Equal(t, nil, err)
+		port, err := rec.DstPort()
+		assert.Equal(t, nil, err)
+		ports = append(ports, port)
+	}
+	assert.Equal(t, []uint16{53, 80}, ports)
+}
+
+func TestDecodeInvalidInput(t *testing.T) {
+	input := `{"srcip": "10.0.0.1"}
+{"nosuchfield": 1}
+`
+	var errs []error
+	for _, err := range encoding.NewDecoder(strings.NewReader(input)).Records() {
+		errs = append(errs, err)
+	}
+	assert.Equal(t, 2, len(errs))
+	assert.Equal(t, nil, errs[0])
+	assert.ErrorIs(t, errs[1], errors.ErrUnknownFld)
+}
+
+func TestCSVWriterHeader(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := encoding.NewCSVWriter(&buf, []int{fields.SrcAddr, fields.DstPort, fields.CalcBps})
+	assert.Equal(t, nil, err)
+	n, err := w.WriteAll(func(yield func(*record.Record, error) bool) {})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, "srcip,dstport,bps\n", buf.String())
+
+	_, err = encoding.NewCSVWriter(&buf, []int{fields.PairAddr})
+	assert.ErrorIs(t, err, errors.ErrUnknownFld)
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	var in file.File
+	err := in.OpenRead("../testfiles/nfcapd.201705281555", false, false)
+	assert.Equal(t, nil, err)
+	var buf bytes.Buffer
+	w, err := encoding.NewCSVWriter(&buf, flow.Fields)
+	assert.Equal(t, nil, err)
+	written, err := w.WriteAll(in.Records())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2035, written)
+	in.Close()
+
+	r, err := encoding.NewCSVReader(&buf)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, flow.Fields, r.Fields())
+	var out file.File
+	err = out.OpenWrite("../tmp/csv-file.tmp", "", false, file.CompBZ2, false)
+	assert.Equal(t, nil, err)
+	n, err := r.ReadAll(&out)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, written, n)
+	out.Close()
+
+	var original, converted file.File
+	assert.Equal(t, nil, original.OpenRead("../testfiles/nfcapd.201705281555", false, false))
+	defer original.Close()
+	assert.Equal(t, nil, converted.OpenRead("../tmp/csv-file.tmp", false, false))
+	defer converted.Close()
+
+	rec, err := record.NewRecord()
+	assert.Equal(t, nil, err)
+	defer rec.Free()
+	for expected, err := range original.Records() {
+		assert.Equal(t, nil, err)
+		assert.Equal(t, nil, converted.GetNextRecord(&rec))
+		e, _ := expected.ToFlow()
+		a, _ := rec.ToFlow()
+		assert.Equal(t, e, a)
+	}
+}
+
+func TestCSVReader(t *testing.T) {
+	input := "ts,sa,dp,proto,ingressacl,mpls\n" +
+		"1496000000123,10.0.0.1,53,17,1/2/3,16 32\n" +
+		"2017-05-28T19:33:20.123Z,10.0.0.2,,6,,\n"
+	r, err := encoding.NewCSVReader(strings.NewReader(input))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []int{fields.First, fields.SrcAddr, fields.DstPort, fields.Prot, fields.IngressAcl, fields.MplsLabel}, r.Fields())
+
+	var firsts []int64
+	for rec, err := range r.Records() {
+		assert.Equal(t, nil, err)
+		first, err := rec.First()
+		assert.Equal(t, nil, err)
+		firsts = append(firsts, first.UnixMilli())
+	}
+	assert.Equal(t, []int64{1496000000123, 1496000000123}, firsts)
+}
+
+func TestCSVReaderErrors(t *testing.T) {
+	_, err := encoding.NewCSVReader(strings.NewReader(""))
+	assert.NotEqual(t, nil, err)
+	_, err = encoding.NewCSVReader(strings.NewReader("srcip,nosuchfield\n"))
+	assert.ErrorIs(t, err, errors.ErrUnknownFld)
+	_, err = encoding.NewCSVReader(strings.NewReader("srcip,bps\n"))
+	assert.ErrorIs(t, err, errors.ErrUnknownFld)
+
+	rec, err := record.NewRecord()
+	assert.Equal(t, nil, err)
+	defer rec.Free()
+
+	for _, input := range []string{
+		"srcport\n70000\n",
+		"srcip\n10.0.0\n",
+		"insrcmac\n00:11:22\n",
+		"first\nyesterday\n",
+		"ingressacl\n1/2\n",
+		"mpls\n1 2 3 4 5 6 7 8 9 10 11\n",
+	} {
+		r, err := encoding.NewCSVReader(strings.NewReader(input))
+		assert.Equal(t, nil, err)
+		err = r.Read(&rec)
+		assert.NotEqual(t, nil, err, input)
+		assert.Contains(t, err.Error(), "line 2", input)
+	}
+}
@@ -14,6 +14,12 @@ var (
 	ErrWeak          = errors.New("multiple weak errors (errors to skip)")
 )
 
+// IsWeak reports whether err is one of the weak errors. After a weak error,
+// libnf skips the affected data and reading can continue.
+func IsWeak(err error) bool {
+	return err == ErrUnknownBlock || err == ErrUnknownRecord || err == ErrCompat15 || err == ErrWeak
+}
+
 // IO and corruption errors
 var (
 	ErrRead    = errors.New("read error (IO)")
@@ -53,6 +59,23 @@ var (
 	ErrMemHeapEmpty        = errors.New("memory heap is empty")
 )
 
+// Ring errors
+var (
+	ErrRingNotAllocated = errors.New("ring is not allocated")
+)
+
+// Collector and exporter errors
+var (
+	ErrMalformedPacket    = errors.New("malformed flow export packet")
+	ErrUnsupportedVersion = errors.New("unsupported flow export version")
+	ErrTemplateIDs        = errors.New("all template IDs are in use")
+)
+
+// Packet capture errors
+var (
+	ErrCaptureFormat = errors.New("unsupported or corrupted packet capture")
+)
+
 // Other errors
 var (
 	ErrNotSet   = errors.New("item is not set")
@@ -62,6 +85,50 @@ var (
 	ErrNaN      = errors.New("attempt to divide by 0")
 )
 
+// LnfError describes a failed libnf call together with the context it was made in.
+//
+// Err holds one of the sentinel errors of this package, so errors.Is can be used
+// to check for a particular kind of failure:
+//
+//	if errors.Is(err, LnfErr.ErrCannotOpenFile) { ... }
+//
+// Errors that are part of the normal control flow, like ErrFileEof, ErrNotSet
+// or ErrMemHeapEnd, are returned as bare sentinels and never wrapped.
+type LnfError struct {
+	Op     string // Operation that failed, e.g. "open" or "filter init".
+	Path   string // File path, filter expression or field the operation worked with.
+	Status int    // Raw status code returned by libnf.
+	Msg    string // Message reported by libnf, empty if there is none.
+	Err    error  // Sentinel error describing the failure.
+}
+
+// Wrap creates an LnfError for the given operation. If status indicates that
+// libnf stored a message describing the failure, the message is attached.
+func Wrap(op string, path string, status int, err error) *LnfError {
+	e := &LnfError{Op: op, Path: path, Status: status, Err: err}
+	if status == internal.ERR_OTHER_MSG || status == internal.ERR_FILTER {
+		e.Msg = Error()
+	}
+	return e
+}
+
+func (e *LnfError) Error() string {
+	s := e.Op
+	if e.Path != "" {
+		s += " " + e.Path
+	}
+	s += ": " + e.Err.Error()
+	if e.Msg != "" {
+		s += ": " + e.Msg
+	}
+	return s
+}
+
+func (e *LnfError) Unwrap() error {
+	return e.Err
+}
+
+// Error returns the last error message stored by libnf.
 func Error() string {
 	return internal.Error()
 }
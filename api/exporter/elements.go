@@ -0,0 +1,166 @@
+package exporter
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/matejnesuta/libnf-go/api/fields"
+	"github.com/matejnesuta/libnf-go/api/flow"
+)
+
+// element encodes one flow field as an information element. An element is
+// exported if its field is set in the flow and match, if any, accepts the flow.
+type element struct {
+	field  int
+	id     uint16
+	length uint16
+	match  func(f *flow.Flow) bool
+	put    func(b []byte, f *flow.Flow)
+}
+
+// putUint encodes v as a big-endian unsigned integer of len(b) bytes.
+func putUint(b []byte, v uint64) {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+}
+
+func uintElement[T uint8 | uint16 | uint32 | uint64](field int, id uint16, get func(f *flow.Flow) T) element {
+	return element{field: field, id: id, length: uint16(binary.Size(T(0))), put: func(b []byte, f *flow.Flow) {
+		putUint(b, uint64(get(f)))
+	}}
+}
+
+// addrElements returns the elements of an address field, the first one used
+// for IPv4 and the second one for IPv6 addresses.
+func addrElements(field int, id4, id6 uint16, get func(f *flow.Flow) netip.Addr) []element {
+	return []element{
+		{field: field, id: id4, length: 4,
+			match: func(f *flow.Flow) bool { return get(f).Unmap().Is4() },
+			put: func(b []byte, f *flow.Flow) {
+				a := get(f).Unmap().As4()
+				copy(b, a[:])
+			}},
+		{field: field, id: id6, length: 16,
+			match: func(f *flow.Flow) bool { return get(f).Unmap().Is6() },
+			put: func(b []byte, f *flow.Flow) {
+				a := get(f).As16()
+				copy(b, a[:])
+			}},
+	}
+}
+
+func macElement(field int, id uint16, get func(f *flow.Flow) *flow.MAC) element {
+	return element{field: field, id: id, length: 6, put: func(b []byte, f *flow.Flow) {
+		copy(b, get(f)[:])
+	}}
+}
+
+// timeElement encodes a timestamp in milliseconds since the Unix epoch. Absolute
+// timestamps are used by both versions, so historical flows can be exported
+// regardless of the system uptime of the exporter.
+func timeElement(field int, id uint16, get func(f *flow.Flow) time.Time) element {
+	return element{field: field, id: id, length: 8, put: func(b []byte, f *flow.Flow) {
+		putUint(b, uint64(get(f).UnixMilli()))
+	}}
+}
+
+// mplsElement encodes the i-th label stack entry in 3 bytes. Entries after the
+// last non-zero one are not exported.
+func mplsElement(i int) element {
+	return element{field: fields.MplsLabel, id: uint16(70 + i), length: 3,
+		match: func(f *flow.Flow) bool {
+			for _, label := range f.MplsLabel[i:] {
+				if label != 0 {
+					return true
+				}
+			}
+			return false
+		},
+		put: func(b []byte, f *flow.Flow) {
+			putUint(b, uint64(f.MplsLabel[i]))
+		}}
+}
+
+// elements lists the exported information elements in the order of the
+// template fields. The IDs are shared by NetFlow v9 and IPFIX, except for the
+// elements in v9Elements.
+var elements = slices.Concat(
+	[]element{
+		timeElement(fields.First, 152, func(f *flow.Flow) time.Time { return f.First }),
+		timeElement(fields.Last, 153, func(f *flow.Flow) time.Time { return f.Last }),
+		uintElement(fields.Doctets, 1, func(f *flow.Flow) uint64 { return f.Bytes }),
+		uintElement(fields.Dpkts, 2, func(f *flow.Flow) uint64 { return f.Packets }),
+		uintElement(fields.AggrFlows, 3, func(f *flow.Flow) uint64 { return f.Flows }),
+		uintElement(fields.OutBytes, 23, func(f *flow.Flow) uint64 { return f.OutBytes }),
+		uintElement(fields.OutPkts, 24, func(f *flow.Flow) uint64 { return f.OutPackets }),
+		uintElement(fields.Prot, 4, func(f *flow.Flow) uint8 { return f.Prot }),
+		uintElement(fields.Tos, 5, func(f *flow.Flow) uint8 { return f.Tos }),
+		uintElement(fields.TcpFlags, 6, func(f *flow.Flow) uint8 { return f.TcpFlags }),
+		uintElement(fields.SrcPort, 7, func(f *flow.Flow) uint16 { return f.SrcPort }),
+		uintElement(fields.DstPort, 11, func(f *flow.Flow) uint16 { return f.DstPort }),
+	},
+	addrElements(fields.SrcAddr, 8, 27, func(f *flow.Flow) netip.Addr { return f.SrcAddr }),
+	addrElements(fields.DstAddr, 12, 28, func(f *flow.Flow) netip.Addr { return f.DstAddr }),
+	addrElements(fields.IpNextHop, 15, 62, func(f *flow.Flow) netip.Addr { return f.NextHop }),
+	addrElements(fields.BgpNextHop, 18, 63, func(f *flow.Flow) netip.Addr { return f.BgpNextHop }),
+	[]element{
+		uintElement(fields.SrcMask, 9, func(f *flow.Flow) uint8 { return f.SrcMask }),
+		uintElement(fields.DstMask, 13, func(f *flow.Flow) uint8 { return f.DstMask }),
+		uintElement(fields.Input, 10, func(f *flow.Flow) uint32 { return f.Input }),
+		uintElement(fields.Output, 14, func(f *flow.Flow) uint32 { return f.Output }),
+		uintElement(fields.SrcAS, 16, func(f *flow.Flow) uint32 { return f.SrcAS }),
+		uintElement(fields.DstAS, 17, func(f *flow.Flow) uint32 { return f.DstAS }),
+		uintElement(fields.BgpNextAdjacentAS, 128, func(f *flow.Flow) uint32 { return f.BgpNextAdjacentAS }),
+		uintElement(fields.BgpPrevAdjacentAS, 129, func(f *flow.Flow) uint32 { return f.BgpPrevAdjacentAS }),
+		uintElement(fields.IcmpType, 176, func(f *flow.Flow) uint8 { return f.IcmpType }),
+		uintElement(fields.IcmpCode, 177, func(f *flow.Flow) uint8 { return f.IcmpCode }),
+		uintElement(fields.SamplerInterval, 34, func(f *flow.Flow) uint32 { return f.SamplerInterval }),
+		uintElement(fields.SamplerMode, 35, func(f *flow.Flow) uint16 { return f.SamplerMode }),
+		uintElement(fields.EngineType, 38, func(f *flow.Flow) uint8 { return f.EngineType }),
+		uintElement(fields.EngineId, 39, func(f *flow.Flow) uint8 { return f.EngineId }),
+		uintElement(fields.DstTos, 55, func(f *flow.Flow) uint8 { return f.DstTos }),
+		macElement(fields.InSrcMac, 56, func(f *flow.Flow) *flow.MAC { return &f.InSrcMac }),
+		macElement(fields.OutDstMac, 57, func(f *flow.Flow) *flow.MAC { return &f.OutDstMac }),
+		macElement(fields.InDstMac, 80, func(f *flow.Flow) *flow.MAC { return &f.InDstMac }),
+		macElement(fields.OutSrcMac, 81, func(f *flow.Flow) *flow.MAC { return &f.OutSrcMac }),
+		uintElement(fields.SrcVlan, 58, func(f *flow.Flow) uint16 { return f.SrcVlan }),
+		uintElement(fields.DstVlan, 59, func(f *flow.Flow) uint16 { return f.DstVlan }),
+		uintElement(fields.Dir, 61, func(f *flow.Flow) uint8 { return f.Dir }),
+		uintElement(fields.FwdStatus, 89, func(f *flow.Flow) uint8 { return f.FwdStatus }),
+		uintElement(fields.ConnId, 148, func(f *flow.Flow) uint32 { return f.ConnId }),
+		uintElement(fields.EventFlag, 230, func(f *flow.Flow) uint8 { return f.EventFlag }),
+		uintElement(fields.FwEvent, 233, func(f *flow.Flow) uint8 { return f.FwEvent }),
+		uintElement(fields.IngressVrfid, 234, func(f *flow.Flow) uint32 { return f.IngressVrfid }),
+		uintElement(fields.EgressVrfid, 235, func(f *flow.Flow) uint32 { return f.EgressVrfid }),
+		uintElement(fields.EventTime, 323, func(f *flow.Flow) uint64 { return f.EventTime }),
+	},
+	addrElements(fields.XlateSrcIp, 225, 281, func(f *flow.Flow) netip.Addr { return f.XlateSrcIp }),
+	addrElements(fields.XlateDstIp, 226, 282, func(f *flow.Flow) netip.Addr { return f.XlateDstIp }),
+	[]element{
+		uintElement(fields.XlateSrcPort, 227, func(f *flow.Flow) uint16 { return f.XlateSrcPort }),
+		uintElement(fields.XlateDstPort, 228, func(f *flow.Flow) uint16 { return f.XlateDstPort }),
+		uintElement(fields.BlockStart, 361, func(f *flow.Flow) uint16 { return f.BlockStart }),
+		uintElement(fields.BlockEnd, 362, func(f *flow.Flow) uint16 { return f.BlockEnd }),
+		uintElement(fields.BlockStep, 363, func(f *flow.Flow) uint16 { return f.BlockStep }),
+		uintElement(fields.BlockSize, 364, func(f *flow.Flow) uint16 { return f.BlockSize }),
+	},
+	mplsElements(),
+)
+
+// v9Elements lists the elements exported by NetFlow v9 only. They are Cisco
+// specific and have no IANA assigned IPFIX counterpart.
+var v9Elements = []element{
+	uintElement(fields.FwXEvent, 33002, func(f *flow.Flow) uint16 { return f.FwXEvent }),
+}
+
+func mplsElements() []element {
+	var list []element
+	for i := range len(fields.Mpls{}) {
+		list = append(list, mplsElement(i))
+	}
+	return list
+}
@@ -0,0 +1,412 @@
+// Package exporter sends flow records as NetFlow v9 or IPFIX over UDP, e.g. to
+// replay nfdump files into third-party collectors.
+//
+// Templates are built from the fields set in each record, so records of a
+// file.File, a ring.Ring or the result of a memheapv2.MemHeapV2 can be exported
+// as they are. Records with a different set of fields, or with addresses of a
+// different IP version, use different templates. Templates are sent before the
+// first record which uses them and then again every Options.TemplateRefresh
+// packets, so collectors started later learn them too.
+//
+// Export can limit the number of flows sent per second and replay records at
+// the pace given by their fields.First timestamps.
+package exporter
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"iter"
+	"net"
+	"time"
+
+	"github.com/matejnesuta/libnf-go/api/collector"
+	"github.com/matejnesuta/libnf-go/api/errors"
+	"github.com/matejnesuta/libnf-go/api/fields"
+	"github.com/matejnesuta/libnf-go/api/flow"
+	"github.com/matejnesuta/libnf-go/api/record"
+)
+
+const (
+	// DefaultPacketSize keeps packets below the usual Ethernet MTU.
+	DefaultPacketSize = 1400
+	// DefaultTemplateRefresh is the number of packets after which the templates are sent again.
+	DefaultTemplateRefresh = 20
+
+	v9HeaderLen    = 20
+	ipfixHeaderLen = 16
+	setHeaderLen   = 4
+
+	v9TemplateSet    = 0
+	ipfixTemplateSet = 2
+	firstTemplateID  = 256
+	lastTemplateID   = 65535
+)
+
+// Options configure an Exporter. The zero value exports IPFIX with the defaults.
+type Options struct {
+	Version           uint16  // collector.NetflowV9 or collector.IPFIX, IPFIX if 0.
+	ObservationDomain uint32  // IPFIX observation domain ID, or NetFlow v9 source ID.
+	PacketSize        int     // Maximum size of a packet, DefaultPacketSize if 0.
+	TemplateRefresh   int     // Packets after which templates are sent again, DefaultTemplateRefresh if 0.
+	Rate              float64 // Maximum number of flows sent per second, unlimited if 0.
+	Replay            bool    // Send flows at the pace given by fields.First.
+	Speed             float64 // Replay speed, e.g. 2 replays twice as fast, real time if 0.
+}
+
+// Stats holds the counters of an Exporter.
+type Stats struct {
+	Packets   uint64 // Packets sent.
+	Flows     uint64 // Flow records sent.
+	Templates uint64 // Templates created.
+	Skipped   uint64 // Records skipped because none of their fields can be exported.
+}
+
+type template struct {
+	id       uint16
+	elements []*element
+	length   int  // Length of a data record.
+	sent     bool // Whether the template was sent since the last refresh.
+}
+
+// Exporter encodes flows into NetFlow v9 or IPFIX packets. Flows are buffered
+// until a packet is full, so Flush must be called after the last flow unless
+// Export or Close is used. An Exporter is not safe for concurrent use.
+type Exporter struct {
+	w         io.Writer
+	opts      Options
+	elements  []element
+	templates map[string]*template // Keyed by the indexes of the elements.
+	nextID    int
+	key       []byte
+	flow      flow.Flow
+
+	buf         []byte
+	set         int // Offset of the header of the open set, -1 if there is none.
+	setID       uint16
+	records     int // Template and data records in the packet.
+	dataRecords int
+	sequence    uint32
+	start       time.Time
+	stats       Stats
+
+	rateStart   time.Time
+	replayStart time.Time
+	replayFirst time.Time
+}
+
+// Dial returns an exporter sending packets to the UDP address, e.g. "127.0.0.1:4739".
+func Dial(address string, opts Options) (*Exporter, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	e, err := New(conn, opts)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return e, nil
+}
+
+// New returns an exporter writing every packet with a single call of w.Write,
+// e.g. to a net.Conn.
+func New(w io.Writer, opts Options) (*Exporter, error) {
+	if opts.Version == 0 {
+		opts.Version = collector.IPFIX
+	}
+	if opts.PacketSize == 0 {
+		opts.PacketSize = DefaultPacketSize
+	}
+	if opts.TemplateRefresh <= 0 {
+		opts.TemplateRefresh = DefaultTemplateRefresh
+	}
+	if opts.Speed <= 0 {
+		opts.Speed = 1
+	}
+
+	e := &Exporter{w: w, opts: opts, templates: make(map[string]*template), nextID: firstTemplateID, start: time.Now()}
+	switch opts.Version {
+	case collector.NetflowV9:
+		e.elements = append(elements[:len(elements):len(elements)], v9Elements...)
+		e.buf = make([]byte, v9HeaderLen, opts.PacketSize)
+	case collector.IPFIX:
+		e.elements = elements
+		e.buf = make([]byte, ipfixHeaderLen, opts.PacketSize)
+	default:
+		return nil, fmt.Errorf("%w: %d", errors.ErrUnsupportedVersion, opts.Version)
+	}
+	if opts.PacketSize > 65535 || opts.PacketSize < len(e.buf)+64 {
+		return nil, fmt.Errorf("exporter: invalid packet size %d", opts.PacketSize)
+	}
+	e.set = -1
+	return e, nil
+}
+
+// Stats returns the counters of the exporter.
+func (e *Exporter) Stats() Stats {
+	return e.stats
+}
+
+// WriteFlow adds the flow to the current packet. The packet is sent when it is
+// full, or earlier if the flow has to wait for the rate limit or the replay.
+func (e *Exporter) WriteFlow(f *flow.Flow) error {
+	return e.write(context.Background(), f)
+}
+
+// WriteRecord adds the record to the current packet, see WriteFlow.
+// It makes the exporter a destination of record streams like file.File and ring.Ring.
+func (e *Exporter) WriteRecord(r *record.Record) error {
+	if err := r.ToFlowInto(&e.flow); err != nil {
+		return err
+	}
+	return e.write(context.Background(), &e.flow)
+}
+
+// Export sends every record of the stream, e.g. file.File.Records,
+// ring.Ring.Records or memheapv2.MemHeapV2.Records, and flushes the last packet.
+// The export stops at the first error other than a weak one. Returns the
+// number of records read from the stream and ctx.Err() if the context is
+// canceled, e.g. while waiting for the replay.
+func (e *Exporter) Export(ctx context.Context, records iter.Seq2[*record.Record, error]) (int, error) {
+	n := 0
+	for r, err := range records {
+		if errors.IsWeak(err) {
+			continue
+		} else if err != nil {
+			e.Flush()
+			return n, err
+		}
+		if err := ctx.Err(); err != nil {
+			e.Flush()
+			return n, err
+		}
+		if err := r.ToFlowInto(&e.flow); err != nil {
+			e.Flush()
+			return n, err
+		}
+		if err := e.write(ctx, &e.flow); err != nil {
+			e.Flush()
+			return n, err
+		}
+		n++
+	}
+	return n, e.Flush()
+}
+
+// Close sends the buffered flows and closes the underlying writer if it is an io.Closer.
+func (e *Exporter) Close() error {
+	err := e.Flush()
+	if c, ok := e.w.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (e *Exporter) write(ctx context.Context, f *flow.Flow) error {
+	t, err := e.template(f)
+	if err != nil {
+		return err
+	} else if t == nil {
+		e.stats.Skipped++
+		return nil
+	}
+	if err := e.pace(ctx, f); err != nil {
+		return err
+	}
+
+	if !e.fits(t) {
+		if err := e.Flush(); err != nil {
+			return err
+		}
+		if !e.fits(t) {
+			return fmt.Errorf("exporter: record of %d bytes does not fit into a packet of %d bytes", t.length, e.opts.PacketSize)
+		}
+	}
+	if !t.sent {
+		e.appendTemplate(t)
+	}
+	if e.set < 0 || e.setID != t.id {
+		e.closeSet()
+		e.openSet(t.id)
+	}
+
+	off := len(e.buf)
+	e.buf = e.buf[:off+t.length]
+	for _, el := range t.elements {
+		el.put(e.buf[off:off+int(el.length)], f)
+		off += int(el.length)
+	}
+	e.records++
+	e.dataRecords++
+	e.stats.Flows++
+	return nil
+}
+
+// template returns the template of the fields exported from the flow, or nil
+// if none of them are set. Template IDs are never reused, so an error is
+// returned once all of them are taken.
+func (e *Exporter) template(f *flow.Flow) (*template, error) {
+	e.key = e.key[:0]
+	for i := range e.elements {
+		el := &e.elements[i]
+		if f.Present.Has(el.field) && (el.match == nil || el.match(f)) {
+			e.key = binary.BigEndian.AppendUint16(e.key, uint16(i))
+		}
+	}
+	if len(e.key) == 0 {
+		return nil, nil
+	}
+	if t, ok := e.templates[string(e.key)]; ok {
+		return t, nil
+	}
+	if e.nextID > lastTemplateID {
+		return nil, fmt.Errorf("%w: %d templates", errors.ErrTemplateIDs, e.stats.Templates)
+	}
+
+	t := &template{id: uint16(e.nextID)}
+	for i := 0; i < len(e.key); i += 2 {
+		el := &e.elements[binary.BigEndian.Uint16(e.key[i:])]
+		t.elements = append(t.elements, el)
+		t.length += int(el.length)
+	}
+	e.templates[string(e.key)] = t
+	e.nextID++
+	e.stats.Templates++
+	return t, nil
+}
+
+// fits reports whether the record, its template if it was not sent yet and
+// the headers of the sets fit into the current packet.
+func (e *Exporter) fits(t *template) bool {
+	size := len(e.buf) + t.length
+	if !t.sent {
+		size += 3 + 2*setHeaderLen + 4 + 4*len(t.elements)
+	} else if e.set < 0 || e.setID != t.id {
+		size += 3 + setHeaderLen
+	}
+	if e.opts.Version == collector.NetflowV9 {
+		size += 3
+	}
+	return size <= e.opts.PacketSize
+}
+
+func (e *Exporter) openSet(id uint16) {
+	e.set, e.setID = len(e.buf), id
+	e.buf = binary.BigEndian.AppendUint16(e.buf, id)
+	e.buf = binary.BigEndian.AppendUint16(e.buf, 0)
+}
+
+// closeSet writes the length of the open set. NetFlow v9 flowsets are padded
+// to a multiple of 4 bytes.
+func (e *Exporter) closeSet() {
+	if e.set < 0 {
+		return
+	}
+	if e.opts.Version == collector.NetflowV9 {
+		for (len(e.buf)-e.set)%4 != 0 {
+			e.buf = append(e.buf, 0)
+		}
+	}
+	binary.BigEndian.PutUint16(e.buf[e.set+2:], uint16(len(e.buf)-e.set))
+	e.set = -1
+}
+
+func (e *Exporter) appendTemplate(t *template) {
+	e.closeSet()
+	if e.opts.Version == collector.NetflowV9 {
+		e.openSet(v9TemplateSet)
+	} else {
+		e.openSet(ipfixTemplateSet)
+	}
+	e.buf = binary.BigEndian.AppendUint16(e.buf, t.id)
+	e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(len(t.elements)))
+	for _, el := range t.elements {
+		e.buf = binary.BigEndian.AppendUint16(e.buf, el.id)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, el.length)
+	}
+	e.closeSet()
+	e.records++
+	t.sent = true
+}
+
+// Flush sends the current packet, if it holds any records.
+func (e *Exporter) Flush() error {
+	if e.records == 0 {
+		return nil
+	}
+	e.closeSet()
+
+	now := time.Now()
+	b := e.buf
+	if e.opts.Version == collector.NetflowV9 {
+		binary.BigEndian.PutUint16(b[0:], collector.NetflowV9)
+		binary.BigEndian.PutUint16(b[2:], uint16(e.records))
+		binary.BigEndian.PutUint32(b[4:], uint32(now.Sub(e.start).Milliseconds()))
+		binary.BigEndian.PutUint32(b[8:], uint32(now.Unix()))
+		binary.BigEndian.PutUint32(b[12:], e.sequence)
+		binary.BigEndian.PutUint32(b[16:], e.opts.ObservationDomain)
+		e.buf = b[:v9HeaderLen]
+		// The NetFlow v9 sequence number counts packets.
+		e.sequence++
+	} else {
+		binary.BigEndian.PutUint16(b[0:], collector.IPFIX)
+		binary.BigEndian.PutUint16(b[2:], uint16(len(b)))
+		binary.BigEndian.PutUint32(b[4:], uint32(now.Unix()))
+		binary.BigEndian.PutUint32(b[8:], e.sequence)
+		binary.BigEndian.PutUint32(b[12:], e.opts.ObservationDomain)
+		e.buf = b[:ipfixHeaderLen]
+		// The IPFIX sequence number counts data records.
+		e.sequence += uint32(e.dataRecords)
+	}
+	e.records, e.dataRecords = 0, 0
+
+	_, err := e.w.Write(b)
+	e.stats.Packets++
+	if e.stats.Packets%uint64(e.opts.TemplateRefresh) == 0 {
+		for _, t := range e.templates {
+			t.sent = false
+		}
+	}
+	return err
+}
+
+// pace waits until the flow may be sent. The buffered flows are sent before
+// waiting, so they are not delayed.
+func (e *Exporter) pace(ctx context.Context, f *flow.Flow) error {
+	var at time.Time
+	if e.opts.Replay && f.Present.Has(fields.First) {
+		if e.replayStart.IsZero() {
+			e.replayStart, e.replayFirst = time.Now(), f.First
+		}
+		at = e.replayStart.Add(time.Duration(float64(f.First.Sub(e.replayFirst)) / e.opts.Speed))
+	}
+	if e.opts.Rate > 0 {
+		if e.rateStart.IsZero() {
+			e.rateStart = time.Now()
+		}
+		next := e.rateStart.Add(time.Duration(float64(e.stats.Flows) / e.opts.Rate * float64(time.Second)))
+		if next.After(at) {
+			at = next
+		}
+	}
+
+	d := time.Until(at)
+	if d <= 0 {
+		return nil
+	}
+	if err := e.Flush(); err != nil {
+		return err
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
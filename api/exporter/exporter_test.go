@@ -0,0 +1,274 @@
+package exporter_test
+
+import (
+	"context"
+	"io"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/matejnesuta/libnf-go/api/collector"
+	"github.com/matejnesuta/libnf-go/api/errors"
+	"github.com/matejnesuta/libnf-go/api/exporter"
+	"github.com/matejnesuta/libnf-go/api/fields"
+	"github.com/matejnesuta/libnf-go/api/file"
+	"github.com/matejnesuta/libnf-go/api/flow"
+	"github.com/matejnesuta/libnf-go/api/record"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// packets stores every packet written by an exporter.
+type packets [][]byte
+
+func (p *packets) Write(b []byte) (int, error) {
+	*p = append(*p, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+var first = time.UnixMilli(1496001019000)
+
+func testFlow(i int, src string) flow.Flow {
+	f := flow.Flow{
+		First:    first.Add(time.Duration(i) * 100 * time.Millisecond),
+		Last:     first.Add(time.Duration(i)*100*time.Millisecond + time.Second),
+		Bytes:    uint64(1000 + i),
+		Packets:  uint64(10 + i),
+		SrcPort:  uint16(1024 + i),
+		DstPort:  80,
+		TcpFlags: 0x1b,
+		Prot:     6,
+		SrcAddr:  netip.MustParseAddr(src),
+		DstAddr:  netip.MustParseAddr(src).Next(),
+		SrcAS:    65000,
+		InSrcMac: flow.MAC{0, 1, 2, 3, 4, 5},
+	}
+	f.MplsLabel[1] = 0x12345
+	f.MarkNonZero()
+	return f
+}
+
+func decode(t *testing.T, p packets) []flow.Flow {
+	d := collector.NewDecoder()
+	var flows []flow.Flow
+	for _, packet := range p {
+		var err error
+		flows, err = d.Decode(netip.MustParseAddr("127.0.0.1"), packet, flows)
+		assert.Equal(t, nil, err)
+	}
+	return flows
+}
+
+func assertFlow(t *testing.T, want flow.Flow, got flow.Flow) {
+	assert.Equal(t, want.First.UnixMilli(), got.First.UnixMilli())
+	assert.Equal(t, want.Last.UnixMilli(), got.Last.UnixMilli())
+	assert.Equal(t, want.Bytes, got.Bytes)
+	assert.Equal(t, want.Packets, got.Packets)
+	assert.Equal(t, want.SrcPort, got.SrcPort)
+	assert.Equal(t, want.DstPort, got.DstPort)
+	assert.Equal(t, want.TcpFlags, got.TcpFlags)
+	assert.Equal(t, want.Prot, got.Prot)
+	assert.Equal(t, want.SrcAddr, got.SrcAddr)
+	assert.Equal(t, want.DstAddr, got.DstAddr)
+	assert.Equal(t, want.SrcAS, got.SrcAS)
+	assert.Equal(t, want.InSrcMac, got.InSrcMac)
+	assert.Equal(t, want.MplsLabel, got.MplsLabel)
+}
+
+func TestExportVersions(t *testing.T) {
+	for _, version := range []uint16{collector.NetflowV9, collector.IPFIX} {
+		var p packets
+		e, err := exporter.New(&p, exporter.Options{Version: version, ObservationDomain: 7})
+		assert.Equal(t, nil, err)
+
+		want := []flow.Flow{testFlow(0, "192.168.0.1"), testFlow(1, "2001:db8::1"), testFlow(2, "192.168.0.3")}
+		for i := range want {
+			assert.Equal(t, nil, e.WriteFlow(&want[i]))
+		}
+		assert.Equal(t, 0, len(p))
+		assert.Equal(t, nil, e.Flush())
+		assert.Equal(t, 1, len(p))
+		assert.Equal(t, exporter.Stats{Packets: 1, Flows: 3, Templates: 2}, e.Stats())
+
+		got := decode(t, p)
+		assert.Equal(t, len(want), len(got))
+		for i := range got {
+			assertFlow(t, want[i], got[i])
+		}
+	}
+}
+
+func TestExportTemplateIDs(t *testing.T) {
+	e, err := exporter.New(io.Discard, exporter.Options{})
+	assert.Equal(t, nil, err)
+
+	// Every subset of the fields needs a template of its own.
+	set := []int{
+		fields.SrcMask, fields.DstMask, fields.Input, fields.Output, fields.SrcAS, fields.DstAS,
+		fields.BgpNextAdjacentAS, fields.BgpPrevAdjacentAS, fields.IcmpType, fields.IcmpCode,
+		fields.SamplerInterval, fields.SamplerMode, fields.EngineType, fields.EngineId, fields.DstTos, fields.Dir,
+	}
+	var n int
+	for n = 1; n < 1<<len(set); n++ {
+		var f flow.Flow
+		for i, field := range set {
+			if n&(1<<i) != 0 {
+				f.Present.Add(field)
+			}
+		}
+		if err = e.WriteFlow(&f); err != nil {
+			break
+		}
+	}
+	assert.ErrorIs(t, err, errors.ErrTemplateIDs)
+	assert.Equal(t, 65535-256+1, n-1)
+	assert.Equal(t, uint64(65535-256+1), e.Stats().Templates)
+}
+
+func TestExportPacketSize(t *testing.T) {
+	var p packets
+	e, err := exporter.New(&p, exporter.Options{Version: collector.NetflowV9, PacketSize: 512, TemplateRefresh: 3})
+	assert.Equal(t, nil, err)
+
+	var want []flow.Flow
+	for i := range 100 {
+		want = append(want, testFlow(i, "10.0.0.1"))
+		assert.Equal(t, nil, e.WriteFlow(&want[i]))
+	}
+	assert.Equal(t, nil, e.Flush())
+	assert.Less(t, 10, len(p))
+	for _, packet := range p {
+		assert.LessOrEqual(t, len(packet), 512)
+	}
+
+	got := decode(t, p)
+	assert.Equal(t, len(want), len(got))
+	for i := range got {
+		assertFlow(t, want[i], got[i])
+	}
+
+	// The template is sent again after every third packet.
+	flows, err := collector.NewDecoder().Decode(netip.MustParseAddr("127.0.0.1"), p[3], nil)
+	assert.Equal(t, nil, err)
+	assert.NotEqual(t, 0, len(flows))
+	flows, err = collector.NewDecoder().Decode(netip.MustParseAddr("127.0.0.1"), p[4], nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(flows))
+}
+
+func TestExportOptions(t *testing.T) {
+	var p packets
+	_, err := exporter.New(&p, exporter.Options{Version: collector.NetflowV5})
+	assert.ErrorIs(t, err, errors.ErrUnsupportedVersion)
+	_, err = exporter.New(&p, exporter.Options{PacketSize: 32})
+	assert.NotEqual(t, nil, err)
+
+	// Flows without exportable fields are skipped.
+	e, err := exporter.New(&p, exporter.Options{})
+	assert.Equal(t, nil, err)
+	f := flow.Flow{Username: "user"}
+	f.Present.Add(fields.Username)
+	assert.Equal(t, nil, e.WriteFlow(&f))
+	assert.Equal(t, nil, e.Flush())
+	assert.Equal(t, 0, len(p))
+	assert.Equal(t, uint64(1), e.Stats().Skipped)
+}
+
+func TestExportRate(t *testing.T) {
+	var p packets
+	e, err := exporter.New(&p, exporter.Options{Rate: 100})
+	assert.Equal(t, nil, err)
+
+	start := time.Now()
+	for i := range 6 {
+		f := testFlow(i, "10.0.0.1")
+		assert.Equal(t, nil, e.WriteFlow(&f))
+	}
+	assert.Equal(t, nil, e.Flush())
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	// Buffered flows are sent before waiting.
+	assert.Equal(t, 6, len(p))
+}
+
+func TestExportReplay(t *testing.T) {
+	var p packets
+	e, err := exporter.New(&p, exporter.Options{Replay: true, Speed: 5})
+	assert.Equal(t, nil, err)
+
+	// The flows start 100 ms apart, which is 20 ms at five times the speed.
+	start := time.Now()
+	for _, i := range []int{0, 1, 1, 4} {
+		f := testFlow(i, "10.0.0.1")
+		assert.Equal(t, nil, e.WriteFlow(&f))
+	}
+	assert.Equal(t, nil, e.Flush())
+	assert.GreaterOrEqual(t, time.Since(start), 80*time.Millisecond)
+	assert.Equal(t, 3, len(p))
+}
+
+func TestExportLoopback(t *testing.T) {
+	c, err := collector.Listen("127.0.0.1:0")
+	assert.Equal(t, nil, err)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	received := make(chan int)
+	go c.RunFlows(ctx, func(flows []flow.Flow) error {
+		received <- len(flows)
+		return nil
+	})
+
+	e, err := exporter.Dial(c.Addr().String(), exporter.Options{Version: collector.IPFIX})
+	assert.Equal(t, nil, err)
+	defer e.Close()
+
+	var f file.File
+	err = f.OpenRead("../testfiles/nfcapd.201705281555", false, false)
+	assert.Equal(t, nil, err)
+	defer f.Close()
+
+	done := make(chan struct{})
+	go func() {
+		n, err := e.Export(ctx, f.Records())
+		assert.Equal(t, nil, err)
+		assert.Equal(t, 2035, n)
+		close(done)
+	}()
+
+	total := 0
+	for total < 2035 {
+		select {
+		case n := <-received:
+			total += n
+		case <-ctx.Done():
+			t.Fatalf("received %d flows before timing out", total)
+		}
+	}
+	<-done
+	assert.Equal(t, uint64(2035), c.Stats().Flows)
+}
+
+func TestExportCanceled(t *testing.T) {
+	rec, err := record.NewRecord()
+	assert.Equal(t, nil, err)
+	defer rec.Free()
+	f := testFlow(0, "10.0.0.1")
+	assert.Equal(t, nil, rec.FromFlow(&f))
+
+	var p packets
+	e, err := exporter.New(&p, exporter.Options{Rate: 1})
+	assert.Equal(t, nil, err)
+
+	// The second record has to wait a second for the rate limit.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	endless := func(yield func(*record.Record, error) bool) {
+		for yield(&rec, nil) {
+		}
+	}
+	n, err := e.Export(ctx, endless)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 1, len(p))
+}
@@ -2,6 +2,7 @@ package fields
 
 import (
 	"net"
+	"net/netip"
 	"time"
 
 	"github.com/matejnesuta/libnf-go/internal"
@@ -231,5 +232,5 @@ var FieldTypes = map[int]any{
 }
 
 type FldDataType interface {
-	uint8 | uint16 | uint32 | uint64 | net.IP | time.Time | net.HardwareAddr | BasicRecord1 | Acl | Mpls | string
+	uint8 | uint16 | uint32 | uint64 | float64 | net.IP | netip.Addr | netip.Prefix | time.Time | net.HardwareAddr | BasicRecord1 | Acl | Mpls | string
 }
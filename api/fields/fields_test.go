@@ -0,0 +1,108 @@
+package fields_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/matejnesuta/libnf-go/api/errors"
+	"github.com/matejnesuta/libnf-go/api/fields"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryCoversFieldTypes(t *testing.T) {
+	for field, value := range fields.FieldTypes {
+		if field == fields.Term {
+			continue
+		}
+		info, ok := fields.Lookup(field)
+		assert.Equal(t, true, ok, "field %d", field)
+		assert.Equal(t, reflect.TypeOf(value), info.Type)
+		assert.NotEqual(t, "", info.Name)
+		assert.NotEqual(t, "", info.Description)
+	}
+	assert.Equal(t, len(fields.FieldTypes)-1, len(fields.All()))
+}
+
+func TestNamesAreUnique(t *testing.T) {
+	for _, info := range fields.All() {
+		field, ok := fields.ByName(info.Name)
+		assert.Equal(t, true, ok)
+		assert.Equal(t, info.Field, field, info.Name)
+	}
+}
+
+func TestName(t *testing.T) {
+	assert.Equal(t, "srcip", fields.Name(fields.SrcAddr))
+	assert.Equal(t, "dstport", fields.Name(fields.DstPort))
+	assert.Equal(t, "bytes", fields.Name(fields.Doctets))
+	assert.Equal(t, "", fields.Name(-1))
+}
+
+func TestByName(t *testing.T) {
+	field, ok := fields.ByName("srcip")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, fields.SrcAddr, field)
+
+	field, ok = fields.ByName("SA")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, fields.SrcAddr, field)
+
+	field, ok = fields.ByName("packets")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, fields.DpktsAlias, field)
+
+	_, ok = fields.ByName("nonexistent")
+	assert.Equal(t, false, ok)
+}
+
+func TestAliasInfo(t *testing.T) {
+	info, ok := fields.Lookup(fields.DpktsAlias)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, true, info.IsAlias())
+	assert.Equal(t, fields.Dpkts, info.Canonical)
+	assert.Equal(t, fields.AggrSum, info.DefaultAggr)
+
+	info, _ = fields.Lookup(fields.Dpkts)
+	assert.Equal(t, false, info.IsAlias())
+	assert.Contains(t, info.Aliases, "packets")
+}
+
+func TestComputedAndPairFields(t *testing.T) {
+	info, _ := fields.Lookup(fields.CalcBps)
+	assert.Equal(t, true, info.Computed)
+	assert.Equal(t, false, info.Pair)
+
+	info, _ = fields.Lookup(fields.PairPort)
+	assert.Equal(t, true, info.Pair)
+	assert.Equal(t, false, info.Computed)
+
+	info, _ = fields.Lookup(fields.SrcPort)
+	assert.Equal(t, false, info.Computed)
+	assert.Equal(t, false, info.Pair)
+	assert.Equal(t, fields.AggrKey, info.DefaultAggr)
+	assert.Equal(t, fields.SortAsc, info.DefaultSort)
+}
+
+func TestParse(t *testing.T) {
+	field, bits, bits6, err := fields.Parse("srcip/24/64")
+	assert.Nil(t, err)
+	assert.Equal(t, fields.SrcAddr, field)
+	assert.Equal(t, 24, bits)
+	assert.Equal(t, 64, bits6)
+
+	field, bits, bits6, err = fields.Parse("dstport")
+	assert.Nil(t, err)
+	assert.Equal(t, fields.DstPort, field)
+	assert.Equal(t, 0, bits)
+	assert.Equal(t, 0, bits6)
+
+	_, _, _, err = fields.Parse("nonexistent/24")
+	assert.ErrorIs(t, err, errors.ErrUnknownFld)
+
+	_, _, _, err = fields.Parse("srcip/abc")
+	assert.NotNil(t, err)
+
+	_, _, _, err = fields.Parse("srcip/24/64/1")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,277 @@
+package fields
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/matejnesuta/libnf-go/api/errors"
+)
+
+// Aggregation types used for Info.DefaultAggr. They have the same values as the
+// corresponding constants of the memheapv2 package.
+const (
+	AggrMin int = 1
+	AggrMax int = 2
+	AggrSum int = 3
+	AggrOr  int = 4
+	AggrKey int = 8
+)
+
+// Sort types used for Info.DefaultSort. They have the same values as the
+// corresponding constants of the memheapv2 package.
+const (
+	SortNone int = 0
+	SortAsc  int = 16
+	SortDesc int = 32
+)
+
+// Info describes a libnf field.
+type Info struct {
+	Field       int          // Field constant, e.g. SrcAddr.
+	Name        string       // Name used by libnf and nfdump, e.g. "srcip".
+	Aliases     []string     // Other accepted names, e.g. the nfdump output format tokens.
+	Description string       // Short human readable description.
+	Type        reflect.Type // Go type of the field value, as in FieldTypes.
+	Canonical   int          // Field this field is an alias of, or Field itself.
+	Computed    bool         // The value is computed from other fields (e.g. CalcBps).
+	Pair        bool         // The field matches either the source or the destination field.
+	DefaultAggr int          // Aggregation used by default (AggrKey, AggrSum, ...).
+	DefaultSort int          // Sort order used by default (SortAsc, SortDesc or SortNone).
+}
+
+// IsAlias reports whether the field is an alias sharing the value of another field.
+func (i Info) IsAlias() bool {
+	return i.Canonical != i.Field
+}
+
+type infoFlag int
+
+const (
+	computed infoFlag = 1 << iota
+	pair
+)
+
+type entry struct {
+	field       int
+	name        string
+	aliases     []string
+	description string
+	canonical   int
+	flags       infoFlag
+	aggr        int
+	sort        int
+}
+
+func fld(field int, name string, aggr int, sort int, description string, aliases ...string) entry {
+	return entry{field: field, name: name, aliases: aliases, description: description, canonical: field, aggr: aggr, sort: sort}
+}
+
+func alias(field int, name string, of int) entry {
+	return entry{field: field, name: name, canonical: of}
+}
+
+func (e entry) with(flags infoFlag) entry {
+	e.flags |= flags
+	return e
+}
+
+var entries = []entry{
+	fld(First, "first", AggrMin, SortAsc, "Timestamp of the first packet of the flow", "ts", "tstart"),
+	fld(Last, "last", AggrMax, SortDesc, "Timestamp of the last packet of the flow", "te", "tend"),
+	fld(Received, "received", AggrMax, SortAsc, "Timestamp the flow was received by the collector", "tr"),
+	fld(Doctets, "bytes", AggrSum, SortDesc, "Number of bytes", "ibyt", "octets"),
+	fld(Dpkts, "pkts", AggrSum, SortDesc, "Number of packets", "ipkt"),
+	alias(DpktsAlias, "packets", Dpkts),
+	fld(OutBytes, "outbytes", AggrSum, SortDesc, "Number of output bytes", "obyt"),
+	fld(OutPkts, "outpkts", AggrSum, SortDesc, "Number of output packets", "opkt"),
+	alias(OutPktsAlias, "outpackets", OutPkts),
+	fld(AggrFlows, "flows", AggrSum, SortDesc, "Number of aggregated flows", "fl"),
+	fld(SrcPort, "srcport", AggrKey, SortAsc, "Source port", "sp"),
+	fld(DstPort, "dstport", AggrKey, SortAsc, "Destination port", "dp"),
+	fld(TcpFlags, "tcpflags", AggrOr, SortAsc, "Cumulative TCP flags", "flg"),
+	alias(TcpFlagsAlias, "flags", TcpFlags),
+	fld(SrcAddr, "srcip", AggrKey, SortAsc, "Source IP address", "sa"),
+	fld(DstAddr, "dstip", AggrKey, SortAsc, "Destination IP address", "da"),
+	alias(SrcAddrAlias, "srcaddr", SrcAddr),
+	alias(DstAddrAlias, "dstaddr", DstAddr),
+	fld(IpNextHop, "nexthop", AggrKey, SortAsc, "IP address of the next hop router", "nh"),
+	alias(IpNextHopAlias, "ipnexthop", IpNextHop),
+	fld(SrcMask, "srcmask", AggrKey, SortAsc, "Source network mask", "smk"),
+	fld(DstMask, "dstmask", AggrKey, SortAsc, "Destination network mask", "dmk"),
+	fld(Tos, "tos", AggrKey, SortAsc, "Source type of service", "stos"),
+	fld(DstTos, "dsttos", AggrKey, SortAsc, "Destination type of service", "dtos"),
+	fld(SrcAS, "srcas", AggrKey, SortAsc, "Source AS number", "sas"),
+	fld(DstAS, "dstas", AggrKey, SortAsc, "Destination AS number", "das"),
+	fld(BgpNextAdjacentAS, "nextas", AggrKey, SortAsc, "BGP next adjacent AS number", "nas"),
+	fld(BgpPrevAdjacentAS, "prevas", AggrKey, SortAsc, "BGP previous adjacent AS number", "pas"),
+	fld(BgpNextHop, "bgpnexthop", AggrKey, SortAsc, "IP address of the BGP next hop", "nhb"),
+	fld(Prot, "proto", AggrKey, SortAsc, "IP protocol", "pr", "prot"),
+	fld(SrcVlan, "srcvlan", AggrKey, SortAsc, "Source VLAN", "svln"),
+	fld(DstVlan, "dstvlan", AggrKey, SortAsc, "Destination VLAN", "dvln"),
+	fld(InSrcMac, "insrcmac", AggrKey, SortAsc, "Input source MAC address", "ismc"),
+	fld(OutSrcMac, "outsrcmac", AggrKey, SortAsc, "Output source MAC address", "osmc"),
+	fld(InDstMac, "indstmac", AggrKey, SortAsc, "Input destination MAC address", "idmc"),
+	fld(OutDstMac, "outdstmac", AggrKey, SortAsc, "Output destination MAC address", "odmc"),
+	fld(MplsLabel, "mpls", AggrKey, SortNone, "MPLS labels"),
+	fld(Input, "inif", AggrKey, SortAsc, "SNMP index of the input interface", "in"),
+	fld(Output, "outif", AggrKey, SortAsc, "SNMP index of the output interface", "out"),
+	fld(Dir, "dir", AggrKey, SortAsc, "Flow direction"),
+	fld(FwdStatus, "fwd", AggrKey, SortAsc, "Forwarding status"),
+	fld(IpRouter, "router", AggrKey, SortAsc, "IP address of the exporting router", "ra"),
+	alias(IpRouterAlias, "iprouter", IpRouter),
+	fld(EngineType, "systype", AggrKey, SortAsc, "Type of the flow switching engine"),
+	fld(EngineId, "sysid", AggrKey, SortAsc, "ID of the flow switching engine"),
+	alias(EngineTypeAlias, "engine-type", EngineType),
+	alias(EngineIdAlias, "engine-id", EngineId),
+	fld(EventTime, "eventtime", AggrMin, SortAsc, "Timestamp of the NSEL event"),
+	fld(ConnId, "connid", AggrKey, SortAsc, "NSEL connection ID"),
+	fld(IcmpCode, "icmpcode", AggrKey, SortAsc, "ICMP code"),
+	fld(IcmpType, "icmptype", AggrKey, SortAsc, "ICMP type"),
+	alias(IcmpCodeAlias, "icmp-code", IcmpCode),
+	alias(IcmpTypeAlias, "icmp-type", IcmpType),
+	fld(FwXEvent, "xevent", AggrKey, SortAsc, "NSEL extended event"),
+	fld(FwEvent, "event", AggrKey, SortAsc, "NSEL event"),
+	fld(XlateSrcIp, "xsrcip", AggrKey, SortAsc, "NAT translated source IP address", "xsa"),
+	fld(XlateDstIp, "xdstip", AggrKey, SortAsc, "NAT translated destination IP address", "xda"),
+	fld(XlateSrcPort, "xsrcport", AggrKey, SortAsc, "NAT translated source port", "xsp"),
+	fld(XlateDstPort, "xdstport", AggrKey, SortAsc, "NAT translated destination port", "xdp"),
+	fld(IngressAclId, "iacl", AggrKey, SortAsc, "Ingress ACL ID"),
+	fld(IngressAceId, "iace", AggrKey, SortAsc, "Ingress ACE ID"),
+	fld(IngressXaceId, "ixace", AggrKey, SortAsc, "Ingress extended ACE ID"),
+	fld(IngressAcl, "ingressacl", AggrKey, SortAsc, "Ingress ACL (ACL, ACE and extended ACE ID)"),
+	fld(EgressAclId, "eacl", AggrKey, SortAsc, "Egress ACL ID"),
+	fld(EgressAceId, "eace", AggrKey, SortAsc, "Egress ACE ID"),
+	fld(EgressXaceId, "exace", AggrKey, SortAsc, "Egress extended ACE ID"),
+	fld(EgressAcl, "egressacl", AggrKey, SortAsc, "Egress ACL (ACL, ACE and extended ACE ID)"),
+	fld(Username, "username", AggrKey, SortAsc, "NSEL user name", "uname"),
+	fld(IngressVrfid, "ingressvrfid", AggrKey, SortAsc, "Ingress VRF ID", "ivrf"),
+	fld(EventFlag, "eventflag", AggrKey, SortAsc, "NEL event flag"),
+	fld(EgressVrfid, "egressvrfid", AggrKey, SortAsc, "Egress VRF ID", "evrf"),
+	fld(BlockStart, "blockstart", AggrKey, SortAsc, "NAT port block start", "pbstart"),
+	fld(BlockEnd, "blockend", AggrKey, SortAsc, "NAT port block end", "pbend"),
+	fld(BlockStep, "blockstep", AggrKey, SortAsc, "NAT port block step", "pbstep"),
+	fld(BlockSize, "blocksize", AggrKey, SortAsc, "NAT port block size", "pbsize"),
+	fld(ClientNwDelayUsec, "cl", AggrKey, SortAsc, "Client network delay in microseconds"),
+	fld(ServerNwDelayUsec, "sl", AggrKey, SortAsc, "Server network delay in microseconds"),
+	fld(ApplLatencyUsec, "al", AggrKey, SortAsc, "Application latency in microseconds"),
+	fld(InetFamily, "inetfamily", AggrKey, SortAsc, "Address family of the flow addresses (AF_INET or AF_INET6)"),
+	fld(ExporterIp, "exporterip", AggrKey, SortAsc, "IP address of the exporter"),
+	fld(ExporterId, "exporterid", AggrKey, SortAsc, "ID of the exporter"),
+	fld(ExporterVersion, "exporterversion", AggrKey, SortAsc, "NetFlow version of the exporter"),
+	fld(SequenceFailures, "seqfailures", AggrSum, SortAsc, "Number of sequence failures"),
+	fld(SamplerMode, "samplermode", AggrKey, SortAsc, "Sampling mode"),
+	fld(SamplerInterval, "samplerinterval", AggrKey, SortAsc, "Sampling interval"),
+	fld(SamplerId, "samplerid", AggrKey, SortAsc, "Sampler ID"),
+	fld(CalcDuration, "duration", AggrSum, SortAsc, "Duration of the flow in milliseconds", "td").with(computed),
+	fld(CalcBps, "bps", AggrSum, SortDesc, "Bits per second").with(computed),
+	fld(CalcPps, "pps", AggrSum, SortDesc, "Packets per second").with(computed),
+	fld(CalcBpp, "bpp", AggrSum, SortAsc, "Bytes per packet").with(computed),
+	fld(Brec1, "brec1", AggrKey, SortNone, "Basic record with the most common fields"),
+	fld(PairPort, "port", AggrKey, SortNone, "Source or destination port").with(pair),
+	fld(PairAddr, "ip", AggrKey, SortNone, "Source or destination IP address").with(pair),
+	alias(PairAddrAlias, "addr", PairAddr),
+	fld(PairAs, "as", AggrKey, SortNone, "Source or destination AS number").with(pair),
+	fld(PairIf, "if", AggrKey, SortNone, "Input or output interface").with(pair),
+	fld(PairVlan, "vlan", AggrKey, SortNone, "Source or destination VLAN").with(pair),
+}
+
+var (
+	registry map[int]*Info
+	byName   map[string]int
+	ordered  []Info
+)
+
+func init() {
+	registry = make(map[int]*Info, len(entries))
+	byName = make(map[string]int, 2*len(entries))
+	ordered = make([]Info, len(entries))
+	for i, e := range entries {
+		info := Info{
+			Field:       e.field,
+			Name:        e.name,
+			Aliases:     e.aliases,
+			Description: e.description,
+			Type:        reflect.TypeOf(FieldTypes[e.field]),
+			Canonical:   e.canonical,
+			Computed:    e.flags&computed != 0,
+			Pair:        e.flags&pair != 0,
+			DefaultAggr: e.aggr,
+			DefaultSort: e.sort,
+		}
+		ordered[i] = info
+		registry[e.field] = &ordered[i]
+		byName[e.name] = e.field
+	}
+	// Aliases of canonical fields and the properties inherited by alias fields.
+	for i := range ordered {
+		info := &ordered[i]
+		if info.IsAlias() {
+			canonical := registry[info.Canonical]
+			info.Description = canonical.Description
+			info.Computed = canonical.Computed
+			info.Pair = canonical.Pair
+			info.DefaultAggr = canonical.DefaultAggr
+			info.DefaultSort = canonical.DefaultSort
+			canonical.Aliases = append(canonical.Aliases, info.Name)
+		}
+		for _, name := range info.Aliases {
+			if _, ok := byName[name]; !ok {
+				byName[name] = info.Field
+			}
+		}
+	}
+}
+
+// Lookup returns the description of the field.
+func Lookup(field int) (Info, bool) {
+	info, ok := registry[field]
+	if !ok {
+		return Info{}, false
+	}
+	return *info, true
+}
+
+// All returns the descriptions of all fields in the order of the field constants.
+func All() []Info {
+	return append([]Info(nil), ordered...)
+}
+
+// Name returns the libnf name of the field (e.g. "srcip" for SrcAddr),
+// or an empty string for an unknown field.
+func Name(field int) string {
+	if info, ok := registry[field]; ok {
+		return info.Name
+	}
+	return ""
+}
+
+// ByName returns the field with the given name. Both libnf names and their
+// aliases (e.g. "srcip" and "sa") are accepted, ignoring case.
+func ByName(name string) (int, bool) {
+	field, ok := byName[strings.ToLower(name)]
+	return field, ok
+}
+
+// Parse parses a field specification in the form used by libnf and nfdump,
+// a field name optionally followed by the number of bits for IPv4 and IPv6
+// addresses (e.g. "srcip/24/64"). The bits are returned as 0 if missing.
+func Parse(spec string) (field int, numBits int, numBits6 int, err error) {
+	parts := strings.Split(spec, "/")
+	if len(parts) > 3 {
+		return 0, 0, 0, fmt.Errorf("fields: invalid field specification %q", spec)
+	}
+	field, ok := ByName(strings.TrimSpace(parts[0]))
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("%w: %q", errors.ErrUnknownFld, parts[0])
+	}
+	bits := []*int{&numBits, &numBits6}
+	for i, part := range parts[1:] {
+		*bits[i], err = strconv.Atoi(part)
+		if err != nil || *bits[i] < 0 || *bits[i] > 128 {
+			return 0, 0, 0, fmt.Errorf("fields: invalid number of bits %q in %q", part, spec)
+		}
+	}
+	return field, numBits, numBits6, nil
+}
@@ -5,10 +5,15 @@ import (
 	"unsafe"
 
 	"github.com/matejnesuta/libnf-go/api/errors"
+	"github.com/matejnesuta/libnf-go/api/internal/handle"
 	"github.com/matejnesuta/libnf-go/internal"
 )
 import (
 	"bytes"
+	"context"
+	"iter"
+	"os"
+	"runtime"
 	"time"
 
 	"github.com/matejnesuta/libnf-go/api/record"
@@ -16,18 +21,48 @@ import (
 
 // File struct represents an Nfdump. It provides methods to open, read, write, and retrieve metadata about the file.
 type File struct {
-	ptr    uintptr // Pointer to the underlying file structure.
-	opened bool    // Indicates whether the file is currently opened.
+	// Shared by all copies. Holds the pointer to the underlying file structure,
+	// which changes when a file in read loop mode is reopened.
+	h *handle.Handle
+
+	readLoop     bool          // Indicates whether the file was opened with readLoop.
+	path         string        // Path the file was opened with.
+	flags        uint          // Flags used to open a file with readLoop.
+	stat         os.FileInfo   // Identity of the file currently being read in read loop mode.
+	changed      bool          // The path was replaced or deleted before the last read.
+	missing      int           // Consecutive polls without a file to switch to.
+	pollInterval time.Duration // How often a file in read loop mode is checked for new data.
+
+	skipped SkipCounters // Weak errors reported while reading.
 }
 
+// SkipCounters holds the number of blocks and records that libnf skipped while
+// reading a file, because they were unknown or damaged.
+type SkipCounters struct {
+	Blocks  uint64 // Skipped blocks (unknown or nfdump 1.5 block types).
+	Records uint64 // Skipped records of unknown type.
+}
+
+// DefaultPollInterval is the default interval in which a file opened with readLoop
+// is checked for new records once all present records have been read.
+const DefaultPollInterval = time.Second
+
+// deleteGracePolls is the number of polls after which a file opened with
+// readLoop counts as deleted, when no readable file appeared at its path.
+// nfcapd renames the file and creates a new one, so the path is missing or
+// holds an incomplete file for a moment.
+const deleteGracePolls = 3
+
 // GetPtr returns the pointer to the file.
 func (f *File) GetPtr() uintptr {
-	return f.ptr
+	return f.h.Ptr()
 }
 
-// Opened returns whether the file is currently opened.
+// Opened returns whether the file is currently opened. Copies of a File share
+// its state, so closing any copy closes all of them, and a file reopened after
+// rotation in read loop mode is reopened for all of them.
 func (f *File) Opened() bool {
-	return f.opened
+	return !f.h.Released()
 }
 
 // A list of possible compression types, which can be used with the OpenWrite method.
@@ -37,36 +72,48 @@ const (
 	CompBZ2 int = internal.COMP_BZ2 // BZ2 compression.
 )
 
-func getInfo(info int, f *File) ([]byte, error) {
-	if !f.opened {
-		return nil, errors.ErrFileNotOpened
-	}
-	buf := make([]byte, internal.INFO_BUFSIZE)
+func readInfo(info int, f *File, buf []byte) error {
 	data := uintptr(unsafe.Pointer(&buf[0]))
 
-	status := internal.Info(f.ptr, info, data, int64(len(buf)))
+	status := internal.Info(f.h.Ptr(), info, data, int64(len(buf)))
+	runtime.KeepAlive(f)
 
 	switch status {
 	case internal.ERR_NOMEM:
-		return nil, errors.ErrNoMem
+		return errors.ErrNoMem
 	case internal.ERR_OTHER:
-		return nil, errors.ErrOther
+		return errors.Wrap("info", f.path, status, errors.ErrOther)
 	default:
-		return buf, nil
+		return nil
 	}
 }
 
-func getStringInfo(info int, f *File) (string, error) {
-	buf, err := getInfo(info, f)
-	if err != nil {
-		return "", err
+func getInfo(info int, f *File) ([]byte, error) {
+	if !f.Opened() {
+		return nil, errors.ErrFileNotOpened
+	}
+	buf := make([]byte, internal.INFO_BUFSIZE)
+	if err := readInfo(info, f, buf); err != nil {
+		return nil, err
 	}
+	return buf, nil
+}
+
+func bufToString(buf []byte) string {
 	// Look for null terminator
 	n := bytes.IndexByte(buf, 0)
 	if n < 0 {
 		n = len(buf)
 	}
-	return string(buf[:n]), nil
+	return string(buf[:n])
+}
+
+func getStringInfo(info int, f *File) (string, error) {
+	buf, err := getInfo(info, f)
+	if err != nil {
+		return "", err
+	}
+	return bufToString(buf), nil
 }
 
 func getBoolInfo(info int, f *File) (bool, error) {
@@ -74,7 +121,7 @@ func getBoolInfo(info int, f *File) (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	val := *(*int)(unsafe.Pointer(&buf[0]))
+	val := *(*int32)(unsafe.Pointer(&buf[0]))
 	return val != 0, nil
 }
 
@@ -212,45 +259,78 @@ func (f *File) GetCompressionType() (int, error) {
 // OpenRead initializes and opens the file in read mode.
 // If readLoop is true, the file is read in an endless loop, useful for
 // reading files like open nfcapd.nnnn files that are still being written.
-// If the file is replaced, it will reopen automatically. The loop ends
-// when the file is permanently deleted.
+// If the file is replaced, the rest of it is read and the new file is opened
+// automatically. The loop ends when the file is deleted and no new file
+// appears at its path within three poll intervals.
 // If weakErr is true, weak read errors (e.g. unknown block) are also reported.
+//
+// The read loop is driven from Go by polling the file for new records, so a
+// blocked read can be interrupted with GetNextRecordContext.
 func (f *File) OpenRead(inputFile string, readLoop bool, weakErr bool) error {
-	if f.opened {
+	if f.Opened() {
 		return errors.ErrFileAlreadyOpened
 	}
 
 	flags := internal.READ
-	if readLoop {
-		flags |= internal.READ_LOOP
-	}
 	if weakErr {
 		flags |= internal.WEAKERR
 	}
-	status := internal.Open(&f.ptr, inputFile, uint(flags), "")
+	var ptr uintptr
+	status := internal.Open(&ptr, inputFile, uint(flags), "")
 	if status != internal.OK {
-		return errors.ErrCannotOpenFile
+		return errors.Wrap("open", inputFile, status, errors.ErrCannotOpenFile)
+	}
+	f.h = handle.New("File", ptr, internal.Close)
+	f.skipped = SkipCounters{}
+	f.path = inputFile
+	f.readLoop = readLoop
+	f.changed, f.missing = false, 0
+	if readLoop {
+		f.flags = uint(flags)
+		f.stat, _ = os.Stat(inputFile)
+		if f.pollInterval <= 0 {
+			f.pollInterval = DefaultPollInterval
+		}
 	}
-	f.opened = true
 	return nil
 }
 
-// OpenAppend opens the file in append mode for reading. Not implemented yet.
-// If weakErr is true, weak read errors are also reported.
+// SetPollInterval sets how often a file opened with readLoop is checked for
+// new records once all present records have been read.
+// Non-positive values reset the interval to DefaultPollInterval.
+func (f *File) SetPollInterval(d time.Duration) {
+	if d <= 0 {
+		d = DefaultPollInterval
+	}
+	f.pollInterval = d
+}
+
+// OpenAppend opens an existing file in append mode. Records written with
+// WriteRecord are stored after the records already present in the file,
+// so the file does not have to be rewritten.
+// The ident, compression and anonymization of the original file are kept.
+// The statistics reported by GetFlows, GetBytes and the other counters
+// include both the original and the appended records once the file is closed.
+// If weakErr is true, weak errors are also reported.
 func (f *File) OpenAppend(inputFile string, weakErr bool) error {
-	if f.opened {
+	if f.Opened() {
 		return errors.ErrFileAlreadyOpened
 	}
 
-	flags := internal.APPEND
+	// The append flag only modifies the write mode in libnf. Without the
+	// write flag the file would be opened for reading.
+	flags := internal.WRITE | internal.APPEND
 	if weakErr {
 		flags |= internal.WEAKERR
 	}
-	status := internal.Open(&f.ptr, inputFile, uint(flags), "")
+	var ptr uintptr
+	status := internal.Open(&ptr, inputFile, uint(flags), "")
 	if status != internal.OK {
-		return errors.ErrCannotOpenFile
+		return errors.Wrap("open append", inputFile, status, errors.ErrCannotOpenFile)
 	}
-	f.opened = true
+	f.h = handle.New("File", ptr, internal.Close)
+	f.skipped = SkipCounters{}
+	f.path = inputFile
 	return nil
 }
 
@@ -260,7 +340,7 @@ func (f *File) OpenAppend(inputFile string, weakErr bool) error {
 // The comp parameter sets the compression type (NoComp, CompLZO, CompBZ2).
 // If weakErr is true, weak errors are also reported.
 func (f *File) OpenWrite(outputFile string, ident string, anon bool, comp int, weakErr bool) error {
-	if f.opened {
+	if f.Opened() {
 		return errors.ErrFileAlreadyOpened
 	}
 
@@ -277,20 +357,26 @@ func (f *File) OpenWrite(outputFile string, ident string, anon bool, comp int, w
 	if weakErr {
 		flags |= internal.WEAKERR
 	}
-	status := internal.Open(&f.ptr, outputFile, uint(flags), ident)
+	var ptr uintptr
+	status := internal.Open(&ptr, outputFile, uint(flags), ident)
 	if status != internal.OK {
-		return errors.ErrCannotOpenFile
+		return errors.Wrap("open write", outputFile, status, errors.ErrCannotOpenFile)
 	}
-	f.opened = true
+	f.h = handle.New("File", ptr, internal.Close)
+	f.skipped = SkipCounters{}
+	f.path = outputFile
 	return nil
 }
 
 // Close closes the file and releases any associated resources.
 // Returns an error if the file was not open.
 func (file *File) Close() error {
-	if file.opened {
-		internal.Close(file.ptr)
-		file.opened = false
+	if file.Opened() {
+		file.h.Release()
+		internal.Close(file.h.Ptr())
+		file.readLoop = false
+		file.stat = nil
+		file.changed, file.missing = false, 0
 		return nil
 	}
 	return errors.ErrFileNotOpened
@@ -299,16 +385,134 @@ func (file *File) Close() error {
 // GetNextRecord reads the next record from the file into the given record.
 // The record must be previously allocated.
 // Returns an error if EOF is reached or a read error occurs.
+//
+// If the file was opened with weakErr, skipped data is reported with one of
+// ErrUnknownBlock, ErrUnknownRecord, ErrCompat15 or ErrWeak (see errors.IsWeak).
+// The record is not filled in that case, but reading can continue with the next
+// call. Other read errors like ErrCorrupt or ErrRead are returned as *errors.LnfError.
+//
+// For files opened with readLoop, the call blocks until a new record is
+// available or the file is deleted. Use GetNextRecordContext to be able to
+// interrupt it.
 func (file *File) GetNextRecord(r *record.Record) error {
-	if !file.opened {
+	return file.GetNextRecordContext(context.Background(), r)
+}
+
+// GetNextRecordContext works like GetNextRecord, but returns ctx.Err() as
+// soon as the context is canceled or its deadline expires.
+//
+// A file opened with readLoop is polled for new records in the interval set
+// by SetPollInterval, and the waiting between polls is interrupted by ctx.
+// For other files, the context is only checked before the record is read.
+func (file *File) GetNextRecordContext(ctx context.Context, r *record.Record) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := file.read(r)
+		if err != errors.ErrFileEof || !file.readLoop {
+			return err
+		}
+		if file.changed {
+			// The path changed before the last read, so the file was read to
+			// its end and the next one can be opened.
+			if err := file.reopenIfReplaced(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		timer := time.NewTimer(file.pollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		file.changed = file.pathChanged()
+	}
+}
+
+func (file *File) read(r *record.Record) error {
+	if !file.Opened() {
 		return errors.ErrFileNotOpened
 	} else if !r.Allocated() {
 		return errors.ErrRecordNotAllocated
 	}
-	status := internal.Read(file.ptr, r.GetPtr())
-	if status == internal.ERR_NOMEM {
+	status := internal.Read(file.h.Ptr(), r.GetPtr())
+	runtime.KeepAlive(file)
+	runtime.KeepAlive(r)
+	switch status {
+	case internal.OK:
+		return nil
+	case internal.EOF:
+		return errors.ErrFileEof
+	case internal.ERR_NOMEM:
 		return errors.ErrNoMem
-	} else if status == internal.EOF {
+	case internal.ERR_UNKBLOCK:
+		file.skipped.Blocks++
+		return errors.ErrUnknownBlock
+	case internal.ERR_UNKREC:
+		file.skipped.Records++
+		return errors.ErrUnknownRecord
+	case internal.ERR_COMPAT15:
+		file.skipped.Blocks++
+		return errors.ErrCompat15
+	case internal.ERR_READ:
+		return errors.Wrap("read", file.path, status, errors.ErrRead)
+	case internal.ERR_CORRUPT:
+		return errors.Wrap("read", file.path, status, errors.ErrCorrupt)
+	case internal.ERR_EXTMAPB:
+		return errors.Wrap("read", file.path, status, errors.ErrExtMapB)
+	case internal.ERR_EXTMAPM:
+		return errors.Wrap("read", file.path, status, errors.ErrExtMapM)
+	}
+	if status < 0 && status >= internal.ERR_WEAK {
+		// Any other combination of the weak error bits.
+		file.skipped.Blocks++
+		return errors.ErrWeak
+	}
+	return errors.Wrap("read", file.path, status, errors.ErrOther)
+}
+
+// Skipped returns the number of blocks and records skipped since the file was opened.
+//
+// The counters are only updated when the file is opened with weakErr, as libnf
+// skips damaged data silently otherwise.
+func (file *File) Skipped() SkipCounters {
+	return file.skipped
+}
+
+// pathChanged reports whether the file being read in read loop mode was
+// deleted or another file was moved to its place.
+func (file *File) pathChanged() bool {
+	stat, err := os.Stat(file.path)
+	return err != nil || file.stat == nil || !os.SameFile(stat, file.stat)
+}
+
+// reopenIfReplaced opens the file which was moved to the path of the file
+// being read (e.g. after nfcapd rotation). The read loop ends once no file
+// could be opened for deleteGracePolls polls.
+func (file *File) reopenIfReplaced() error {
+	file.changed = false
+	stat, err := os.Stat(file.path)
+	if err == nil {
+		var ptr uintptr
+		status := internal.Open(&ptr, file.path, file.flags, "")
+		if status == internal.OK {
+			// Copies of the file share the handle and continue with the new file.
+			internal.Close(file.h.Ptr())
+			file.h.Replace(ptr)
+			file.stat = stat
+			file.missing = 0
+			return nil
+		}
+		if file.missing+1 >= deleteGracePolls {
+			return errors.Wrap("reopen", file.path, status, errors.ErrCannotOpenFile)
+		}
+	}
+	file.missing++
+	if file.missing >= deleteGracePolls {
 		return errors.ErrFileEof
 	}
 	return nil
@@ -318,16 +522,56 @@ func (file *File) GetNextRecord(r *record.Record) error {
 // The record must be previously allocated.
 // Returns an error if the write fails or memory issues occur.
 func (file *File) WriteRecord(r *record.Record) error {
-	if !file.opened {
+	if !file.Opened() {
 		return errors.ErrFileNotOpened
 	} else if !r.Allocated() {
 		return errors.ErrRecordNotAllocated
 	}
-	status := internal.Write(file.ptr, r.GetPtr())
+	status := internal.Write(file.h.Ptr(), r.GetPtr())
+	runtime.KeepAlive(file)
+	runtime.KeepAlive(r)
 	if status == internal.ERR_NOMEM {
 		return errors.ErrNoMem
 	} else if status == internal.ERR_WRITE {
-		return errors.ErrWrite
+		return errors.Wrap("write", file.path, status, errors.ErrWrite)
 	}
 	return nil
 }
+
+// Records returns an iterator over the remaining records in the file.
+//
+// A single record is allocated for the whole loop and reused for every
+// step, so the yielded record is only valid until the next iteration. Use
+// Record.CopyFrom to keep its contents. The record is freed when the loop ends.
+// Iteration stops silently at the end of the file. Weak errors are yielded together
+// with a nil record and the iteration continues unless the caller breaks out of
+// the loop. Any other error is yielded once together with a nil record and ends
+// the iteration.
+func (file *File) Records() iter.Seq2[*record.Record, error] {
+	return func(yield func(*record.Record, error) bool) {
+		rec, err := record.NewRecord()
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer rec.Free()
+
+		for {
+			err = file.GetNextRecord(&rec)
+			if err == errors.ErrFileEof {
+				return
+			} else if errors.IsWeak(err) {
+				if !yield(nil, err) {
+					return
+				}
+				continue
+			} else if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(&rec, nil) {
+				return
+			}
+		}
+	}
+}
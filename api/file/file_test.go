@@ -1,10 +1,16 @@
 package file_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
 	"testing"
 	"time"
 
 	LnfErr "github.com/matejnesuta/libnf-go/api/errors"
+	LnfFields "github.com/matejnesuta/libnf-go/api/fields"
 	LnfFile "github.com/matejnesuta/libnf-go/api/file"
 	LnfRec "github.com/matejnesuta/libnf-go/api/record"
 
@@ -148,6 +154,23 @@ func TestCloseFileMultipleTimes(t *testing.T) {
 	assert.Equal(t, false, file.Opened())
 }
 
+func TestCloseCopiedFile(t *testing.T) {
+	var file LnfFile.File
+	err := file.OpenRead("../testfiles/nfcapd.201705281555", false, false)
+	assert.Equal(t, nil, err)
+	copied := file
+	assert.Equal(t, true, copied.Opened())
+	assert.Equal(t, nil, copied.Close())
+
+	assert.Equal(t, false, file.Opened())
+	assert.Equal(t, LnfErr.ErrFileNotOpened, file.Close())
+	rec, _ := LnfRec.NewRecord()
+	defer rec.Free()
+	assert.Equal(t, LnfErr.ErrFileNotOpened, file.GetNextRecord(&rec))
+	_, err = file.GetFlows()
+	assert.Equal(t, LnfErr.ErrFileNotOpened, err)
+}
+
 func TestGetInfoFromUnopenedFile(t *testing.T) {
 	var file LnfFile.File
 	_, err := file.GetFlows()
@@ -209,10 +232,182 @@ func TestReadUntilEOF(t *testing.T) {
 	assert.Equal(t, err, LnfErr.ErrFileEof)
 }
 
+func TestReadContextCanceled(t *testing.T) {
+	var file LnfFile.File
+	err := file.OpenRead("../testfiles/test-file.tmp", false, false)
+	assert.Equal(t, nil, err)
+	defer file.Close()
+	rec, _ := LnfRec.NewRecord()
+	defer rec.Free()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = file.GetNextRecordContext(ctx, &rec)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestReadContextWithoutReadLoop(t *testing.T) {
+	var file LnfFile.File
+	err := file.OpenRead("../testfiles/nfcapd.201705281555", false, false)
+	assert.Equal(t, nil, err)
+	defer file.Close()
+	rec, _ := LnfRec.NewRecord()
+	defer rec.Free()
+
+	count := 0
+	for {
+		err = file.GetNextRecordContext(context.Background(), &rec)
+		if err != nil {
+			break
+		}
+		count++
+	}
+	assert.Equal(t, LnfErr.ErrFileEof, err)
+	assert.Equal(t, 2035, count)
+}
+
+func TestReadLoopContextDeadline(t *testing.T) {
+	var file LnfFile.File
+	err := file.OpenRead("../testfiles/nfcapd.201705281555", true, false)
+	assert.Equal(t, nil, err)
+	defer file.Close()
+	rec, _ := LnfRec.NewRecord()
+	defer rec.Free()
+
+	for i := 0; i < 2035; i++ {
+		assert.Equal(t, nil, file.GetNextRecordContext(context.Background(), &rec))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = file.GetNextRecordContext(ctx, &rec)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Less(t, time.Since(start), LnfFile.DefaultPollInterval)
+}
+
+func TestReadLoopDeletedFile(t *testing.T) {
+	data, err := os.ReadFile("../testfiles/test-file.tmp")
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile("../tmp/read-loop.tmp", data, 0644))
+
+	var file LnfFile.File
+	err = file.OpenRead("../tmp/read-loop.tmp", true, false)
+	assert.Equal(t, nil, err)
+	defer file.Close()
+	file.SetPollInterval(10 * time.Millisecond)
+	rec, _ := LnfRec.NewRecord()
+	defer rec.Free()
+
+	for {
+		err = file.GetNextRecordContext(context.Background(), &rec)
+		if err != nil {
+			break
+		}
+		if _, statErr := os.Stat("../tmp/read-loop.tmp"); statErr == nil {
+			os.Remove("../tmp/read-loop.tmp")
+		}
+	}
+	assert.Equal(t, LnfErr.ErrFileEof, err)
+}
+
+func TestReadLoopRotatedFile(t *testing.T) {
+	data, err := os.ReadFile("../testfiles/test-file.tmp")
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile("../tmp/read-rotate.tmp", data, 0644))
+	first, err := LnfFile.Stat("../tmp/read-rotate.tmp")
+	assert.Nil(t, err)
+
+	var file LnfFile.File
+	err = file.OpenRead("../tmp/read-rotate.tmp", true, false)
+	assert.Equal(t, nil, err)
+	defer file.Close()
+	file.SetPollInterval(10 * time.Millisecond)
+	copied, oldPtr := file, file.GetPtr()
+	rec, _ := LnfRec.NewRecord()
+	defer rec.Free()
+
+	read := func() uint64 {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		var count uint64
+		for file.GetNextRecordContext(ctx, &rec) == nil {
+			count++
+		}
+		return count
+	}
+	assert.Equal(t, first.Flows.Total, read())
+
+	// Records appended right before the rotation are read from the old file.
+	var writer LnfFile.File
+	assert.Equal(t, nil, writer.OpenAppend("../tmp/read-rotate.tmp", false))
+	assert.Equal(t, nil, writer.WriteRecord(&rec))
+	assert.Equal(t, nil, writer.Close())
+	assert.Nil(t, os.Rename("../tmp/read-rotate.tmp", "../tmp/read-rotated.tmp"))
+	go func() {
+		// The path is missing for a moment, as during nfcapd rotation.
+		time.Sleep(15 * time.Millisecond)
+		os.WriteFile("../tmp/read-rotate.tmp", data, 0644)
+	}()
+	assert.Equal(t, 1+first.Flows.Total, read())
+
+	// A copy made before the rotation refers to the reopened file.
+	assert.Equal(t, true, copied.Opened())
+	assert.Equal(t, file.GetPtr(), copied.GetPtr())
+	assert.NotEqual(t, oldPtr, copied.GetPtr())
+}
+
+func TestRecordsIterator(t *testing.T) {
+	var file LnfFile.File
+	err := file.OpenRead("../testfiles/nfcapd.201705281555", false, false)
+	assert.Equal(t, nil, err)
+	defer file.Close()
+
+	var count uint64
+	for rec, err := range file.Records() {
+		assert.Equal(t, nil, err)
+		assert.Equal(t, true, rec.Allocated())
+		count++
+	}
+	assert.Equal(t, uint64(2035), count)
+}
+
+func TestRecordsIteratorBreak(t *testing.T) {
+	var file LnfFile.File
+	err := file.OpenRead("../testfiles/nfcapd.201705281555", false, false)
+	assert.Equal(t, nil, err)
+	defer file.Close()
+
+	count := 0
+	for _, err := range file.Records() {
+		assert.Equal(t, nil, err)
+		count++
+		if count == 10 {
+			break
+		}
+	}
+	assert.Equal(t, 10, count)
+
+	rec, _ := LnfRec.NewRecord()
+	defer rec.Free()
+	assert.Equal(t, nil, file.GetNextRecord(&rec))
+}
+
+func TestRecordsIteratorFromUnopenedFile(t *testing.T) {
+	var file LnfFile.File
+	count := 0
+	for rec, err := range file.Records() {
+		assert.Nil(t, rec)
+		assert.Equal(t, LnfErr.ErrFileNotOpened, err)
+		count++
+	}
+	assert.Equal(t, 1, count)
+}
+
 func TestOpenNonexistentFile(t *testing.T) {
 	var file LnfFile.File
 	err := file.OpenRead("nonexistent-file.tmp", false, false)
-	assert.Equal(t, LnfErr.ErrCannotOpenFile, err)
+	assert.ErrorIs(t, err, LnfErr.ErrCannotOpenFile)
 	assert.Equal(t, false, file.Opened())
 }
 
@@ -355,48 +550,373 @@ func TestWriteRecordToOpenedFile(t *testing.T) {
 func TestOpenAppendNonexistentFile(t *testing.T) {
 	var file LnfFile.File
 	err := file.OpenAppend("nonexistent-file.tmp", false)
-	assert.Equal(t, LnfErr.ErrCannotOpenFile, err)
+	assert.ErrorIs(t, err, LnfErr.ErrCannotOpenFile)
 	assert.Equal(t, false, file.Opened())
 }
 
-// func TestOpenAppendFile(t *testing.T) {
-// 	var outputFile LnfFile.File
-// 	err := outputFile.OpenWrite("../tmp/appended-file.tmp", "", false, 0, false)
-// 	assert.Equal(t, nil, err)
-// 	assert.Equal(t, true, outputFile.Opened())
-
-// 	var inputFile LnfFile.File
-// 	err = inputFile.OpenRead("../testfiles/nfcapd.201705281555", false, false)
-// 	assert.Equal(t, nil, err)
-// 	assert.Equal(t, true, inputFile.Opened())
-// 	rec1, _ := LnfRec.NewRecord()
-// 	rec2, _ := LnfRec.NewRecord()
-// 	err = inputFile.GetNextRecord(&rec1)
-// 	assert.Equal(t, nil, err)
-// 	err = outputFile.WriteRecord(&rec1)
-// 	assert.Equal(t, nil, err)
-// 	assert.Equal(t, nil, inputFile.Close())
-// 	assert.Equal(t, false, inputFile.Opened())
-// 	assert.Equal(t, nil, outputFile.Close())
-// 	assert.Equal(t, false, outputFile.Opened())
-
-// 	outputFile.OpenAppend("../tmp/appended-file.tmp", false)
-// 	assert.Equal(t, true, outputFile.Opened())
-// 	err = outputFile.WriteRecord(&rec2)
-// 	// flows, err := outputFile.GetFlows()
-// 	// assert.Equal(t, uint64(1), flows)
-// 	assert.Equal(t, nil, err)
-// 	flows, err := outputFile.GetFlows()
-// 	assert.Equal(t, uint64(2), flows)
-// 	assert.Equal(t, nil, outputFile.Close())
-// 	// assert.Equal(t, false, outputFile.Opened())
-// rec, _ = LnfRec.NewRecord()
-
-// outputFile.OpenRead("../tmp/appended-file.tmp", false, false)
-// assert.Equal(t, true, outputFile.Opened())
-// flows, err := outputFile.GetFlows()
-// assert.Equal(t, nil, err)
-// rec, _ = LnfRec.NewRecord()
-// err = outputFile.GetNextRecord(&rec)
-
-// }
+func TestOpenAppendFile(t *testing.T) {
+	var inputFile LnfFile.File
+	err := inputFile.OpenRead("../testfiles/nfcapd.201705281555", false, false)
+	assert.Equal(t, nil, err)
+	defer inputFile.Close()
+	rec, _ := LnfRec.NewRecord()
+	defer rec.Free()
+
+	var outputFile LnfFile.File
+	err = outputFile.OpenWrite("../tmp/appended-file.tmp", "appended-file", false, LnfFile.CompLZO, false)
+	assert.Equal(t, nil, err)
+	var expected []uint64
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, nil, inputFile.GetNextRecord(&rec))
+		bytes, _ := rec.GetUint64(LnfFields.Doctets)
+		expected = append(expected, bytes)
+		assert.Equal(t, nil, outputFile.WriteRecord(&rec))
+	}
+	assert.Equal(t, nil, outputFile.Close())
+
+	err = outputFile.OpenAppend("../tmp/appended-file.tmp", false)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, outputFile.Opened())
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, nil, inputFile.GetNextRecord(&rec))
+		bytes, _ := rec.GetUint64(LnfFields.Doctets)
+		expected = append(expected, bytes)
+		assert.Equal(t, nil, outputFile.WriteRecord(&rec))
+	}
+	assert.Equal(t, nil, outputFile.Close())
+	assert.Equal(t, false, outputFile.Opened())
+
+	err = outputFile.OpenRead("../tmp/appended-file.tmp", false, false)
+	assert.Equal(t, nil, err)
+	defer outputFile.Close()
+
+	flows, err := outputFile.GetFlows()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint64(5), flows)
+
+	var total uint64
+	for _, b := range expected {
+		total += b
+	}
+	bytes, err := outputFile.GetBytes()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, total, bytes)
+
+	ident, err := outputFile.GetIdent()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "appended-file", ident)
+
+	comp, err := outputFile.GetCompressionType()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, LnfFile.CompLZO, comp)
+
+	var actual []uint64
+	for r, err := range outputFile.Records() {
+		assert.Equal(t, nil, err)
+		bytes, _ := r.GetUint64(LnfFields.Doctets)
+		actual = append(actual, bytes)
+	}
+	assert.Equal(t, expected, actual)
+}
+
+// Info from the file was retrieved using the nfdump version 1.6.25 tool
+func TestStat(t *testing.T) {
+	var file LnfFile.File
+	err := file.OpenRead("../testfiles/nfcapd.201705281555", false, false)
+	assert.Equal(t, nil, err)
+	defer file.Close()
+
+	info, err := file.Stat()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "nfdump, 1.6.25, peter@people.ops-trust.net", info.NfdumpVersion)
+	assert.Equal(t, "1.34", info.LibnfVersion)
+	assert.Equal(t, LnfFile.NoComp, info.Compression)
+	assert.Equal(t, false, info.Anonymized)
+	assert.Equal(t, time.Date(2017, 5, 28, 13, 53, 46, 933*1000000, time.UTC), info.First)
+	assert.Equal(t, time.Date(2017, 5, 28, 13, 56, 41, 76*1000000, time.UTC), info.Last)
+	assert.Equal(t, uint64(2), info.Blocks)
+	assert.Equal(t, uint64(2035), info.Flows.Total)
+	assert.Equal(t, uint64(2034), info.Flows.Tcp)
+	assert.Equal(t, uint64(1), info.Flows.Udp)
+	assert.Equal(t, uint64(148619), info.Bytes.Total)
+	assert.Equal(t, uint64(2161), info.Packets.Total)
+
+	ident, _ := file.GetIdent()
+	assert.Equal(t, ident, info.Ident)
+}
+
+func TestStatFromPath(t *testing.T) {
+	info, err := LnfFile.Stat("../testfiles/lzo-file.tmp")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, LnfFile.CompLZO, info.Compression)
+
+	_, err = LnfFile.Stat("nonexistent-file.tmp")
+	assert.ErrorIs(t, err, LnfErr.ErrCannotOpenFile)
+}
+
+func TestStatWithLongIdent(t *testing.T) {
+	var file LnfFile.File
+	err := file.OpenWrite("../tmp/long-ident.tmp", "a-much-longer-ident", false, 0, false)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, file.Close())
+
+	info, err := LnfFile.Stat("../tmp/long-ident.tmp")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "a-much-longer-ident", info.Ident)
+	assert.Equal(t, false, info.Anonymized)
+	assert.Equal(t, false, info.Catalog)
+	assert.Equal(t, LnfFile.NoComp, info.Compression)
+}
+
+func TestStatFromUnopenedFile(t *testing.T) {
+	var file LnfFile.File
+	_, err := file.Stat()
+	assert.Equal(t, LnfErr.ErrFileNotOpened, err)
+}
+
+func TestStatMarshalJSON(t *testing.T) {
+	info, err := LnfFile.Stat("../testfiles/nfcapd.201705281555")
+	assert.Equal(t, nil, err)
+
+	data, err := json.Marshal(info)
+	assert.Equal(t, nil, err)
+
+	var decoded LnfFile.FileInfo
+	assert.Equal(t, nil, json.Unmarshal(data, &decoded))
+	assert.Equal(t, info, decoded)
+	assert.Contains(t, string(data), `"flows":{"total":2035,"tcp":2034,"udp":1,"icmp":0,"other":0}`)
+}
+
+func TestOpenErrorContext(t *testing.T) {
+	var file LnfFile.File
+	err := file.OpenRead("../testfiles/nonexistent-file.tmp", false, false)
+
+	var lnfErr *LnfErr.LnfError
+	assert.Equal(t, true, errors.As(err, &lnfErr))
+	assert.Equal(t, "open", lnfErr.Op)
+	assert.Equal(t, "../testfiles/nonexistent-file.tmp", lnfErr.Path)
+	assert.Contains(t, err.Error(), "../testfiles/nonexistent-file.tmp")
+}
+
+func TestReadWithWeakErrCounters(t *testing.T) {
+	var file LnfFile.File
+	err := file.OpenRead("../testfiles/nfcapd.201705281555", false, true)
+	assert.Equal(t, nil, err)
+	defer file.Close()
+
+	count := 0
+	for rec, err := range file.Records() {
+		assert.Equal(t, nil, err)
+		assert.NotNil(t, rec)
+		count++
+	}
+	assert.Equal(t, 2035, count)
+	assert.Equal(t, LnfFile.SkipCounters{}, file.Skipped())
+}
+
+func TestReadTruncatedFile(t *testing.T) {
+	data, err := os.ReadFile("../testfiles/nfcapd.201705281555")
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile("../tmp/truncated.tmp", data[:len(data)/2], 0644))
+
+	var file LnfFile.File
+	err = file.OpenRead("../tmp/truncated.tmp", false, true)
+	assert.Equal(t, nil, err)
+	defer file.Close()
+	rec, _ := LnfRec.NewRecord()
+	defer rec.Free()
+
+	count := 0
+	for {
+		err = file.GetNextRecord(&rec)
+		if err != nil && !LnfErr.IsWeak(err) {
+			break
+		}
+		count++
+	}
+	assert.Less(t, count, 2035)
+	assert.Equal(t, true, errors.Is(err, LnfErr.ErrCorrupt) || errors.Is(err, LnfErr.ErrRead))
+}
+
+func TestFormatTime(t *testing.T) {
+	ts := time.Date(2017, 5, 28, 15, 55, 7, 0, time.UTC)
+	assert.Equal(t, "nfcapd.201705281555", LnfFile.FormatTime(LnfFile.DefaultRotateTemplate, ts))
+	assert.Equal(t, "17-05-28 15:55:07 100%", LnfFile.FormatTime("%y-%m-%d %H:%M:%S 100%%", ts))
+	assert.Equal(t, "2017/148/15", LnfFile.FormatTime(LnfFile.SubDirLayouts[6], ts))
+	assert.Equal(t, "2017/21/7", LnfFile.FormatTime(LnfFile.SubDirLayouts[3], ts))
+	assert.Equal(t, "2017-05-28/15", LnfFile.FormatTime(LnfFile.SubDirLayouts[8], ts))
+	assert.Equal(t, "%q%", LnfFile.FormatTime("%q%", ts))
+}
+
+func TestRotatingWriter(t *testing.T) {
+	dir := "../tmp/rotate"
+	assert.Nil(t, os.RemoveAll(dir))
+
+	now := time.Date(2024, 3, 9, 12, 30, 0, 0, time.UTC)
+	var rotated []string
+	w, err := LnfFile.NewRotatingWriter(LnfFile.RotateOptions{
+		Dir:        dir,
+		Interval:   time.Hour,
+		SubDirs:    2,
+		Ident:      "rotate",
+		Comp:       LnfFile.CompLZO,
+		Location:   time.UTC,
+		Now:        func() time.Time { return now },
+		PostRotate: func(path string) { rotated = append(rotated, path) },
+	})
+	assert.Equal(t, nil, err)
+	_, err = os.Stat(dir + "/nfcapd.current")
+	assert.Equal(t, nil, err)
+
+	var input LnfFile.File
+	assert.Equal(t, nil, input.OpenRead("../testfiles/nfcapd.201705281555", false, false))
+	defer input.Close()
+	rec, _ := LnfRec.NewRecord()
+	defer rec.Free()
+	for range 10 {
+		assert.Equal(t, nil, input.GetNextRecord(&rec))
+		assert.Equal(t, nil, w.WriteRecord(&rec))
+	}
+	assert.Equal(t, nil, w.Rotate())
+	assert.Equal(t, nil, input.GetNextRecord(&rec))
+	assert.Equal(t, nil, w.WriteRecord(&rec))
+	assert.Equal(t, nil, w.Close())
+	assert.ErrorIs(t, w.WriteRecord(&rec), LnfErr.ErrFileNotOpened)
+	assert.ErrorIs(t, w.Close(), LnfErr.ErrFileNotOpened)
+
+	// Both files belong to the same hour, the second one gets a suffix.
+	path := dir + "/2024/03/09/12/nfcapd.202403091200"
+	assert.Equal(t, []string{path, path + ".1"}, rotated)
+	_, err = os.Stat(dir + "/nfcapd.current")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	for i, want := range []uint64{10, 1} {
+		var check LnfFile.File
+		assert.Equal(t, nil, check.OpenRead(rotated[i], false, false))
+		flows, err := check.GetFlows()
+		assert.Equal(t, nil, err)
+		assert.Equal(t, want, flows)
+		ident, err := check.GetIdent()
+		assert.Equal(t, nil, err)
+		assert.Equal(t, "rotate", ident)
+		check.Close()
+	}
+}
+
+func TestRotatingWriterRenameFails(t *testing.T) {
+	dir := "../tmp/rotate-rename"
+	assert.Nil(t, os.RemoveAll(dir))
+
+	now := time.Date(2024, 3, 9, 12, 30, 0, 0, time.UTC)
+	var rotated []string
+	w, err := LnfFile.NewRotatingWriter(LnfFile.RotateOptions{
+		Dir:        dir,
+		SubDirs:    1,
+		Location:   time.UTC,
+		Now:        func() time.Time { return now },
+		PostRotate: func(path string) { rotated = append(rotated, path) },
+	})
+	assert.Equal(t, nil, err)
+
+	var input LnfFile.File
+	assert.Equal(t, nil, input.OpenRead("../testfiles/nfcapd.201705281555", false, false))
+	defer input.Close()
+	rec, _ := LnfRec.NewRecord()
+	defer rec.Free()
+	for range 10 {
+		assert.Equal(t, nil, input.GetNextRecord(&rec))
+		assert.Equal(t, nil, w.WriteRecord(&rec))
+	}
+
+	// A regular file in place of the subdirectory makes the rename fail.
+	assert.Nil(t, os.WriteFile(dir+"/2024", nil, 0644))
+	now = now.Add(5 * time.Minute)
+	assert.NotNil(t, w.WriteRecord(&rec))
+	assert.Equal(t, 0, len(rotated))
+
+	// The pending file is not truncated and is renamed by the next rotation.
+	assert.Nil(t, os.Remove(dir+"/2024"))
+	assert.Equal(t, nil, w.WriteRecord(&rec))
+	assert.Equal(t, []string{dir + "/2024/03/09/nfcapd.202403091230"}, rotated)
+	assert.Equal(t, nil, w.Close())
+
+	var check LnfFile.File
+	assert.Equal(t, nil, check.OpenRead(rotated[0], false, false))
+	defer check.Close()
+	flows, err := check.GetFlows()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint64(10), flows)
+}
+
+func TestRotatingWriterRecoversCurrentFile(t *testing.T) {
+	dir := "../tmp/rotate-recover"
+	assert.Nil(t, os.RemoveAll(dir))
+	assert.Nil(t, os.MkdirAll(dir, 0755))
+	assert.Nil(t, os.WriteFile(dir+"/nfcapd.current", nil, 0644))
+	mtime := time.Date(2017, 5, 28, 15, 57, 0, 0, time.UTC)
+	assert.Nil(t, os.Chtimes(dir+"/nfcapd.current", mtime, mtime))
+	// A file completed before the restart within the same interval is kept.
+	assert.Nil(t, os.WriteFile(dir+"/nfcapd.201705281555", []byte("old"), 0644))
+
+	var rotated []string
+	w, err := LnfFile.NewRotatingWriter(LnfFile.RotateOptions{
+		Dir:        dir,
+		Location:   time.UTC,
+		PostRotate: func(path string) { rotated = append(rotated, path) },
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{dir + "/nfcapd.201705281555.1"}, rotated)
+	data, err := os.ReadFile(dir + "/nfcapd.201705281555")
+	assert.Nil(t, err)
+	assert.Equal(t, "old", string(data))
+	assert.Equal(t, nil, w.Close())
+}
+
+func TestRotatingWriterRun(t *testing.T) {
+	dir := "../tmp/rotate-run"
+	assert.Nil(t, os.RemoveAll(dir))
+
+	// The clock jumps to the end of the interval after every rotation, until
+	// the third one cancels the context.
+	var mu sync.Mutex
+	now := time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var rotated []string
+	w, err := LnfFile.NewRotatingWriter(LnfFile.RotateOptions{
+		Dir:      dir,
+		Template: "nfcapd.%H%M%S",
+		Interval: time.Minute,
+		Location: time.UTC,
+		Now:      clock,
+		PostRotate: func(path string) {
+			rotated = append(rotated, path)
+			if len(rotated) == 3 {
+				cancel()
+				return
+			}
+			mu.Lock()
+			now = now.Add(time.Minute)
+			mu.Unlock()
+		},
+	})
+	assert.Equal(t, nil, err)
+
+	mu.Lock()
+	now = now.Add(time.Minute)
+	mu.Unlock()
+	assert.ErrorIs(t, w.Run(ctx), context.Canceled)
+	assert.Equal(t, []string{dir + "/nfcapd.120000", dir + "/nfcapd.120100", dir + "/nfcapd.120200"}, rotated)
+	assert.Equal(t, nil, w.Close())
+	assert.Equal(t, dir+"/nfcapd.120300", rotated[3])
+}
+
+func TestRotatingWriterUnknownSubDirs(t *testing.T) {
+	_, err := LnfFile.NewRotatingWriter(LnfFile.RotateOptions{Dir: "../tmp/rotate", SubDirs: len(LnfFile.SubDirLayouts)})
+	assert.NotNil(t, err)
+}
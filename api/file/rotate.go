@@ -0,0 +1,341 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/matejnesuta/libnf-go/api/errors"
+	"github.com/matejnesuta/libnf-go/api/record"
+)
+
+// Defaults of RotateOptions.
+const (
+	DefaultRotateTemplate = "nfcapd.%Y%m%d%H%M"
+	DefaultRotateInterval = 5 * time.Minute
+	DefaultCurrentName    = "nfcapd.current"
+)
+
+// SubDirLayouts lists the subdirectory hierarchies selected by
+// RotateOptions.SubDirs. The indexes match the -S option of nfcapd.
+var SubDirLayouts = []string{
+	"",            // 0: no hierarchy
+	"%Y/%m/%d",    // 1: year/month/day
+	"%Y/%m/%d/%H", // 2: year/month/day/hour
+	"%Y/%W/%u",    // 3: year/week/day of week
+	"%Y/%W/%u/%H", // 4: year/week/day of week/hour
+	"%Y/%j",       // 5: year/day of year
+	"%Y/%j/%H",    // 6: year/day of year/hour
+	"%F",          // 7: year-month-day
+	"%F/%H",       // 8: year-month-day/hour
+}
+
+// RotateOptions configure a RotatingWriter.
+type RotateOptions struct {
+	Dir         string           // Base directory of the files, created if missing.
+	Template    string           // Name of completed files, see FormatTime. DefaultRotateTemplate if empty.
+	CurrentName string           // Name of the file being written. DefaultCurrentName if empty.
+	Interval    time.Duration    // Rotation interval. DefaultRotateInterval if 0.
+	SubDirs     int              // Index of the subdirectory hierarchy in SubDirLayouts.
+	Location    *time.Location   // Time zone of the file names. time.Local if nil.
+	Now         func() time.Time // Clock deciding the intervals. time.Now if nil.
+
+	// Parameters of OpenWrite used for every file.
+	Ident   string
+	Anon    bool
+	Comp    int
+	WeakErr bool
+
+	// PostRotate is called with the path of every completed file, after the
+	// next file was opened. It runs in the goroutine which caused the rotation
+	// and blocks further writes, so long running work should be started in a
+	// goroutine of its own.
+	PostRotate func(path string)
+}
+
+// RotatingWriter writes records into a new file every interval, like nfcapd -t.
+//
+// Records are written to a file named RotateOptions.CurrentName in the base
+// directory. When the interval ends, the file is closed and renamed to the name
+// given by RotateOptions.Template and RotateOptions.SubDirs for the start of the
+// interval, so readers never see incomplete files under the final name.
+// Completed files are never overwritten: if a file of the same interval exists,
+// e.g. after Rotate or a restart within the interval, the suffix .1, .2 and so
+// on is appended to the name.
+// Intervals are aligned to multiples of the interval, e.g. files of 5 minute
+// intervals start at 12:00, 12:05 and so on.
+//
+// Rotation happens on the first write after the end of an interval, or exactly
+// at the end of it while Run is running. A RotatingWriter is safe for concurrent use.
+type RotatingWriter struct {
+	mu     sync.Mutex
+	opts   RotateOptions
+	file   File
+	start  time.Time // Start of the interval of the current file.
+	closed bool
+
+	// The current file was closed but not renamed yet. It is not reopened,
+	// which would truncate it, until the rename succeeds.
+	pending bool
+}
+
+// NewRotatingWriter creates the base directory and opens the first file.
+//
+// A current file left behind by a previous run, e.g. after a crash, is
+// completed first, using the interval of its modification time.
+func NewRotatingWriter(opts RotateOptions) (*RotatingWriter, error) {
+	if opts.Template == "" {
+		opts.Template = DefaultRotateTemplate
+	}
+	if opts.CurrentName == "" {
+		opts.CurrentName = DefaultCurrentName
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultRotateInterval
+	}
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	if opts.SubDirs < 0 || opts.SubDirs >= len(SubDirLayouts) {
+		return nil, fmt.Errorf("file: unknown subdirectory hierarchy %d", opts.SubDirs)
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	w := &RotatingWriter{opts: opts}
+	var left string
+	if info, err := os.Stat(w.currentPath()); err == nil {
+		w.start = info.ModTime().Truncate(opts.Interval)
+		if left, err = w.complete(); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.open(opts.Now()); err != nil {
+		return nil, err
+	}
+	w.postRotate(left)
+	return w, nil
+}
+
+// FormatTime formats t according to a strftime-like format, as used in the
+// file names of nfcapd. The supported conversions are %Y, %y, %m, %d, %H, %M,
+// %S, %j (day of the year), %W (week of the year starting on Monday), %u (day
+// of the week, Monday is 1), %F (%Y-%m-%d) and %%. Other characters are copied.
+func FormatTime(format string, t time.Time) string {
+	var b strings.Builder
+	pad := func(v, width int) {
+		s := strconv.Itoa(v)
+		for range width - len(s) {
+			b.WriteByte('0')
+		}
+		b.WriteString(s)
+	}
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			b.WriteByte(format[i])
+			continue
+		}
+		i++
+		switch format[i] {
+		case 'Y':
+			pad(t.Year(), 4)
+		case 'y':
+			pad(t.Year()%100, 2)
+		case 'm':
+			pad(int(t.Month()), 2)
+		case 'd':
+			pad(t.Day(), 2)
+		case 'H':
+			pad(t.Hour(), 2)
+		case 'M':
+			pad(t.Minute(), 2)
+		case 'S':
+			pad(t.Second(), 2)
+		case 'j':
+			pad(t.YearDay(), 3)
+		case 'W':
+			monday := (int(t.Weekday()) + 6) % 7
+			pad((t.YearDay()+6-monday)/7, 2)
+		case 'u':
+			pad((int(t.Weekday())+6)%7+1, 1)
+		case 'F':
+			pad(t.Year(), 4)
+			b.WriteByte('-')
+			pad(int(t.Month()), 2)
+			b.WriteByte('-')
+			pad(t.Day(), 2)
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(format[i])
+		}
+	}
+	return b.String()
+}
+
+func (w *RotatingWriter) currentPath() string {
+	return filepath.Join(w.opts.Dir, w.opts.CurrentName)
+}
+
+// Path returns the path the file of the interval starting at start is renamed
+// to, unless a file of that interval was already completed.
+func (w *RotatingWriter) Path(start time.Time) string {
+	t := start.In(w.opts.Location)
+	return filepath.Join(w.opts.Dir, FormatTime(SubDirLayouts[w.opts.SubDirs], t), FormatTime(w.opts.Template, t))
+}
+
+func (w *RotatingWriter) open(now time.Time) error {
+	if err := w.file.OpenWrite(w.currentPath(), w.opts.Ident, w.opts.Anon, w.opts.Comp, w.opts.WeakErr); err != nil {
+		return err
+	}
+	w.start = now.Truncate(w.opts.Interval)
+	return nil
+}
+
+// complete closes the current file and renames it to its final path. If the
+// rename fails, the file stays pending and the rename is retried by the next
+// rotation.
+func (w *RotatingWriter) complete() (string, error) {
+	if w.file.Opened() {
+		w.pending = true
+		if err := w.file.Close(); err != nil {
+			return "", err
+		}
+	}
+	path, err := w.target()
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(w.currentPath(), path); err != nil {
+		return "", err
+	}
+	w.pending = false
+	return path, nil
+}
+
+// target returns the final path of the current file, with a numeric suffix
+// if the path of its interval is already taken.
+func (w *RotatingWriter) target() (string, error) {
+	path := w.Path(w.start)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	target := path
+	for i := 1; ; i++ {
+		_, err := os.Lstat(target)
+		if os.IsNotExist(err) {
+			return target, nil
+		} else if err != nil {
+			return "", err
+		}
+		target = path + "." + strconv.Itoa(i)
+	}
+}
+
+// rotate completes the current file and opens the next one if the interval
+// of the current file is over at now, or if force is set. Returns the path of
+// the completed file, or an empty string if the file was not rotated.
+func (w *RotatingWriter) rotate(now time.Time, force bool) (string, error) {
+	if w.closed {
+		return "", errors.ErrFileNotOpened
+	}
+	if !force && now.Before(w.start.Add(w.opts.Interval)) && w.file.Opened() {
+		return "", nil
+	}
+	var path string
+	if w.file.Opened() || w.pending {
+		var err error
+		if path, err = w.complete(); err != nil {
+			return "", err
+		}
+	}
+	return path, w.open(now)
+}
+
+func (w *RotatingWriter) postRotate(path string) {
+	if path != "" && w.opts.PostRotate != nil {
+		w.opts.PostRotate(path)
+	}
+}
+
+// WriteRecord writes the record to the current file, after rotating it if its
+// interval is over. It makes the writer a destination of collectors and record
+// streams like any file.File.
+func (w *RotatingWriter) WriteRecord(r *record.Record) error {
+	w.mu.Lock()
+	path, err := w.rotate(w.opts.Now(), false)
+	if err == nil {
+		err = w.file.WriteRecord(r)
+	}
+	w.mu.Unlock()
+
+	w.postRotate(path)
+	return err
+}
+
+// Rotate completes the current file and starts a new one, regardless of the interval.
+func (w *RotatingWriter) Rotate() error {
+	w.mu.Lock()
+	path, err := w.rotate(w.opts.Now(), true)
+	w.mu.Unlock()
+
+	w.postRotate(path)
+	return err
+}
+
+// Run rotates the files at the end of every interval, so a file is completed
+// for every interval even if no records are written. It returns ctx.Err()
+// once the context is canceled, or the first error of a rotation.
+func (w *RotatingWriter) Run(ctx context.Context) error {
+	for {
+		w.mu.Lock()
+		next := w.start.Add(w.opts.Interval)
+		w.mu.Unlock()
+
+		timer := time.NewTimer(next.Sub(w.opts.Now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		w.mu.Lock()
+		path, err := w.rotate(w.opts.Now(), false)
+		w.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		w.postRotate(path)
+	}
+}
+
+// Close completes the current file. The writer cannot be used afterwards.
+func (w *RotatingWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return errors.ErrFileNotOpened
+	}
+	w.closed = true
+	var path string
+	var err error
+	if w.file.Opened() || w.pending {
+		path, err = w.complete()
+	}
+	w.mu.Unlock()
+
+	w.postRotate(path)
+	return err
+}
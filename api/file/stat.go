@@ -0,0 +1,148 @@
+package file
+
+import (
+	"time"
+	"unsafe"
+
+	"github.com/matejnesuta/libnf-go/api/errors"
+	"github.com/matejnesuta/libnf-go/internal"
+)
+
+// Counters holds the per-protocol breakdown of a file statistic.
+type Counters struct {
+	Total uint64 `json:"total"`
+	Tcp   uint64 `json:"tcp"`
+	Udp   uint64 `json:"udp"`
+	Icmp  uint64 `json:"icmp"`
+	Other uint64 `json:"other"`
+}
+
+// FileInfo is a snapshot of the metadata and statistics stored in an nfdump file.
+type FileInfo struct {
+	LibnfVersion  string    `json:"libnf_version"`
+	NfdumpVersion string    `json:"nfdump_version"`
+	FileVersion   uint64    `json:"file_version"`
+	Ident         string    `json:"ident"`
+	Compression   int       `json:"compression"` // One of NoComp, CompLZO, CompBZ2.
+	Anonymized    bool      `json:"anonymized"`
+	Catalog       bool      `json:"catalog"`
+	First         time.Time `json:"first"`
+	Last          time.Time `json:"last"`
+	Blocks        uint64    `json:"blocks"`
+	ProcBlocks    uint64    `json:"proc_blocks"`
+	Failures      uint64    `json:"failures"`
+	Flows         Counters  `json:"flows"`
+	Bytes         Counters  `json:"bytes"`
+	Packets       Counters  `json:"packets"`
+}
+
+// infoReader reads multiple info items into a single shared buffer.
+// The first error is kept and all subsequent reads are skipped.
+type infoReader struct {
+	f   *File
+	buf []byte
+	err error
+}
+
+func (r *infoReader) read(info int) bool {
+	if r.err != nil {
+		return false
+	}
+	r.err = readInfo(info, r.f, r.buf)
+	return r.err == nil
+}
+
+func (r *infoReader) string(info int) string {
+	if !r.read(info) {
+		return ""
+	}
+	return bufToString(r.buf)
+}
+
+func (r *infoReader) bool(info int) bool {
+	if !r.read(info) {
+		return false
+	}
+	// libnf writes a C int, the rest of the shared buffer holds previous values.
+	return *(*int32)(unsafe.Pointer(&r.buf[0])) != 0
+}
+
+func (r *infoReader) uint64(info int) uint64 {
+	if !r.read(info) {
+		return 0
+	}
+	return *(*uint64)(unsafe.Pointer(&r.buf[0]))
+}
+
+func (r *infoReader) timestamp(info int) time.Time {
+	return time.Unix(0, int64(time.Millisecond)*int64(r.uint64(info))).UTC()
+}
+
+// Stat returns all metadata and statistics of the opened file in a single structure.
+// No records are read from the file, so it can be called right after opening it.
+func (f *File) Stat() (FileInfo, error) {
+	if !f.Opened() {
+		return FileInfo{}, errors.ErrFileNotOpened
+	}
+	r := infoReader{f: f, buf: make([]byte, internal.INFO_BUFSIZE)}
+
+	info := FileInfo{
+		LibnfVersion:  r.string(internal.INFO_VERSION),
+		NfdumpVersion: r.string(internal.INFO_NFDUMP_VERSION),
+		FileVersion:   r.uint64(internal.INFO_FILE_VERSION),
+		Ident:         r.string(internal.INFO_IDENT),
+		Anonymized:    r.bool(internal.INFO_ANONYMIZED),
+		Catalog:       r.bool(internal.INFO_CATALOG),
+		First:         r.timestamp(internal.INFO_FIRST),
+		Last:          r.timestamp(internal.INFO_LAST),
+		Blocks:        r.uint64(internal.INFO_BLOCKS),
+		ProcBlocks:    r.uint64(internal.INFO_PROC_BLOCKS),
+		Failures:      r.uint64(internal.INFO_FAILURES),
+		Flows: Counters{
+			Total: r.uint64(internal.INFO_FLOWS),
+			Tcp:   r.uint64(internal.INFO_FLOWS_TCP),
+			Udp:   r.uint64(internal.INFO_FLOWS_UDP),
+			Icmp:  r.uint64(internal.INFO_FLOWS_ICMP),
+			Other: r.uint64(internal.INFO_FLOWS_OTHER),
+		},
+		Bytes: Counters{
+			Total: r.uint64(internal.INFO_BYTES),
+			Tcp:   r.uint64(internal.INFO_BYTES_TCP),
+			Udp:   r.uint64(internal.INFO_BYTES_UDP),
+			Icmp:  r.uint64(internal.INFO_BYTES_ICMP),
+			Other: r.uint64(internal.INFO_BYTES_OTHER),
+		},
+		Packets: Counters{
+			Total: r.uint64(internal.INFO_PACKETS),
+			Tcp:   r.uint64(internal.INFO_PACKETS_TCP),
+			Udp:   r.uint64(internal.INFO_PACKETS_UDP),
+			Icmp:  r.uint64(internal.INFO_PACKETS_ICMP),
+			Other: r.uint64(internal.INFO_PACKETS_OTHER),
+		},
+	}
+
+	info.Compression = NoComp
+	if r.bool(internal.INFO_COMPRESSED) {
+		if r.bool(internal.INFO_LZO_COMPRESSED) {
+			info.Compression = CompLZO
+		} else {
+			info.Compression = CompBZ2
+		}
+	}
+
+	if r.err != nil {
+		return FileInfo{}, r.err
+	}
+	return info, nil
+}
+
+// Stat opens the file at the given path, reads its metadata and statistics
+// and closes it again without reading any records.
+func Stat(path string) (FileInfo, error) {
+	var f File
+	if err := f.OpenRead(path, false, false); err != nil {
+		return FileInfo{}, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
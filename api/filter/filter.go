@@ -1,7 +1,10 @@
 package filter
 
 import (
+	"runtime"
+
 	LnfErr "github.com/matejnesuta/libnf-go/api/errors"
+	"github.com/matejnesuta/libnf-go/api/internal/handle"
 	LnfRec "github.com/matejnesuta/libnf-go/api/record"
 	"github.com/matejnesuta/libnf-go/internal"
 )
@@ -12,9 +15,9 @@ import (
 // Internally, it uses the newer libnf filter engine (v2), which is thread-safe,
 // leak-free, and more extensible compared to the legacy nfdump filter code.
 type Filter struct {
-	allocated bool
-	ptr       uintptr
-	repr      string
+	ptr  uintptr
+	repr string
+	h    *handle.Handle // Shared by all copies, tracks whether the filter was freed.
 }
 
 // String returns the original filter expression used to initialize the Filter.
@@ -22,6 +25,10 @@ func (f Filter) String() string {
 	return f.repr
 }
 
+func (f *Filter) initialized() bool {
+	return !f.h.Released()
+}
+
 // Init compiles the provided filter expression and initializes the Filter.
 //
 // This uses the new libnf v2 filtering engine, which supports multithreading
@@ -29,9 +36,10 @@ func (f Filter) String() string {
 // used in nfdump, though not all legacy features may be available.
 //
 // Returns an error if memory allocation fails, the filter expression is invalid,
-// or if the filter is already initialized.
+// or if the filter is already initialized. For an invalid expression, the returned
+// *LnfErr.LnfError holds the message from libnf describing why compilation failed.
 func (f *Filter) Init(expression string) error {
-	if f.allocated {
+	if f.initialized() {
 		return LnfErr.ErrFilterAlreadyInit
 	}
 
@@ -39,12 +47,12 @@ func (f *Filter) Init(expression string) error {
 	if status == internal.ERR_NOMEM {
 		return LnfErr.ErrNoMem
 	} else if status == internal.ERR_FILTER {
-		return LnfErr.ErrFilter
+		return LnfErr.Wrap("filter init", expression, status, LnfErr.ErrFilter)
 	} else if status == internal.ERR_OTHER_MSG {
-		return LnfErr.ErrOtherMsg
+		return LnfErr.Wrap("filter init", expression, status, LnfErr.ErrOtherMsg)
 	}
 	f.repr = expression
-	f.allocated = true
+	f.h = handle.New("Filter", f.ptr, internal.Filter_free)
 	return nil
 }
 
@@ -53,11 +61,11 @@ func (f *Filter) Init(expression string) error {
 // After calling Free, the Filter must be reinitialized before use.
 // If the Filter was not initialized, this returns an error.
 func (f *Filter) Free() error {
-	if !f.allocated {
+	if !f.initialized() {
 		return LnfErr.ErrFilterNotInit
 	}
+	f.h.Release()
 	internal.Filter_free(f.ptr)
-	f.allocated = false
 	f.repr = ""
 	return nil
 }
@@ -67,12 +75,14 @@ func (f *Filter) Free() error {
 // Returns true if the record matches the filter expression, false otherwise.
 // Returns an error if the filter is not initialized or the record is not allocated.
 func (f *Filter) Match(r LnfRec.Record) (bool, error) {
-	if !f.allocated {
+	if !f.initialized() {
 		return false, LnfErr.ErrFilterNotInit
 	} else if !r.Allocated() {
 		return false, LnfErr.ErrRecordNotAllocated
 	}
 	status := internal.Filter_match(f.ptr, r.GetPtr())
+	runtime.KeepAlive(f)
+	runtime.KeepAlive(r)
 	if status == 1 {
 		return true, nil
 	}
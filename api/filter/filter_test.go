@@ -1,6 +1,7 @@
 package filter_test
 
 import (
+	"errors"
 	"testing"
 
 	LnfErr "github.com/matejnesuta/libnf-go/api/errors"
@@ -77,7 +78,20 @@ func TestDoubleClearFilter(t *testing.T) {
 func TestInitFilterWithWrongValue(t *testing.T) {
 	var filter LnfFilter.Filter
 	err := filter.Init("uhhhhhhhhhhhhhhhhhhhhhhhhh")
-	assert.Equal(t, LnfErr.ErrOtherMsg, err)
+	assert.ErrorIs(t, err, LnfErr.ErrOtherMsg)
+}
+
+func TestInitFilterErrorMessage(t *testing.T) {
+	var filter LnfFilter.Filter
+	err := filter.Init("uhhhhhhhhhhhhhhhhhhhhhhhhh")
+
+	var lnfErr *LnfErr.LnfError
+	assert.Equal(t, true, errors.As(err, &lnfErr))
+	assert.Equal(t, "filter init", lnfErr.Op)
+	assert.Equal(t, "uhhhhhhhhhhhhhhhhhhhhhhhhh", lnfErr.Path)
+	assert.NotEqual(t, "", lnfErr.Msg)
+	assert.NotContains(t, lnfErr.Msg, "\x00")
+	assert.Contains(t, err.Error(), lnfErr.Msg)
 }
 
 func TestMatchFilter(t *testing.T) {
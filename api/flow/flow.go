@@ -0,0 +1,249 @@
+// Package flow provides Flow, a plain Go representation of a flow record.
+//
+// Unlike record.Record, a Flow holds no C memory, so it can be kept in slices,
+// maps and channels, compared with == and garbage collected as usual.
+// Use record.Record.ToFlow and record.Record.FromFlow to convert between the two.
+package flow
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"reflect"
+	"time"
+
+	"github.com/matejnesuta/libnf-go/api/fields"
+)
+
+// MAC is a hardware address stored by value, so a Flow stays comparable.
+// It is encoded as text in the usual colon separated form.
+type MAC [6]byte
+
+func (m MAC) String() string {
+	return net.HardwareAddr(m[:]).String()
+}
+
+func (m MAC) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *MAC) UnmarshalText(text []byte) error {
+	hw, err := net.ParseMAC(string(text))
+	if err != nil {
+		return err
+	}
+	if len(hw) != len(m) {
+		return fmt.Errorf("flow: %q is not a 48-bit MAC address", text)
+	}
+	copy(m[:], hw)
+	return nil
+}
+
+// Flow holds the values of a flow record.
+//
+// Every libnf field is covered except for aliases, which share the value of the
+// field they alias, the pair fields, which are only used by filters and
+// aggregation, fields.Brec1 and the ACL structures, whose members are available
+// one by one, and the computed fields, which are provided by the Duration, Bps,
+// Pps and Bpp methods. The IP version of addresses (fields.InetFamily) is part
+// of netip.Addr.
+//
+// Present records which fields were set in the record the Flow was created from.
+// The fields of Flow follow the order of Fields. The json, csv and db tags use
+// the field names of the fields registry (see fields.Name), the same names as
+// record.Record.MarshalJSON.
+type Flow struct {
+	First             time.Time   `json:"first" csv:"first" db:"first"`
+	Last              time.Time   `json:"last" csv:"last" db:"last"`
+	Received          uint64      `json:"received,omitempty" csv:"received" db:"received"`
+	Bytes             uint64      `json:"bytes" csv:"bytes" db:"bytes"`
+	Packets           uint64      `json:"pkts" csv:"pkts" db:"pkts"`
+	OutBytes          uint64      `json:"outbytes,omitempty" csv:"outbytes" db:"outbytes"`
+	OutPackets        uint64      `json:"outpkts,omitempty" csv:"outpkts" db:"outpkts"`
+	Flows             uint64      `json:"flows,omitempty" csv:"flows" db:"flows"`
+	SrcPort           uint16      `json:"srcport" csv:"srcport" db:"srcport"`
+	DstPort           uint16      `json:"dstport" csv:"dstport" db:"dstport"`
+	TcpFlags          uint8       `json:"tcpflags,omitempty" csv:"tcpflags" db:"tcpflags"`
+	SrcAddr           netip.Addr  `json:"srcip" csv:"srcip" db:"srcip"`
+	DstAddr           netip.Addr  `json:"dstip" csv:"dstip" db:"dstip"`
+	NextHop           netip.Addr  `json:"nexthop,omitzero" csv:"nexthop" db:"nexthop"`
+	SrcMask           uint8       `json:"srcmask,omitempty" csv:"srcmask" db:"srcmask"`
+	DstMask           uint8       `json:"dstmask,omitempty" csv:"dstmask" db:"dstmask"`
+	Tos               uint8       `json:"tos,omitempty" csv:"tos" db:"tos"`
+	DstTos            uint8       `json:"dsttos,omitempty" csv:"dsttos" db:"dsttos"`
+	SrcAS             uint32      `json:"srcas,omitempty" csv:"srcas" db:"srcas"`
+	DstAS             uint32      `json:"dstas,omitempty" csv:"dstas" db:"dstas"`
+	BgpNextAdjacentAS uint32      `json:"nextas,omitempty" csv:"nextas" db:"nextas"`
+	BgpPrevAdjacentAS uint32      `json:"prevas,omitempty" csv:"prevas" db:"prevas"`
+	BgpNextHop        netip.Addr  `json:"bgpnexthop,omitzero" csv:"bgpnexthop" db:"bgpnexthop"`
+	Prot              uint8       `json:"proto" csv:"proto" db:"proto"`
+	SrcVlan           uint16      `json:"srcvlan,omitempty" csv:"srcvlan" db:"srcvlan"`
+	DstVlan           uint16      `json:"dstvlan,omitempty" csv:"dstvlan" db:"dstvlan"`
+	InSrcMac          MAC         `json:"insrcmac,omitzero" csv:"insrcmac" db:"insrcmac"`
+	OutSrcMac         MAC         `json:"outsrcmac,omitzero" csv:"outsrcmac" db:"outsrcmac"`
+	InDstMac          MAC         `json:"indstmac,omitzero" csv:"indstmac" db:"indstmac"`
+	OutDstMac         MAC         `json:"outdstmac,omitzero" csv:"outdstmac" db:"outdstmac"`
+	MplsLabel         fields.Mpls `json:"mpls,omitzero" csv:"mpls" db:"mpls"`
+	Input             uint32      `json:"inif,omitempty" csv:"inif" db:"inif"`
+	Output            uint32      `json:"outif,omitempty" csv:"outif" db:"outif"`
+	Dir               uint8       `json:"dir,omitempty" csv:"dir" db:"dir"`
+	FwdStatus         uint8       `json:"fwd,omitempty" csv:"fwd" db:"fwd"`
+	IpRouter          netip.Addr  `json:"router,omitzero" csv:"router" db:"router"`
+	EngineType        uint8       `json:"systype,omitempty" csv:"systype" db:"systype"`
+	EngineId          uint8       `json:"sysid,omitempty" csv:"sysid" db:"sysid"`
+	EventTime         uint64      `json:"eventtime,omitempty" csv:"eventtime" db:"eventtime"`
+	ConnId            uint32      `json:"connid,omitempty" csv:"connid" db:"connid"`
+	IcmpCode          uint8       `json:"icmpcode,omitempty" csv:"icmpcode" db:"icmpcode"`
+	IcmpType          uint8       `json:"icmptype,omitempty" csv:"icmptype" db:"icmptype"`
+	FwXEvent          uint16      `json:"xevent,omitempty" csv:"xevent" db:"xevent"`
+	FwEvent           uint8       `json:"event,omitempty" csv:"event" db:"event"`
+	XlateSrcIp        netip.Addr  `json:"xsrcip,omitzero" csv:"xsrcip" db:"xsrcip"`
+	XlateDstIp        netip.Addr  `json:"xdstip,omitzero" csv:"xdstip" db:"xdstip"`
+	XlateSrcPort      uint16      `json:"xsrcport,omitempty" csv:"xsrcport" db:"xsrcport"`
+	XlateDstPort      uint16      `json:"xdstport,omitempty" csv:"xdstport" db:"xdstport"`
+	IngressAclId      uint32      `json:"iacl,omitempty" csv:"iacl" db:"iacl"`
+	IngressAceId      uint32      `json:"iace,omitempty" csv:"iace" db:"iace"`
+	IngressXaceId     uint32      `json:"ixace,omitempty" csv:"ixace" db:"ixace"`
+	EgressAclId       uint32      `json:"eacl,omitempty" csv:"eacl" db:"eacl"`
+	EgressAceId       uint32      `json:"eace,omitempty" csv:"eace" db:"eace"`
+	EgressXaceId      uint32      `json:"exace,omitempty" csv:"exace" db:"exace"`
+	Username          string      `json:"username,omitempty" csv:"username" db:"username"`
+	IngressVrfid      uint32      `json:"ingressvrfid,omitempty" csv:"ingressvrfid" db:"ingressvrfid"`
+	EventFlag         uint8       `json:"eventflag,omitempty" csv:"eventflag" db:"eventflag"`
+	EgressVrfid       uint32      `json:"egressvrfid,omitempty" csv:"egressvrfid" db:"egressvrfid"`
+	BlockStart        uint16      `json:"blockstart,omitempty" csv:"blockstart" db:"blockstart"`
+	BlockEnd          uint16      `json:"blockend,omitempty" csv:"blockend" db:"blockend"`
+	BlockStep         uint16      `json:"blockstep,omitempty" csv:"blockstep" db:"blockstep"`
+	BlockSize         uint16      `json:"blocksize,omitempty" csv:"blocksize" db:"blocksize"`
+	ClientNwDelayUsec uint64      `json:"cl,omitempty" csv:"cl" db:"cl"`
+	ServerNwDelayUsec uint64      `json:"sl,omitempty" csv:"sl" db:"sl"`
+	ApplLatencyUsec   uint64      `json:"al,omitempty" csv:"al" db:"al"`
+	ExporterIp        netip.Addr  `json:"exporterip,omitzero" csv:"exporterip" db:"exporterip"`
+	ExporterId        uint32      `json:"exporterid,omitempty" csv:"exporterid" db:"exporterid"`
+	ExporterVersion   uint32      `json:"exporterversion,omitempty" csv:"exporterversion" db:"exporterversion"`
+	SequenceFailures  uint32      `json:"seqfailures,omitempty" csv:"seqfailures" db:"seqfailures"`
+	SamplerMode       uint16      `json:"samplermode,omitempty" csv:"samplermode" db:"samplermode"`
+	SamplerInterval   uint32      `json:"samplerinterval,omitempty" csv:"samplerinterval" db:"samplerinterval"`
+	SamplerId         uint32      `json:"samplerid,omitempty" csv:"samplerid" db:"samplerid"`
+
+	Present FieldSet `json:"-" csv:"-" db:"-"`
+}
+
+// Fields lists the libnf fields covered by Flow, in the order of the Flow struct fields.
+var Fields = []int{
+	fields.First, fields.Last, fields.Received, fields.Doctets, fields.Dpkts,
+	fields.OutBytes, fields.OutPkts, fields.AggrFlows, fields.SrcPort, fields.DstPort,
+	fields.TcpFlags, fields.SrcAddr, fields.DstAddr, fields.IpNextHop, fields.SrcMask,
+	fields.DstMask, fields.Tos, fields.DstTos, fields.SrcAS, fields.DstAS,
+	fields.BgpNextAdjacentAS, fields.BgpPrevAdjacentAS, fields.BgpNextHop, fields.Prot, fields.SrcVlan,
+	fields.DstVlan, fields.InSrcMac, fields.OutSrcMac, fields.InDstMac, fields.OutDstMac,
+	fields.MplsLabel, fields.Input, fields.Output, fields.Dir, fields.FwdStatus,
+	fields.IpRouter, fields.EngineType, fields.EngineId, fields.EventTime, fields.ConnId,
+	fields.IcmpCode, fields.IcmpType, fields.FwXEvent, fields.FwEvent, fields.XlateSrcIp,
+	fields.XlateDstIp, fields.XlateSrcPort, fields.XlateDstPort, fields.IngressAclId, fields.IngressAceId,
+	fields.IngressXaceId, fields.EgressAclId, fields.EgressAceId, fields.EgressXaceId, fields.Username,
+	fields.IngressVrfid, fields.EventFlag, fields.EgressVrfid, fields.BlockStart, fields.BlockEnd,
+	fields.BlockStep, fields.BlockSize, fields.ClientNwDelayUsec, fields.ServerNwDelayUsec, fields.ApplLatencyUsec,
+	fields.ExporterIp, fields.ExporterId, fields.ExporterVersion, fields.SequenceFailures, fields.SamplerMode,
+	fields.SamplerInterval, fields.SamplerId,
+}
+
+// index maps a libnf field, including its aliases, to its position in Fields.
+var index = func() map[int]int {
+	m := make(map[int]int, len(Fields))
+	for i, field := range Fields {
+		m[field] = i
+	}
+	aliases := map[int]int{
+		fields.DpktsAlias:      fields.Dpkts,
+		fields.OutPktsAlias:    fields.OutPkts,
+		fields.TcpFlagsAlias:   fields.TcpFlags,
+		fields.SrcAddrAlias:    fields.SrcAddr,
+		fields.DstAddrAlias:    fields.DstAddr,
+		fields.IpNextHopAlias:  fields.IpNextHop,
+		fields.IpRouterAlias:   fields.IpRouter,
+		fields.EngineTypeAlias: fields.EngineType,
+		fields.EngineIdAlias:   fields.EngineId,
+		fields.IcmpCodeAlias:   fields.IcmpCode,
+		fields.IcmpTypeAlias:   fields.IcmpType,
+	}
+	for alias, field := range aliases {
+		m[alias] = m[field]
+	}
+	return m
+}()
+
+// FieldSet is a set of the libnf fields covered by Flow. Aliases are treated
+// as the field they alias. Fields not covered by Flow are never members.
+type FieldSet [2]uint64
+
+// Has reports whether field is in the set.
+func (s FieldSet) Has(field int) bool {
+	i, ok := index[field]
+	return ok && s[i/64]&(1<<(i%64)) != 0
+}
+
+// Add adds field to the set. Fields not covered by Flow are ignored.
+func (s *FieldSet) Add(field int) {
+	if i, ok := index[field]; ok {
+		s[i/64] |= 1 << (i % 64)
+	}
+}
+
+// Remove removes field from the set.
+func (s *FieldSet) Remove(field int) {
+	if i, ok := index[field]; ok {
+		s[i/64] &^= 1 << (i % 64)
+	}
+}
+
+// Has reports whether field was set in the record the Flow was created from,
+// or was marked present since.
+func (f *Flow) Has(field int) bool {
+	return f.Present.Has(field)
+}
+
+// MarkNonZero marks every field holding a non-zero value as present. It is
+// useful for flows built by hand before they are converted to a record.
+func (f *Flow) MarkNonZero() {
+	v := reflect.ValueOf(f).Elem()
+	for i, field := range Fields {
+		if !v.Field(i).IsZero() {
+			f.Present.Add(field)
+		}
+	}
+}
+
+// Duration returns the duration of the flow (fields.CalcDuration).
+func (f *Flow) Duration() time.Duration {
+	return f.Last.Sub(f.First)
+}
+
+// Bps returns the bits per second of the flow (fields.CalcBps),
+// or 0 if the flow has no duration.
+func (f *Flow) Bps() float64 {
+	sec := f.Duration().Seconds()
+	if sec <= 0 {
+		return 0
+	}
+	return float64(f.Bytes) * 8 / sec
+}
+
+// Pps returns the packets per second of the flow (fields.CalcPps),
+// or 0 if the flow has no duration.
+func (f *Flow) Pps() float64 {
+	sec := f.Duration().Seconds()
+	if sec <= 0 {
+		return 0
+	}
+	return float64(f.Packets) / sec
+}
+
+// Bpp returns the bytes per packet of the flow (fields.CalcBpp),
+// or 0 if the flow has no packets.
+func (f *Flow) Bpp() float64 {
+	if f.Packets == 0 {
+		return 0
+	}
+	return float64(f.Bytes) / float64(f.Packets)
+}
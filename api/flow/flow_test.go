@@ -0,0 +1,124 @@
+package flow_test
+
+import (
+	"encoding/json"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matejnesuta/libnf-go/api/fields"
+	"github.com/matejnesuta/libnf-go/api/flow"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFieldsMatchStruct(t *testing.T) {
+	// Every struct field except Present corresponds to one entry in Fields.
+	assert.Equal(t, len(flow.Fields), reflect.TypeOf(flow.Flow{}).NumField()-1)
+	for _, field := range flow.Fields {
+		_, ok := fields.FieldTypes[field]
+		assert.Equal(t, true, ok)
+	}
+}
+
+func TestTagsUseFieldNames(t *testing.T) {
+	typ := reflect.TypeOf(flow.Flow{})
+	for i, field := range flow.Fields {
+		name := fields.Name(field)
+		tag := typ.Field(i).Tag
+		assert.Equal(t, name, strings.Split(tag.Get("json"), ",")[0])
+		assert.Equal(t, name, tag.Get("csv"))
+		assert.Equal(t, name, tag.Get("db"))
+	}
+}
+
+func TestFieldSet(t *testing.T) {
+	var set flow.FieldSet
+	assert.Equal(t, false, set.Has(fields.SrcPort))
+
+	set.Add(fields.SrcPort)
+	set.Add(fields.SamplerId)
+	assert.Equal(t, true, set.Has(fields.SrcPort))
+	assert.Equal(t, true, set.Has(fields.SamplerId))
+	assert.Equal(t, false, set.Has(fields.DstPort))
+
+	set.Add(fields.DpktsAlias)
+	assert.Equal(t, true, set.Has(fields.Dpkts))
+
+	set.Remove(fields.SrcPort)
+	assert.Equal(t, false, set.Has(fields.SrcPort))
+
+	set.Add(fields.CalcBps)
+	assert.Equal(t, false, set.Has(fields.CalcBps))
+}
+
+func TestMarkNonZero(t *testing.T) {
+	f := flow.Flow{
+		SrcAddr:  netip.MustParseAddr("192.168.0.1"),
+		DstPort:  80,
+		InSrcMac: flow.MAC{1, 2, 3, 4, 5, 6},
+	}
+	f.MarkNonZero()
+	assert.Equal(t, true, f.Has(fields.SrcAddr))
+	assert.Equal(t, true, f.Has(fields.DstPort))
+	assert.Equal(t, true, f.Has(fields.InSrcMac))
+	assert.Equal(t, false, f.Has(fields.SrcPort))
+	assert.Equal(t, false, f.Has(fields.First))
+}
+
+func TestComputedFields(t *testing.T) {
+	f := flow.Flow{
+		First:   time.UnixMilli(1000),
+		Last:    time.UnixMilli(3000),
+		Bytes:   1000,
+		Packets: 10,
+	}
+	assert.Equal(t, 2*time.Second, f.Duration())
+	assert.Equal(t, float64(4000), f.Bps())
+	assert.Equal(t, float64(5), f.Pps())
+	assert.Equal(t, float64(100), f.Bpp())
+
+	var empty flow.Flow
+	assert.Equal(t, float64(0), empty.Bps())
+	assert.Equal(t, float64(0), empty.Pps())
+	assert.Equal(t, float64(0), empty.Bpp())
+}
+
+func TestMACText(t *testing.T) {
+	mac := flow.MAC{0xaa, 0xbb, 0xcc, 0, 1, 2}
+	text, err := mac.MarshalText()
+	assert.Nil(t, err)
+	assert.Equal(t, "aa:bb:cc:00:01:02", string(text))
+
+	var parsed flow.MAC
+	assert.Nil(t, parsed.UnmarshalText(text))
+	assert.Equal(t, mac, parsed)
+	assert.NotNil(t, parsed.UnmarshalText([]byte("00:00:00:00:fe:80:00:00")))
+}
+
+func TestFlowJSON(t *testing.T) {
+	f := flow.Flow{
+		First:   time.UnixMilli(11220).UTC(),
+		Last:    time.UnixMilli(11229).UTC(),
+		SrcAddr: netip.MustParseAddr("192.168.0.1"),
+		DstAddr: netip.MustParseAddr("192.168.0.2"),
+		SrcPort: 1123,
+		DstPort: 80,
+		Prot:    6,
+		Bytes:   12345,
+		Packets: 20,
+	}
+	data, err := json.Marshal(f)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `"srcip":"192.168.0.1"`)
+	assert.Contains(t, string(data), `"pkts":20`)
+	assert.NotContains(t, string(data), "Present")
+	assert.NotContains(t, string(data), "nexthop")
+	assert.NotContains(t, string(data), "insrcmac")
+
+	var decoded flow.Flow
+	assert.Nil(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, f, decoded)
+}
@@ -0,0 +1,239 @@
+package format
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/matejnesuta/libnf-go/api/flow"
+)
+
+const (
+	timeLayout    = "2006-01-02 15:04:05.000"
+	csvTimeLayout = "2006-01-02 15:04:05"
+	addrWidth     = 16
+	addrWidthLong = 39
+)
+
+// column is a formatting element bound to a configuration.
+// Both the header and the value are already padded to the width of the column.
+type column struct {
+	header string
+	value  func(f *flow.Flow) string
+}
+
+// element creates the column of a % token for the given configuration.
+type element func(c *config) column
+
+// elements maps the tokens of a format template, without the leading %, to their elements.
+// The tokens and headers follow nfdump.
+var elements = map[string]element{
+	"ts":  text("Date first seen", 23, left, func(f *flow.Flow, c *config) string { return c.time(f.First) }),
+	"te":  text("Date last seen", 23, left, func(f *flow.Flow, c *config) string { return c.time(f.Last) }),
+	"tr":  text("Date flow received", 23, left, func(f *flow.Flow, c *config) string { return c.time(time.UnixMilli(int64(f.Received))) }),
+	"td":  text("Duration", 9, right, func(f *flow.Flow, c *config) string { return seconds(f.Duration()) }),
+	"pr":  text("Proto", 5, left, func(f *flow.Flow, c *config) string { return ProtoName(f.Prot) }),
+	"sa":  addr("Src IP Addr", func(f *flow.Flow) netip.Addr { return f.SrcAddr }),
+	"da":  addr("Dst IP Addr", func(f *flow.Flow) netip.Addr { return f.DstAddr }),
+	"sap": addrPort("Src IP Addr", "Port", func(f *flow.Flow) (netip.Addr, uint16) { return f.SrcAddr, f.SrcPort }),
+	"dap": addrPort("Dst IP Addr", "Port", func(f *flow.Flow) (netip.Addr, uint16) { return f.DstAddr, f.DstPort }),
+	"sp":  num("Src Pt", 6, func(f *flow.Flow) uint64 { return uint64(f.SrcPort) }),
+	"dp":  num("Dst Pt", 6, func(f *flow.Flow) uint64 { return uint64(f.DstPort) }),
+	"nh":  addr("Next-hop IP", func(f *flow.Flow) netip.Addr { return f.NextHop }),
+	"nhb": addr("BGP next-hop IP", func(f *flow.Flow) netip.Addr { return f.BgpNextHop }),
+	"ra":  addr("Router IP", func(f *flow.Flow) netip.Addr { return f.IpRouter }),
+	"xsa": addr("X-Src IP Addr", func(f *flow.Flow) netip.Addr { return f.XlateSrcIp }),
+	"xda": addr("X-Dst IP Addr", func(f *flow.Flow) netip.Addr { return f.XlateDstIp }),
+	"xsp": num("X-Src Pt", 8, func(f *flow.Flow) uint64 { return uint64(f.XlateSrcPort) }),
+	"xdp": num("X-Dst Pt", 8, func(f *flow.Flow) uint64 { return uint64(f.XlateDstPort) }),
+	"sas": num("Src AS", 6, func(f *flow.Flow) uint64 { return uint64(f.SrcAS) }),
+	"das": num("Dst AS", 6, func(f *flow.Flow) uint64 { return uint64(f.DstAS) }),
+	"nas": num("Next AS", 7, func(f *flow.Flow) uint64 { return uint64(f.BgpNextAdjacentAS) }),
+	"pas": num("Prev AS", 7, func(f *flow.Flow) uint64 { return uint64(f.BgpPrevAdjacentAS) }),
+	"in":  num("Input", 5, func(f *flow.Flow) uint64 { return uint64(f.Input) }),
+	"out": num("Output", 6, func(f *flow.Flow) uint64 { return uint64(f.Output) }),
+
+	"pkt":  scaled("Packets", 8, func(f *flow.Flow) uint64 { return f.Packets }),
+	"ipkt": scaled("In Pkt", 8, func(f *flow.Flow) uint64 { return f.Packets }),
+	"opkt": scaled("Out Pkt", 8, func(f *flow.Flow) uint64 { return f.OutPackets }),
+	"byt":  scaled("Bytes", 8, func(f *flow.Flow) uint64 { return f.Bytes }),
+	"ibyt": scaled("In Byte", 8, func(f *flow.Flow) uint64 { return f.Bytes }),
+	"obyt": scaled("Out Byte", 8, func(f *flow.Flow) uint64 { return f.OutBytes }),
+	"fl":   num("Flows", 5, func(f *flow.Flow) uint64 { return f.Flows }),
+	"pps":  scaled("pps", 8, func(f *flow.Flow) uint64 { return uint64(f.Pps()) }),
+	"bps":  scaled("bps", 8, func(f *flow.Flow) uint64 { return uint64(f.Bps()) }),
+	"bpp":  num("Bpp", 6, func(f *flow.Flow) uint64 { return uint64(f.Bpp()) }),
+
+	"flg":  text("Flags", 6, left, func(f *flow.Flow, c *config) string { return TcpFlags(f.TcpFlags) }),
+	"tos":  num("Tos", 3, func(f *flow.Flow) uint64 { return uint64(f.Tos) }),
+	"stos": num("STos", 4, func(f *flow.Flow) uint64 { return uint64(f.Tos) }),
+	"dtos": num("DTos", 4, func(f *flow.Flow) uint64 { return uint64(f.DstTos) }),
+	"smk":  num("SMask", 5, func(f *flow.Flow) uint64 { return uint64(f.SrcMask) }),
+	"dmk":  num("DMask", 5, func(f *flow.Flow) uint64 { return uint64(f.DstMask) }),
+	"svln": num("SVlan", 5, func(f *flow.Flow) uint64 { return uint64(f.SrcVlan) }),
+	"dvln": num("DVlan", 5, func(f *flow.Flow) uint64 { return uint64(f.DstVlan) }),
+	"fwd":  num("Fwd", 3, func(f *flow.Flow) uint64 { return uint64(f.FwdStatus) }),
+	"dir":  num("Dir", 3, func(f *flow.Flow) uint64 { return uint64(f.Dir) }),
+	"exid": num("Exp ID", 6, func(f *flow.Flow) uint64 { return uint64(f.ExporterId) }),
+	"eng": text("engine", 7, right, func(f *flow.Flow, c *config) string {
+		return fmt.Sprintf("%d/%d", f.EngineType, f.EngineId)
+	}),
+
+	"ismc": text("In src MAC Addr", 17, right, func(f *flow.Flow, c *config) string { return f.InSrcMac.String() }),
+	"osmc": text("Out src MAC Addr", 17, right, func(f *flow.Flow, c *config) string { return f.OutSrcMac.String() }),
+	"idmc": text("In dst MAC Addr", 17, right, func(f *flow.Flow, c *config) string { return f.InDstMac.String() }),
+	"odmc": text("Out dst MAC Addr", 17, right, func(f *flow.Flow, c *config) string { return f.OutDstMac.String() }),
+
+	"cl":    text("C Latency", 9, right, func(f *flow.Flow, c *config) string { return millis(f.ClientNwDelayUsec) }),
+	"sl":    text("S latency", 9, right, func(f *flow.Flow, c *config) string { return millis(f.ServerNwDelayUsec) }),
+	"al":    text("A latency", 9, right, func(f *flow.Flow, c *config) string { return millis(f.ApplLatencyUsec) }),
+	"uname": text("UserName", 20, left, func(f *flow.Flow, c *config) string { return f.Username }),
+}
+
+func init() {
+	for i := range len(flow.Flow{}.MplsLabel) {
+		elements["mpls"+strconv.Itoa(i+1)] = text("MPLS lbl "+strconv.Itoa(i+1), 14, right, func(f *flow.Flow, c *config) string {
+			return mplsLabel(f.MplsLabel[i])
+		})
+	}
+}
+
+type alignment bool
+
+const (
+	left  alignment = true
+	right alignment = false
+)
+
+func pad(s string, width int, align alignment) string {
+	if len(s) >= width {
+		return s
+	}
+	if align == left {
+		return s + strings.Repeat(" ", width-len(s))
+	}
+	return strings.Repeat(" ", width-len(s)) + s
+}
+
+// text creates an element printing the result of value in a column of the given width.
+func text(header string, width int, align alignment, value func(f *flow.Flow, c *config) string) element {
+	return func(c *config) column {
+		if !c.aligned() {
+			return column{header: header, value: func(f *flow.Flow) string { return value(f, c) }}
+		}
+		return column{
+			header: pad(header, width, align),
+			value:  func(f *flow.Flow) string { return pad(value(f, c), width, align) },
+		}
+	}
+}
+
+func num(header string, width int, value func(f *flow.Flow) uint64) element {
+	return text(header, width, right, func(f *flow.Flow, c *config) string {
+		return strconv.FormatUint(value(f), 10)
+	})
+}
+
+func scaled(header string, width int, value func(f *flow.Flow) uint64) element {
+	return text(header, width, right, func(f *flow.Flow, c *config) string {
+		return c.number(value(f))
+	})
+}
+
+func addr(header string, value func(f *flow.Flow) netip.Addr) element {
+	return func(c *config) column {
+		return text(header, c.addrWidth(), right, func(f *flow.Flow, c *config) string {
+			return c.addr(value(f))
+		})(c)
+	}
+}
+
+// addrPort creates an element printing an address and a port separated by a colon.
+// The address is aligned to the right and the port to the left, as nfdump does.
+func addrPort(addrHeader string, portHeader string, value func(f *flow.Flow) (netip.Addr, uint16)) element {
+	return func(c *config) column {
+		if !c.aligned() {
+			return column{
+				header: addrHeader + ":" + portHeader,
+				value: func(f *flow.Flow) string {
+					a, p := value(f)
+					return c.addr(a) + ":" + strconv.FormatUint(uint64(p), 10)
+				},
+			}
+		}
+		width := c.addrWidth()
+		return column{
+			header: pad(addrHeader, width, right) + ":" + pad(portHeader, 5, left),
+			value: func(f *flow.Flow) string {
+				a, p := value(f)
+				return pad(c.addr(a), width, right) + ":" + pad(strconv.FormatUint(uint64(p), 10), 5, left)
+			},
+		}
+	}
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+func millis(usec uint64) string {
+	return strconv.FormatFloat(float64(usec)/1000, 'f', 3, 64)
+}
+
+func mplsLabel(v uint32) string {
+	return fmt.Sprintf("%d-%d-%d", v>>4, (v&0xF)>>1, v&1)
+}
+
+var protoNames = map[uint8]string{
+	1:   "ICMP",
+	2:   "IGMP",
+	4:   "IPIP",
+	6:   "TCP",
+	17:  "UDP",
+	41:  "IPv6",
+	46:  "RSVP",
+	47:  "GRE",
+	50:  "ESP",
+	51:  "AH",
+	58:  "ICMP6",
+	89:  "OSPF",
+	103: "PIM",
+	112: "VRRP",
+	132: "SCTP",
+}
+
+// ProtoName returns the name of an IP protocol as printed by nfdump (e.g. "TCP"),
+// or its number for protocols without a name.
+func ProtoName(proto uint8) string {
+	if name, ok := protoNames[proto]; ok {
+		return name
+	}
+	return strconv.Itoa(int(proto))
+}
+
+// TcpFlags returns the TCP flags as printed by nfdump, one character per flag
+// in the order URG, ACK, PSH, RST, SYN, FIN with a dot for each flag not set
+// (e.g. ".AP.SF"). Flags with the CWR or ECE bit set are printed as a hex number.
+func TcpFlags(flags uint8) string {
+	if flags > 63 {
+		return fmt.Sprintf("0x%02x", flags)
+	}
+	s := []byte("......")
+	for i, c := range "UAPRSF" {
+		if flags&(32>>i) != 0 {
+			s[i] = byte(c)
+		}
+	}
+	return string(s)
+}
+
+// condense shortens an IPv6 address to 16 characters as nfdump does,
+// keeping its first and last 7 characters.
+func condense(s string) string {
+	if len(s) <= addrWidth {
+		return s
+	}
+	return s[:7] + ".." + s[len(s)-7:]
+}
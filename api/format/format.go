@@ -0,0 +1,300 @@
+// Package format prints flow records as text, the way the -o option of nfdump does.
+//
+// A Formatter is created from a format name, either one of the predefined
+// formats (Line, Long, Extended, Raw and CSV) or a custom template prefixed
+// with "fmt:", e.g. "fmt:%ts %td %pr %sap -> %dap %pkt %byt". Templates use the
+// % tokens of nfdump; any other text is printed as is.
+package format
+
+import (
+	"fmt"
+	"net/netip"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/matejnesuta/libnf-go/api/fields"
+	"github.com/matejnesuta/libnf-go/api/flow"
+	"github.com/matejnesuta/libnf-go/api/record"
+)
+
+// A list of predefined formats.
+const (
+	Line     = "line"
+	Long     = "long"
+	Extended = "extended"
+	Raw      = "raw"
+	CSV      = "csv"
+)
+
+// TemplatePrefix marks a custom format template.
+const TemplatePrefix = "fmt:"
+
+var predefined = map[string]string{
+	Line:     "%ts %td %pr %sap -> %dap %pkt %byt %fl",
+	Long:     "%ts %td %pr %sap -> %dap %flg %tos %pkt %byt %fl",
+	Extended: "%ts %td %pr %sap -> %dap %flg %tos %pkt %byt %pps %bps %bpp %fl",
+	CSV: "%ts,%te,%td,%sa,%da,%sp,%dp,%pr,%flg,%fwd,%stos,%ipkt,%ibyt,%opkt,%obyt,%in,%out," +
+		"%sas,%das,%smk,%dmk,%dtos,%dir,%nh,%nhb,%svln,%dvln,%ismc,%odmc,%idmc,%osmc," +
+		"%mpls1,%mpls2,%mpls3,%mpls4,%mpls5,%mpls6,%mpls7,%mpls8,%mpls9,%mpls10," +
+		"%cl,%sl,%al,%ra,%eng,%exid,%tr",
+}
+
+// Options control how values are printed.
+type Options struct {
+	// NoScale prints numbers in full (1200000) instead of scaling them (1.2 M), like nfdump -N.
+	NoScale bool
+	// NoAlign separates the columns by the template text only, without padding them to their width.
+	NoAlign bool
+	// LongIPv6 prints IPv6 addresses in full instead of condensing them to 16 characters, like nfdump -6.
+	LongIPv6 bool
+	// Location is the time zone of printed timestamps. Local time is used if nil.
+	Location *time.Location
+}
+
+// config holds the options of a Formatter together with the settings implied by its format.
+type config struct {
+	Options
+	csv bool
+}
+
+func (c *config) aligned() bool {
+	return !c.NoAlign && !c.csv
+}
+
+func (c *config) addrWidth() int {
+	if c.LongIPv6 {
+		return addrWidthLong
+	}
+	return addrWidth
+}
+
+func (c *config) time(t time.Time) string {
+	loc := c.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	if c.csv {
+		return t.In(loc).Format(csvTimeLayout)
+	}
+	return t.In(loc).Format(timeLayout)
+}
+
+func (c *config) addr(a netip.Addr) string {
+	if !a.IsValid() {
+		return "0.0.0.0"
+	}
+	if !a.Is6() || c.LongIPv6 || c.csv {
+		return a.String()
+	}
+	return condense(a.String())
+}
+
+func (c *config) number(n uint64) string {
+	if c.NoScale || c.csv {
+		return strconv.FormatUint(n, 10)
+	}
+	return Scale(n)
+}
+
+// Scale returns the number scaled as nfdump does, with one decimal place and
+// a T, G or M suffix for numbers of at least a million (e.g. "1.2 M").
+// Smaller numbers are returned in full.
+func Scale(n uint64) string {
+	f := float64(n)
+	switch {
+	case f >= 1e12:
+		return strconv.FormatFloat(f/1e12, 'f', 1, 64) + " T"
+	case f >= 1e9:
+		return strconv.FormatFloat(f/1e9, 'f', 1, 64) + " G"
+	case f >= 1e6:
+		return strconv.FormatFloat(f/1e6, 'f', 1, 64) + " M"
+	default:
+		return strconv.FormatUint(n, 10)
+	}
+}
+
+// part is either literal template text or a column.
+type part struct {
+	literal string
+	column  *column
+}
+
+// Formatter prints flows in a given format. It is safe for concurrent use.
+type Formatter struct {
+	config config
+	parts  []part
+	raw    bool
+}
+
+// New creates a Formatter for the named predefined format or a "fmt:" template.
+// An error is returned for an unknown format or a template with an unknown token.
+func New(format string, opts Options) (*Formatter, error) {
+	f := &Formatter{config: config{Options: opts}}
+	template, ok := strings.CutPrefix(format, TemplatePrefix)
+	if !ok {
+		switch format {
+		case Raw:
+			f.raw = true
+			return f, nil
+		case CSV:
+			f.config.csv = true
+		}
+		template, ok = predefined[format]
+		if !ok {
+			return nil, fmt.Errorf("format: unknown format %q", format)
+		}
+	}
+	parts, err := parse(template, &f.config)
+	if err != nil {
+		return nil, err
+	}
+	f.parts = parts
+	return f, nil
+}
+
+// parse splits the template into literal text and columns. Tokens are matched
+// greedily, so "%sap" is the source address and port, not "%sa" followed by "p".
+func parse(template string, c *config) ([]part, error) {
+	var parts []part
+	var literal strings.Builder
+	for i := 0; i < len(template); {
+		if template[i] != '%' {
+			literal.WriteByte(template[i])
+			i++
+			continue
+		}
+		end := i + 1
+		for end < len(template) && isTokenChar(template[end]) {
+			end++
+		}
+		if end == i+1 {
+			return nil, fmt.Errorf("format: missing token after %% at offset %d in %q", i, template)
+		}
+		token := template[i+1 : end]
+		for ; len(token) > 0; token = token[:len(token)-1] {
+			if _, ok := elements[token]; ok {
+				break
+			}
+		}
+		if token == "" {
+			return nil, fmt.Errorf("format: unknown token %q in %q", template[i:end], template)
+		}
+		if literal.Len() > 0 {
+			parts = append(parts, part{literal: literal.String()})
+			literal.Reset()
+		}
+		col := elements[token](c)
+		if c.csv {
+			col.header = token
+		}
+		parts = append(parts, part{column: &col})
+		i += 1 + len(token)
+	}
+	if literal.Len() > 0 {
+		parts = append(parts, part{literal: literal.String()})
+	}
+	return parts, nil
+}
+
+func isTokenChar(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= '0' && b <= '9'
+}
+
+// Header returns the header line of the format, without a trailing newline.
+// Literal template text other than commas is replaced by spaces, so the titles
+// stay above their columns. The raw format has no header.
+func (f *Formatter) Header() string {
+	var sb strings.Builder
+	for _, p := range f.parts {
+		if p.column != nil {
+			sb.WriteString(p.column.header)
+			continue
+		}
+		for _, r := range p.literal {
+			if r == ',' {
+				sb.WriteRune(r)
+			} else {
+				sb.WriteByte(' ')
+			}
+		}
+	}
+	return sb.String()
+}
+
+// Format returns the flow printed in the format of f, without a trailing newline.
+// The raw format prints one line per field set in the flow.
+func (f *Formatter) Format(fl *flow.Flow) string {
+	if f.raw {
+		return f.formatRaw(fl)
+	}
+	var sb strings.Builder
+	for _, p := range f.parts {
+		if p.column != nil {
+			sb.WriteString(p.column.value(fl))
+		} else {
+			sb.WriteString(p.literal)
+		}
+	}
+	return sb.String()
+}
+
+// FormatRecord returns the record printed in the format of f. See Format.
+func (f *Formatter) FormatRecord(r *record.Record) (string, error) {
+	fl, err := r.ToFlow()
+	if err != nil {
+		return "", err
+	}
+	return f.Format(&fl), nil
+}
+
+// formatRaw prints every field set in the flow on its own line, named as in libnf.
+func (f *Formatter) formatRaw(fl *flow.Flow) string {
+	var sb strings.Builder
+	sb.WriteString("Flow Record:")
+	v := reflect.ValueOf(fl).Elem()
+	for i, field := range flow.Fields {
+		if !fl.Has(field) {
+			continue
+		}
+		var value string
+		switch field {
+		case fields.TcpFlags:
+			value = fmt.Sprintf("0x%02x %s", fl.TcpFlags, TcpFlags(fl.TcpFlags))
+		case fields.Prot:
+			value = fmt.Sprintf("%d %s", fl.Prot, ProtoName(fl.Prot))
+		case fields.Received, fields.EventTime:
+			ms := v.Field(i).Uint()
+			value = fmt.Sprintf("%d [%s]", ms, f.config.time(time.UnixMilli(int64(ms))))
+		default:
+			value = f.rawValue(v.Field(i).Interface())
+		}
+		sb.WriteString("\n  ")
+		if f.config.aligned() {
+			fmt.Fprintf(&sb, "%-17s = %17s", fields.Name(field), value)
+		} else {
+			fmt.Fprintf(&sb, "%s = %s", fields.Name(field), value)
+		}
+	}
+	return sb.String()
+}
+
+func (f *Formatter) rawValue(v any) string {
+	switch v := v.(type) {
+	case time.Time:
+		return fmt.Sprintf("%d [%s]", v.UnixMilli(), f.config.time(v))
+	case netip.Addr:
+		return v.String()
+	case fields.Mpls:
+		labels := make([]string, 0, len(v))
+		for _, l := range v {
+			if l != 0 {
+				labels = append(labels, mplsLabel(l))
+			}
+		}
+		return strings.Join(labels, " ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,162 @@
+package format_test
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matejnesuta/libnf-go/api/errors"
+	"github.com/matejnesuta/libnf-go/api/file"
+	"github.com/matejnesuta/libnf-go/api/flow"
+	"github.com/matejnesuta/libnf-go/api/format"
+	"github.com/matejnesuta/libnf-go/api/record"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sampleFlow() flow.Flow {
+	f := flow.Flow{
+		First:    time.UnixMilli(1495979700123).UTC(),
+		Last:     time.UnixMilli(1495979702623).UTC(),
+		SrcAddr:  netip.MustParseAddr("192.168.0.1"),
+		DstAddr:  netip.MustParseAddr("192.168.0.2"),
+		SrcPort:  1123,
+		DstPort:  80,
+		Prot:     6,
+		TcpFlags: 0x1b,
+		Tos:      4,
+		Packets:  20,
+		Bytes:    1234567,
+		Flows:    1,
+	}
+	f.MarkNonZero()
+	return f
+}
+
+func TestLineFormat(t *testing.T) {
+	f, err := format.New(format.Line, format.Options{Location: time.UTC})
+	assert.Equal(t, nil, err)
+
+	fl := sampleFlow()
+	assert.Equal(t,
+		"2017-05-28 13:55:00.123     2.500 TCP        192.168.0.1:1123  ->      192.168.0.2:80          20    1.2 M     1",
+		f.Format(&fl))
+	assert.Equal(t,
+		"Date first seen          Duration Proto      Src IP Addr:Port          Dst IP Addr:Port   Packets    Bytes Flows",
+		f.Header())
+}
+
+func TestExtendedFormat(t *testing.T) {
+	f, err := format.New(format.Extended, format.Options{Location: time.UTC, NoScale: true})
+	assert.Equal(t, nil, err)
+
+	fl := sampleFlow()
+	assert.Equal(t,
+		"2017-05-28 13:55:00.123     2.500 TCP        192.168.0.1:1123  ->      192.168.0.2:80    .AP.SF   4       20  1234567        8  3950614  61728     1",
+		f.Format(&fl))
+}
+
+func TestTemplate(t *testing.T) {
+	f, err := format.New("fmt:%ts %td %pr %sap -> %dap %pkt %byt", format.Options{Location: time.UTC, NoAlign: true})
+	assert.Equal(t, nil, err)
+
+	fl := sampleFlow()
+	assert.Equal(t, "2017-05-28 13:55:00.123 2.500 TCP 192.168.0.1:1123 -> 192.168.0.2:80 20 1.2 M", f.Format(&fl))
+	assert.Equal(t, "Date first seen Duration Proto Src IP Addr:Port    Dst IP Addr:Port Packets Bytes", f.Header())
+
+	f, err = format.New("fmt:%sa|%sas|%sp", format.Options{NoAlign: true})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "192.168.0.1|0|1123", f.Format(&fl))
+}
+
+func TestUnknownFormat(t *testing.T) {
+	_, err := format.New("wide", format.Options{})
+	assert.NotEqual(t, nil, err)
+
+	_, err = format.New("fmt:%ts %xyz", format.Options{})
+	assert.NotEqual(t, nil, err)
+
+	_, err = format.New("fmt:100%", format.Options{})
+	assert.NotEqual(t, nil, err)
+}
+
+func TestCSVFormat(t *testing.T) {
+	f, err := format.New(format.CSV, format.Options{Location: time.UTC})
+	assert.Equal(t, nil, err)
+
+	header := strings.Split(f.Header(), ",")
+	assert.Equal(t, "ts", header[0])
+	assert.Equal(t, "tr", header[len(header)-1])
+
+	fl := sampleFlow()
+	values := strings.Split(f.Format(&fl), ",")
+	assert.Equal(t, len(header), len(values))
+	assert.Equal(t, "2017-05-28 13:55:00", values[0])
+	assert.Equal(t, "192.168.0.1", values[3])
+	assert.Equal(t, "TCP", values[7])
+	assert.Equal(t, "1234567", values[12])
+}
+
+func TestScale(t *testing.T) {
+	assert.Equal(t, "999999", format.Scale(999999))
+	assert.Equal(t, "1.2 M", format.Scale(1200000))
+	assert.Equal(t, "3.5 G", format.Scale(3500000000))
+	assert.Equal(t, "1.0 T", format.Scale(1000000000000))
+}
+
+func TestIPv6Addresses(t *testing.T) {
+	fl := sampleFlow()
+	fl.SrcAddr = netip.MustParseAddr("2001:db8:1234:5678::1")
+
+	f, err := format.New("fmt:%sa", format.Options{})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "2001:db..5678::1", strings.TrimSpace(f.Format(&fl)))
+
+	f, err = format.New("fmt:%sa", format.Options{LongIPv6: true})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "                  2001:db8:1234:5678::1", f.Format(&fl))
+}
+
+func TestTcpFlags(t *testing.T) {
+	assert.Equal(t, "......", format.TcpFlags(0))
+	assert.Equal(t, ".AP.SF", format.TcpFlags(0x1b))
+	assert.Equal(t, "UAPRSF", format.TcpFlags(0x3f))
+	assert.Equal(t, "0xc2", format.TcpFlags(0xc2))
+}
+
+func TestRawFormat(t *testing.T) {
+	f, err := format.New(format.Raw, format.Options{Location: time.UTC, NoAlign: true})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "", f.Header())
+
+	fl := sampleFlow()
+	lines := strings.Split(f.Format(&fl), "\n")
+	assert.Equal(t, "Flow Record:", lines[0])
+	assert.Contains(t, lines, "  srcip = 192.168.0.1")
+	assert.Contains(t, lines, "  proto = 6 TCP")
+	assert.Contains(t, lines, "  tcpflags = 0x1b .AP.SF")
+	assert.NotContains(t, lines, "  srcas = 0")
+}
+
+func TestFormatRecord(t *testing.T) {
+	var ptr file.File
+	err := ptr.OpenRead("../testfiles/ipv4-file.tmp", false, false)
+	assert.Equal(t, nil, err)
+	defer ptr.Close()
+
+	rec, err := record.NewRecord()
+	assert.Equal(t, nil, err)
+	defer rec.Free()
+	assert.Equal(t, nil, ptr.GetNextRecord(&rec))
+
+	f, err := format.New("fmt:%pr %sap -> %dap %pkt %byt", format.Options{NoAlign: true})
+	assert.Equal(t, nil, err)
+	line, err := f.FormatRecord(&rec)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "TCP 192.168.0.1:1123 -> 192.168.0.2:80 20 12345", line)
+
+	rec.Free()
+	_, err = f.FormatRecord(&rec)
+	assert.ErrorIs(t, err, errors.ErrRecordNotAllocated)
+}
@@ -0,0 +1,18 @@
+//go:build libnf_debug
+
+package handle
+
+import (
+	"log"
+	"runtime/debug"
+)
+
+const debugBuild = true
+
+func stack() []byte {
+	return debug.Stack()
+}
+
+func report(kind string, stack []byte) {
+	log.Printf("libnf-go: %s was garbage collected without being freed, allocated at:\n%s", kind, stack)
+}
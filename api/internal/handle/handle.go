@@ -0,0 +1,92 @@
+// Package handle tracks the C resources owned by the libnf wrappers, so they
+// can be released by the garbage collector when a wrapper is dropped without
+// calling Free or Close.
+package handle
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+var (
+	autoRelease atomic.Bool
+	live        atomic.Int64
+	collected   atomic.Uint64
+)
+
+// SetAutoRelease enables or disables releasing of unreachable resources.
+// The setting applies to handles created afterwards.
+func SetAutoRelease(enabled bool) { autoRelease.Store(enabled) }
+
+// AutoRelease reports whether unreachable resources are released.
+func AutoRelease() bool { return autoRelease.Load() }
+
+// Live returns the number of resources that were neither freed nor collected.
+func Live() int64 { return live.Load() }
+
+// Collected returns the number of resources that became unreachable without
+// being freed.
+func Collected() uint64 { return collected.Load() }
+
+// Handle is shared by all copies of a wrapper. The wrapper holds a pointer to
+// it, so it becomes unreachable only once all copies of the wrapper are gone.
+type Handle struct {
+	kind     string
+	ptr      uintptr
+	release  func(uintptr)
+	free     bool
+	stack    []byte
+	released bool
+}
+
+// New returns a handle for the C resource ptr of the given kind (e.g. "Record").
+// If auto release is enabled, release is called with ptr once the handle becomes
+// unreachable, unless Release was called before.
+func New(kind string, ptr uintptr, release func(uintptr)) *Handle {
+	live.Add(1)
+	h := &Handle{kind: kind, ptr: ptr, release: release, free: autoRelease.Load()}
+	if h.free || debugBuild {
+		h.stack = stack()
+		runtime.SetFinalizer(h, collect)
+	}
+	return h
+}
+
+func collect(h *Handle) {
+	live.Add(-1)
+	collected.Add(1)
+	report(h.kind, h.stack)
+	if h.free {
+		h.release(h.ptr)
+	}
+}
+
+// Ptr returns the resource tracked by the handle, 0 for a nil handle.
+func (h *Handle) Ptr() uintptr {
+	if h == nil {
+		return 0
+	}
+	return h.ptr
+}
+
+// Replace makes the handle track ptr instead of its current resource, e.g.
+// after the wrapper reopened it. The caller releases the previous resource.
+func (h *Handle) Replace(ptr uintptr) {
+	h.ptr = ptr
+}
+
+// Released reports whether Release was called. A nil handle counts as released.
+func (h *Handle) Released() bool {
+	return h == nil || h.released
+}
+
+// Release marks the resource as freed explicitly, so it is not released again
+// once the handle becomes unreachable.
+func (h *Handle) Release() {
+	if h == nil || h.released {
+		return
+	}
+	h.released = true
+	runtime.SetFinalizer(h, nil)
+	live.Add(-1)
+}
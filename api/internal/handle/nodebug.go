@@ -0,0 +1,9 @@
+//go:build !libnf_debug
+
+package handle
+
+const debugBuild = false
+
+func stack() []byte { return nil }
+
+func report(kind string, stack []byte) {}
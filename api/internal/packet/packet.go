@@ -0,0 +1,142 @@
+// Package packet decodes the headers of captured or sampled packets into the
+// fields of a flow. It is shared by the sFlow decoder of the collector and
+// by the flow meter.
+package packet
+
+import (
+	"encoding/binary"
+	"net/netip"
+
+	"github.com/matejnesuta/libnf-go/api/fields"
+	"github.com/matejnesuta/libnf-go/api/flow"
+)
+
+// A list of EtherTypes.
+const (
+	EtherTypeIPv4 = 0x0800
+	EtherTypeIPv6 = 0x86dd
+	EtherTypeVlan = 0x8100
+	EtherTypeQinQ = 0x88a8
+)
+
+// Ethernet decodes an Ethernet header with any number of VLAN tags and the IP
+// packet it carries. The outermost VLAN ID is stored in fields.SrcVlan.
+// Returns the offset of the IP header and the length of the IP packet given
+// by its header, or -1 and 0 if the frame does not carry IP.
+func Ethernet(f *flow.Flow, b []byte) (offset int, length int) {
+	if len(b) < 14 {
+		return -1, 0
+	}
+	f.OutDstMac, f.InSrcMac = flow.MAC(b[0:6]), flow.MAC(b[6:12])
+	mark(f, fields.InSrcMac, fields.OutDstMac)
+
+	offset = 12
+	etherType := binary.BigEndian.Uint16(b[offset:])
+	for (etherType == EtherTypeVlan || etherType == EtherTypeQinQ) && len(b) >= offset+8 {
+		if !f.Has(fields.SrcVlan) {
+			f.SrcVlan = binary.BigEndian.Uint16(b[offset+2:]) & 0xfff
+			mark(f, fields.SrcVlan)
+		}
+		offset += 4
+		etherType = binary.BigEndian.Uint16(b[offset:])
+	}
+	offset += 2
+
+	switch etherType {
+	case EtherTypeIPv4:
+		length = IPv4(f, b[offset:])
+	case EtherTypeIPv6:
+		length = IPv6(f, b[offset:])
+	default:
+		return -1, 0
+	}
+	if length == 0 {
+		return -1, 0
+	}
+	return offset, length
+}
+
+// IPv4 decodes an IPv4 header and the transport header following it. Returns
+// the total length of the packet given by the header, or 0 if b does not start
+// with an IPv4 header.
+func IPv4(f *flow.Flow, b []byte) int {
+	if len(b) < 20 || b[0]>>4 != 4 {
+		return 0
+	}
+	f.Tos = b[1]
+	f.Prot = b[9]
+	f.SrcAddr = netip.AddrFrom4([4]byte(b[12:16]))
+	f.DstAddr = netip.AddrFrom4([4]byte(b[16:20]))
+	mark(f, fields.Tos, fields.Prot, fields.SrcAddr, fields.DstAddr)
+
+	headerLen := int(b[0]&0xf) * 4
+	fragmentOffset := binary.BigEndian.Uint16(b[6:]) & 0x1fff
+	if fragmentOffset == 0 && headerLen >= 20 && len(b) >= headerLen {
+		transport(f, b[headerLen:])
+	}
+	return int(binary.BigEndian.Uint16(b[2:]))
+}
+
+// IPv6 decodes an IPv6 header, its extension headers and the transport header.
+// Returns the length of the packet given by the header, or 0 if b does not start
+// with an IPv6 header.
+func IPv6(f *flow.Flow, b []byte) int {
+	if len(b) < 40 || b[0]>>4 != 6 {
+		return 0
+	}
+	f.Tos = uint8(binary.BigEndian.Uint16(b[0:]) >> 4)
+	f.SrcAddr = netip.AddrFrom16([16]byte(b[8:24]))
+	f.DstAddr = netip.AddrFrom16([16]byte(b[24:40]))
+	mark(f, fields.Tos, fields.Prot, fields.SrcAddr, fields.DstAddr)
+	length := 40 + int(binary.BigEndian.Uint16(b[4:]))
+
+	next, offset := b[6], 40
+	for (next == 0 || next == 43 || next == 60) && len(b) >= offset+2 {
+		// Hop-by-hop, routing and destination options.
+		next, offset = b[offset], offset+(int(b[offset+1])+1)*8
+	}
+	f.Prot = next
+	if next == 44 && len(b) >= offset+8 {
+		// Only the first fragment holds the transport header.
+		f.Prot = b[offset]
+		if binary.BigEndian.Uint16(b[offset+2:])>>3 != 0 {
+			return length
+		}
+		offset += 8
+	}
+	if len(b) >= offset {
+		transport(f, b[offset:])
+	}
+	return length
+}
+
+// transport decodes the ports of TCP, UDP and SCTP and the TCP flags.
+// Like nfcapd, ICMP type and code are also stored as the destination port.
+func transport(f *flow.Flow, b []byte) {
+	switch f.Prot {
+	case 6, 17, 132:
+		if len(b) < 4 {
+			return
+		}
+		f.SrcPort = binary.BigEndian.Uint16(b[0:])
+		f.DstPort = binary.BigEndian.Uint16(b[2:])
+		mark(f, fields.SrcPort, fields.DstPort)
+		if f.Prot == 6 && len(b) >= 14 {
+			f.TcpFlags = b[13] & 0x3f
+			mark(f, fields.TcpFlags)
+		}
+	case 1, 58:
+		if len(b) < 2 {
+			return
+		}
+		f.IcmpType, f.IcmpCode = b[0], b[1]
+		f.DstPort = uint16(b[0])<<8 | uint16(b[1])
+		mark(f, fields.IcmpType, fields.IcmpCode, fields.DstPort)
+	}
+}
+
+func mark(f *flow.Flow, list ...int) {
+	for _, field := range list {
+		f.Present.Add(field)
+	}
+}
@@ -18,17 +18,20 @@ package memheap
 import "C"
 
 import (
+	"runtime"
+	"strconv"
 	"unsafe"
 
 	"github.com/matejnesuta/libnf-go/api/errors"
+	"github.com/matejnesuta/libnf-go/api/internal/handle"
 	"github.com/matejnesuta/libnf-go/api/record"
 	"github.com/matejnesuta/libnf-go/internal"
 )
 
 // MemHeap represents a memory heap used for storing flow records.
 type MemHeap struct {
-	ptr       uintptr
-	allocated bool
+	ptr uintptr
+	h   *handle.Handle // Shared by all copies, tracks whether the heap was freed.
 }
 
 // MemHeapCursor represents a cursor used to navigate through records in the memory heap.
@@ -71,7 +74,7 @@ const (
 
 // Check if the memory heap is allocated.
 func (m *MemHeap) Allocated() bool {
-	return m.allocated
+	return !m.h.Released()
 }
 
 // Initialize empty memheap object and allocate all necessary resources.
@@ -81,39 +84,41 @@ func NewMemHeap() (MemHeap, error) {
 	if status == internal.ERR_NOMEM {
 		return memHeap, errors.ErrNoMem
 	} else if status == internal.ERR_OTHER {
-		return memHeap, errors.ErrOther
+		return memHeap, errors.Wrap("memheap init", "", status, errors.ErrOther)
 	}
 
-	memHeap.allocated = true
+	memHeap.h = handle.New("MemHeap", memHeap.ptr, internal.Mem_free)
 	return memHeap, nil
 }
 
 // Free all resources allocated for the MemHeap object.
 func (m *MemHeap) Free() error {
-	if !m.allocated {
+	if !m.Allocated() {
 		return errors.ErrMemHeapNotAllocated
 	}
+	m.h.Release()
 	internal.Mem_free(m.ptr)
-	m.allocated = false
 	return nil
 }
 
 // Clean all data in memheap. The memheap will be in the same state as it was after the initialization.
 func (m *MemHeap) Clear() error {
-	if !m.allocated {
+	if !m.Allocated() {
 		return errors.ErrMemHeapNotAllocated
 	}
 	internal.Mem_clean(m.ptr)
+	runtime.KeepAlive(m)
 	return nil
 }
 
 // Set the cursor position to the first record in MemHeap.
 func (m *MemHeap) FirstRecordPosition() (MemHeapCursor, error) {
-	if !m.allocated {
+	if !m.Allocated() {
 		return MemHeapCursor{}, errors.ErrMemHeapNotAllocated
 	}
 	cursor := MemHeapCursor{}
 	status := internal.Mem_first_c(m.ptr, &cursor.ptr)
+	runtime.KeepAlive(m)
 	if status == internal.EOF {
 		return cursor, errors.ErrMemHeapEnd
 	} else if status == internal.ERR_NOMEM {
@@ -124,10 +129,11 @@ func (m *MemHeap) FirstRecordPosition() (MemHeapCursor, error) {
 
 // Set the cursor position to the next record in MemHeap.
 func (m *MemHeap) NextRecordPosition(c *MemHeapCursor) error {
-	if !m.allocated {
+	if !m.Allocated() {
 		return errors.ErrMemHeapNotAllocated
 	}
 	status := internal.Mem_next_c(m.ptr, &c.ptr)
+	runtime.KeepAlive(m)
 	if status == internal.EOF {
 		return errors.ErrMemHeapEnd
 	} else if status == internal.ERR_NOMEM {
@@ -138,12 +144,14 @@ func (m *MemHeap) NextRecordPosition(c *MemHeapCursor) error {
 
 // Read next record from the MemHeap.
 func (m *MemHeap) GetNextRecord(r *record.Record) error {
-	if !m.allocated {
+	if !m.Allocated() {
 		return errors.ErrMemHeapNotAllocated
 	} else if !r.Allocated() {
 		return errors.ErrRecordNotAllocated
 	}
 	status := internal.Mem_read(m.ptr, r.GetPtr())
+	runtime.KeepAlive(m)
+	runtime.KeepAlive(r)
 	if status == internal.ERR_NOMEM {
 		return errors.ErrNoMem
 	} else if status == internal.EOF {
@@ -155,7 +163,7 @@ func (m *MemHeap) GetNextRecord(r *record.Record) error {
 // Write record to the MemHeap object. A thread must be locked to the OS thread using runtime.LockOSThread() before calling this function.
 // It is possible to call this function from multiple goroutines, but each goroutine must lock to the OS thread before calling this function and the MergeThreads function must be called at the end of each goroutine.
 func (m *MemHeap) WriteRecord(r *record.Record) error {
-	if !m.allocated {
+	if !m.Allocated() {
 		return errors.ErrMemHeapNotAllocated
 	} else if !r.Allocated() {
 		return errors.ErrRecordNotAllocated
@@ -165,22 +173,26 @@ func (m *MemHeap) WriteRecord(r *record.Record) error {
 		(unsafe.Pointer(m.ptr)),
 		(unsafe.Pointer(r.GetPtr())),
 	))
+	runtime.KeepAlive(m)
+	runtime.KeepAlive(r)
 	if status == internal.ERR_NOMEM {
 		return errors.ErrNoMem
 	} else if status == internal.ERR_OTHER {
-		return errors.ErrOther
+		return errors.Wrap("memheap write", "", status, errors.ErrOther)
 	}
 	return nil
 }
 
 // Read next record on the position given by cursor.
 func (m *MemHeap) GetRecordWithCursor(c *MemHeapCursor, r *record.Record) error {
-	if !m.allocated {
+	if !m.Allocated() {
 		return errors.ErrMemHeapNotAllocated
 	} else if !r.Allocated() {
 		return errors.ErrRecordNotAllocated
 	}
 	status := internal.Mem_read_c(m.ptr, c.ptr, r.GetPtr())
+	runtime.KeepAlive(m)
+	runtime.KeepAlive(r)
 	if status == internal.ERR_NOMEM {
 		return errors.ErrNoMem
 	} else if status == internal.EOF {
@@ -191,13 +203,15 @@ func (m *MemHeap) GetRecordWithCursor(c *MemHeapCursor, r *record.Record) error
 
 // Set the cursor position to the record identified by key fields.
 func (m *MemHeap) GetRecordWithKey(r *record.Record) (MemHeapCursor, error) {
-	if !m.allocated {
+	if !m.Allocated() {
 		return MemHeapCursor{}, errors.ErrMemHeapNotAllocated
 	} else if !r.Allocated() {
 		return MemHeapCursor{}, errors.ErrRecordNotAllocated
 	}
 	cursor := MemHeapCursor{}
 	status := internal.Mem_lookup_c(m.ptr, r.GetPtr(), &cursor.ptr)
+	runtime.KeepAlive(m)
+	runtime.KeepAlive(r)
 	if status == internal.EOF {
 		return cursor, errors.ErrMemHeapEnd
 	} else if status == internal.ERR_NOMEM {
@@ -208,10 +222,11 @@ func (m *MemHeap) GetRecordWithKey(r *record.Record) (MemHeapCursor, error) {
 
 // When multiple goroutines are used to write records to the same heap, this function must be called at the end of each goroutine.
 func (m *MemHeap) MergeThreads() error {
-	if !m.allocated {
+	if !m.Allocated() {
 		return errors.ErrMemHeapNotAllocated
 	}
 	status := internal.Mem_merge_threads(m.ptr)
+	runtime.KeepAlive(m)
 	if status == internal.ERR_NOMEM {
 		return errors.ErrNoMem
 	} else if status == internal.EOF {
@@ -222,25 +237,27 @@ func (m *MemHeap) MergeThreads() error {
 
 // Set fast aggregation mode.
 func (m *MemHeap) SetFastAggr(option int) error {
-	if !m.allocated {
+	if !m.Allocated() {
 		return errors.ErrMemHeapNotAllocated
 	}
 	status := internal.Mem_fastaggr(m.ptr, option)
+	runtime.KeepAlive(m)
 	if status == internal.ERR_NOMEM {
 		return errors.ErrNoMem
 	} else if status == internal.ERR_OTHER {
-		return errors.ErrOther
+		return errors.Wrap("memheap fast aggregation", "", status, errors.ErrOther)
 	}
 	return nil
 }
 
 func callMemHeapSetOpt(m *MemHeap, opt int, data uintptr, size int64) error {
-	if !m.allocated {
+	if !m.Allocated() {
 		return errors.ErrMemHeapNotAllocated
 	}
 	status := internal.Mem_setopt(m.ptr, opt, data, size)
+	runtime.KeepAlive(m)
 	if status == internal.ERR_OTHER {
-		return errors.ErrOther
+		return errors.Wrap("memheap set option", "", status, errors.ErrOther)
 	}
 	return nil
 }
@@ -294,12 +311,13 @@ func (m *MemHeap) EnableNfdumpCompat() error {
 //
 // Returns an error if the MemHeap has not been allocated or if the internal call fails.
 func (m *MemHeap) SetAggrOptions(field int, aggrType int, sortType int, numBits int, numBits6 int) error {
-	if !m.allocated {
+	if !m.Allocated() {
 		return errors.ErrMemHeapNotAllocated
 	}
 	status := internal.Mem_fadd(m.ptr, field, aggrType|sortType, numBits, numBits6)
+	runtime.KeepAlive(m)
 	if status == internal.ERR_OTHER {
-		return errors.ErrOther
+		return errors.Wrap("memheap aggregation options", "field "+strconv.Itoa(field), status, errors.ErrOther)
 	} else if status == internal.ERR_NOMEM {
 		return errors.ErrNoMem
 	}
@@ -1,7 +1,9 @@
 package memheapv2
 
 import (
+	"iter"
 	"net"
+	"net/netip"
 	"strconv"
 	"time"
 
@@ -150,6 +152,19 @@ func (m *MemHeapV2) SortAggrOptions(field int, aggrType int, sortType int, numBi
 	return nil
 }
 
+// maskAddr applies the numbits (IPv4) or numbits6 (IPv6) prefix length to the address.
+func maskAddr(addr netip.Addr, opts fieldOptions) netip.Addr {
+	bits := int(opts.numbits6)
+	if addr.Is4() {
+		bits = int(opts.numbits)
+	}
+	if bits > addr.BitLen() {
+		return addr
+	}
+	prefix, _ := addr.Prefix(bits)
+	return prefix.Addr()
+}
+
 func buildKey(record *record.Record, keyTemplateList []fieldOptions, pairset int) (string, []any, error) {
 	var keyVals []any
 	key := ""
@@ -161,20 +176,19 @@ func buildKey(record *record.Record, keyTemplateList []fieldOptions, pairset int
 		} else {
 			field = x.field
 		}
-		val, err := record.GetField(field)
+		var val any
+		var err error
+		if _, ok := fields.FieldTypes[field].(net.IP); ok {
+			var addr netip.Addr
+			addr, err = record.GetAddr(field)
+			val = maskAddr(addr, x)
+		} else {
+			val, err = record.GetField(field)
+		}
 		if err != nil {
 			return "", nil, err
 		}
 
-		ip, ok := val.(net.IP)
-		if ok {
-			if ip.To4() != nil {
-				val = ip.Mask(net.CIDRMask(int(x.numbits), 32))
-			} else {
-				val = ip.Mask(net.CIDRMask(int(x.numbits6), 128))
-			}
-		}
-
 		keyVals = append(keyVals, val)
 
 		switch v := val.(type) {
@@ -188,7 +202,7 @@ func buildKey(record *record.Record, keyTemplateList []fieldOptions, pairset int
 			key += strconv.FormatUint(v, 10)
 		case float64:
 			key += strconv.FormatFloat(v, 'f', -1, 64)
-		case net.IP:
+		case netip.Addr:
 			key += v.String()
 		case time.Time:
 			key += v.String()
@@ -331,6 +345,8 @@ func setFieldInRecord(rec *record.Record, field int, val any) error {
 		err = record.SetField(rec, field, v)
 	case net.IP:
 		err = record.SetField(rec, field, v)
+	case netip.Addr:
+		err = record.SetField(rec, field, v)
 	case net.HardwareAddr:
 		err = record.SetField(rec, field, v)
 	default:
@@ -380,6 +396,52 @@ func (m *MemHeapV2) GetRecord(cursor *MemHeapCursor, rec *record.Record) error {
 	return nil
 }
 
+// Records returns an iterator over the aggregated and sorted records in the heap.
+//
+// The yielded record is allocated once and reused for every step, so it is
+// only valid until the next iteration. It is freed when the loop ends.
+// An empty heap yields nothing. Any other error, e.g. ErrMemHeapEmpty after
+// the heap was cleared during the iteration, is yielded once together with a
+// nil record.
+func (m *MemHeapV2) Records() iter.Seq2[*record.Record, error] {
+	return func(yield func(*record.Record, error) bool) {
+		cursor, err := m.FirstRecordPosition()
+		if err == errors.ErrMemHeapEmpty {
+			return
+		} else if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		rec, err := record.NewRecord()
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer rec.Free()
+
+		for {
+			err = m.GetRecord(&cursor, &rec)
+			if err == errors.ErrMemHeapEnd {
+				return
+			} else if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(&rec, nil) {
+				return
+			}
+			cursor, err = m.NextRecordPosition(cursor)
+			if err == errors.ErrMemHeapEnd {
+				return
+			} else if err != nil {
+				yield(nil, err)
+				return
+			}
+		}
+	}
+}
+
 // Clear resets the MemHeapV2 instance by clearing all data, templates, and configurations.
 func (m *MemHeapV2) Clear() {
 	m.table = newShardedMap[aggrRecord](m.shards)
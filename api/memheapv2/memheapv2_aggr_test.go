@@ -2,6 +2,7 @@ package memheapv2_test
 
 import (
 	"net"
+	"net/netip"
 	"sync"
 	"testing"
 	"time"
@@ -58,6 +59,99 @@ func TestAggrMinMaxField(t *testing.T) {
 	assert.Equal(t, uint64(120), val)
 }
 
+func TestAggrMaskedAddr(t *testing.T) {
+	heap := memheap.NewMemHeapV2(1)
+	err := heap.SortAggrOptions(fields.SrcAddr, memheap.AggrKey, memheap.SortAsc, 24, 64)
+	assert.Nil(t, err)
+	err = heap.SortAggrOptions(fields.Doctets, memheap.AggrSum, memheap.SortNone, 0, 0)
+	assert.Nil(t, err)
+
+	rec, _ := record.NewRecord()
+	defer rec.Free()
+
+	addrs := []string{"10.0.0.1", "10.0.0.200", "10.0.1.1", "2001:db8::1", "2001:db8::2"}
+	for _, addr := range addrs {
+		record.SetField(&rec, fields.SrcAddr, netip.MustParseAddr(addr))
+		record.SetField(&rec, fields.Doctets, uint64(10))
+		err := heap.WriteRecord(&rec)
+		assert.Nil(t, err)
+	}
+
+	expected := map[netip.Addr]uint64{
+		netip.MustParseAddr("10.0.0.0"):   20,
+		netip.MustParseAddr("10.0.1.0"):   10,
+		netip.MustParseAddr("2001:db8::"): 20,
+	}
+	count := 0
+	for r, err := range heap.Records() {
+		assert.Nil(t, err)
+		addr, err := r.SrcAddr()
+		assert.Nil(t, err)
+		bytes, _ := r.Bytes()
+		assert.Equal(t, expected[addr], bytes)
+		count++
+	}
+	assert.Equal(t, 3, count)
+}
+
+func TestRecordsIterator(t *testing.T) {
+	var heap memheap.MemHeapV2 = *memheap.NewMemHeapV2(1)
+	err := heap.SortAggrOptions(fields.SrcPort, memheap.AggrKey, memheap.SortAsc, 0, 0)
+	assert.Nil(t, err)
+	err = heap.SortAggrOptions(fields.Doctets, memheap.AggrSum, memheap.SortNone, 0, 0)
+	assert.Nil(t, err)
+
+	rec, _ := record.NewRecord()
+	defer rec.Free()
+
+	for i := 0; i < 6; i++ {
+		record.SetField(&rec, fields.SrcPort, uint16(i%3))
+		record.SetField(&rec, fields.Doctets, uint64(10))
+		err := heap.WriteRecord(&rec)
+		assert.Nil(t, err)
+	}
+
+	i := 0
+	for r, err := range heap.Records() {
+		assert.Nil(t, err)
+		val, _ := r.GetField(fields.SrcPort)
+		assert.Equal(t, uint16(i), val)
+		val, _ = r.GetField(fields.Doctets)
+		assert.Equal(t, uint64(20), val)
+		i++
+	}
+	assert.Equal(t, 3, i)
+}
+
+func TestRecordsIteratorOnEmptyHeap(t *testing.T) {
+	heap := memheap.NewMemHeapV2(1)
+	for range heap.Records() {
+		t.Fatal("empty heap must not yield records")
+	}
+}
+
+func TestRecordsIteratorClearedHeap(t *testing.T) {
+	heap := memheap.NewMemHeapV2(1)
+	err := heap.SortAggrOptions(fields.SrcPort, memheap.AggrKey, memheap.SortAsc, 0, 0)
+	assert.Nil(t, err)
+
+	rec, _ := record.NewRecord()
+	defer rec.Free()
+	for i := range 3 {
+		record.SetField(&rec, fields.SrcPort, uint16(i))
+		assert.Nil(t, heap.WriteRecord(&rec))
+	}
+
+	var errs []error
+	for r, err := range heap.Records() {
+		errs = append(errs, err)
+		if r != nil {
+			heap.Clear()
+		}
+	}
+	assert.Equal(t, []error{nil, errors.ErrMemHeapEmpty}, errs)
+}
+
 func TestAggrPerPairField(t *testing.T) {
 	var heap memheap.MemHeapV2 = *memheap.NewMemHeapV2(1)
 	err := heap.SortAggrOptions(fields.PairPort, memheap.AggrKey, memheap.SortAsc, 0, 0)
@@ -3,6 +3,7 @@ package memheapv2
 import (
 	"bytes"
 	"net"
+	"net/netip"
 	"sort"
 	"time"
 
@@ -44,6 +45,15 @@ func lessThan(a, b interface{}) bool {
 			return false
 		}
 		return bytes.Compare(v1, v2) > 0
+	case netip.Addr:
+		v2, ok := b.(netip.Addr)
+		if !ok {
+			return false
+		}
+		if v1.BitLen() != v2.BitLen() {
+			return v1.BitLen() > v2.BitLen()
+		}
+		return v1.Compare(v2) > 0
 	case time.Time:
 		v2, ok := b.(time.Time)
 		return ok && v1.Before(v2)
@@ -87,6 +97,15 @@ func greaterThan(a, b interface{}) bool {
 			return false
 		}
 		return ok && bytes.Compare(v1, v2) < 0
+	case netip.Addr:
+		v2, ok := b.(netip.Addr)
+		if !ok {
+			return false
+		}
+		if v1.BitLen() != v2.BitLen() {
+			return v1.BitLen() < v2.BitLen()
+		}
+		return v1.Compare(v2) < 0
 	case time.Time:
 		v2, ok := b.(time.Time)
 		return ok && v1.After(v2)
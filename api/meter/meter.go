@@ -0,0 +1,270 @@
+// Package meter converts packet captures into flow records, like a flow meter
+// of a NetFlow exporter, so pcap and pcapng files can be analysed with the
+// same tools as nfdump files.
+//
+// Packets read by a Reader are added to a Meter, which tracks flows keyed by
+// the 5-tuple (addresses, ports and protocol) and expires them after the active
+// or the inactive timeout. Timeouts are measured in capture time, so a capture
+// produces the same flows however fast it is read. Convert writes the flows of
+// a whole capture to a record.Writer, e.g. a file.File opened with OpenWrite:
+//
+//	var out file.File
+//	out.OpenWrite("flows.nfcapd", "pcap", false, 0, false)
+//	defer out.Close()
+//	stats, err := meter.Convert(capture, &out, meter.Options{Bidirectional: true})
+package meter
+
+import (
+	"io"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/matejnesuta/libnf-go/api/fields"
+	"github.com/matejnesuta/libnf-go/api/flow"
+	"github.com/matejnesuta/libnf-go/api/internal/packet"
+	"github.com/matejnesuta/libnf-go/api/record"
+)
+
+const (
+	// DefaultActiveTimeout is the longest duration of a flow before it is
+	// expired and following packets start a new flow.
+	DefaultActiveTimeout = 5 * time.Minute
+	// DefaultInactiveTimeout is the time without packets after which a flow is expired.
+	DefaultInactiveTimeout = time.Minute
+
+	// scanInterval is the capture time between checks of all flows for expiry.
+	scanInterval = time.Second
+)
+
+// Options configure a Meter.
+type Options struct {
+	// Bidirectional merges both directions of a connection into one flow.
+	// The direction of the first packet is the forward direction, packets of the
+	// reverse direction are counted in fields.OutBytes and fields.OutPkts.
+	Bidirectional   bool
+	ActiveTimeout   time.Duration // DefaultActiveTimeout if 0.
+	InactiveTimeout time.Duration // DefaultInactiveTimeout if 0.
+}
+
+// Stats holds the counters of a Meter.
+type Stats struct {
+	Packets uint64 // Packets added.
+	Skipped uint64 // Packets without an IP header or of an unsupported link type.
+	Flows   uint64 // Flows expired.
+}
+
+type key struct {
+	src, dst         netip.Addr
+	srcPort, dstPort uint16
+	prot             uint8
+}
+
+func (k key) reverse() key {
+	return key{src: k.dst, dst: k.src, srcPort: k.dstPort, dstPort: k.srcPort, prot: k.prot}
+}
+
+// Meter aggregates packets into flows. A Meter is not safe for concurrent use.
+type Meter struct {
+	opts     Options
+	flows    map[key]*flow.Flow
+	handle   func(flows []flow.Flow) error
+	expired  []flow.Flow
+	lastScan time.Time
+	stats    Stats
+}
+
+// New returns a meter which passes the expired flows to handle, ordered by
+// fields.First. The slice is reused for the next call.
+func New(opts Options, handle func(flows []flow.Flow) error) *Meter {
+	if opts.ActiveTimeout <= 0 {
+		opts.ActiveTimeout = DefaultActiveTimeout
+	}
+	if opts.InactiveTimeout <= 0 {
+		opts.InactiveTimeout = DefaultInactiveTimeout
+	}
+	return &Meter{opts: opts, flows: make(map[key]*flow.Flow), handle: handle}
+}
+
+// Stats returns the counters of the meter.
+func (m *Meter) Stats() Stats {
+	return m.stats
+}
+
+// Add adds the packet to its flow. Flows which expired by the time of the
+// packet are passed to the handler, whose error is returned.
+func (m *Meter) Add(p *Packet) error {
+	m.stats.Packets++
+	var f flow.Flow
+	length := decode(&f, p)
+	if length == 0 {
+		m.stats.Skipped++
+		return nil
+	}
+
+	now := p.Time
+	if now.Sub(m.lastScan) >= scanInterval {
+		m.lastScan = now
+		for k, entry := range m.flows {
+			if m.isExpired(entry, now) {
+				m.expire(k, entry)
+			}
+		}
+	}
+
+	forward := key{src: f.SrcAddr, dst: f.DstAddr, srcPort: f.SrcPort, dstPort: f.DstPort, prot: f.Prot}
+	k, entry, reverse := forward, m.flows[forward], false
+	if entry == nil && m.opts.Bidirectional {
+		k = forward.reverse()
+		entry, reverse = m.flows[k], true
+	}
+	if entry != nil && m.isExpired(entry, now) {
+		m.expire(k, entry)
+		entry = nil
+	}
+
+	if entry == nil {
+		f.First, f.Last = now, now
+		f.Bytes, f.Packets, f.Flows = uint64(length), 1, 1
+		mark(&f, fields.First, fields.Last, fields.Doctets, fields.Dpkts, fields.AggrFlows)
+		if m.opts.Bidirectional {
+			mark(&f, fields.OutBytes, fields.OutPkts)
+		}
+		m.flows[forward] = &f
+		return m.emit()
+	}
+
+	if reverse {
+		entry.OutBytes += uint64(length)
+		entry.OutPackets++
+	} else {
+		entry.Bytes += uint64(length)
+		entry.Packets++
+	}
+	entry.TcpFlags |= f.TcpFlags
+	if now.After(entry.Last) {
+		entry.Last = now
+	}
+	return m.emit()
+}
+
+// Flush expires all flows, e.g. at the end of a capture.
+func (m *Meter) Flush() error {
+	for k, entry := range m.flows {
+		m.expire(k, entry)
+	}
+	return m.emit()
+}
+
+func (m *Meter) isExpired(f *flow.Flow, now time.Time) bool {
+	return now.Sub(f.Last) >= m.opts.InactiveTimeout || now.Sub(f.First) >= m.opts.ActiveTimeout
+}
+
+func (m *Meter) expire(k key, f *flow.Flow) {
+	m.expired = append(m.expired, *f)
+	delete(m.flows, k)
+}
+
+func (m *Meter) emit() error {
+	if len(m.expired) == 0 {
+		return nil
+	}
+	slices.SortStableFunc(m.expired, func(a, b flow.Flow) int {
+		return a.First.Compare(b.First)
+	})
+	m.stats.Flows += uint64(len(m.expired))
+	err := m.handle(m.expired)
+	m.expired = m.expired[:0]
+	return err
+}
+
+// decode decodes the headers of the packet into f and returns the length of
+// the IP packet, or 0 if the packet does not carry IP.
+func decode(f *flow.Flow, p *Packet) int {
+	b := p.Data
+	switch p.LinkType {
+	case LinkTypeEthernet:
+		_, length := packet.Ethernet(f, b)
+		return length
+	case LinkTypeRaw:
+		if len(b) > 0 && b[0]>>4 == 6 {
+			return packet.IPv6(f, b)
+		}
+		return packet.IPv4(f, b)
+	case LinkTypeIPv4:
+		return packet.IPv4(f, b)
+	case LinkTypeIPv6:
+		return packet.IPv6(f, b)
+	case LinkTypeNull:
+		if len(b) < 4 {
+			return 0
+		}
+		// AF_INET is 2 everywhere, AF_INET6 differs between the BSDs.
+		switch family := max(b[0], b[3]); family {
+		case 2:
+			return packet.IPv4(f, b[4:])
+		case 24, 28, 30:
+			return packet.IPv6(f, b[4:])
+		}
+	case LinkTypeLinuxSLL:
+		if len(b) < 16 {
+			return 0
+		}
+		if b[4] == 0 && b[5] == 6 {
+			f.InSrcMac = flow.MAC(b[6:12])
+			mark(f, fields.InSrcMac)
+		}
+		switch uint16(b[14])<<8 | uint16(b[15]) {
+		case packet.EtherTypeIPv4:
+			return packet.IPv4(f, b[16:])
+		case packet.EtherTypeIPv6:
+			return packet.IPv6(f, b[16:])
+		}
+	}
+	return 0
+}
+
+func mark(f *flow.Flow, list ...int) {
+	for _, field := range list {
+		f.Present.Add(field)
+	}
+}
+
+// Convert reads every packet of the pcap or pcapng capture and writes the
+// flows to w. Returns the counters of the meter.
+func Convert(r io.Reader, w record.Writer, opts Options) (Stats, error) {
+	pr, err := NewReader(r)
+	if err != nil {
+		return Stats{}, err
+	}
+	rec, err := record.NewRecord()
+	if err != nil {
+		return Stats{}, err
+	}
+	defer rec.Free()
+
+	m := New(opts, func(flows []flow.Flow) error {
+		for i := range flows {
+			if err := rec.FromFlow(&flows[i]); err != nil {
+				return err
+			}
+			if err := w.WriteRecord(&rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	for {
+		p, err := pr.ReadPacket()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return m.Stats(), err
+		}
+		if err := m.Add(&p); err != nil {
+			return m.Stats(), err
+		}
+	}
+	err = m.Flush()
+	return m.Stats(), err
+}
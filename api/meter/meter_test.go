@@ -0,0 +1,174 @@
+package meter_test
+
+import (
+	"bytes"
+	"io"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/matejnesuta/libnf-go/api/errors"
+	"github.com/matejnesuta/libnf-go/api/fields"
+	"github.com/matejnesuta/libnf-go/api/file"
+	"github.com/matejnesuta/libnf-go/api/flow"
+	"github.com/matejnesuta/libnf-go/api/meter"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Both captures hold the same 8 packets: a TCP connection in VLAN 10 whose
+// last packet comes 100 s after the others, a UDP packet, an ARP frame and an
+// ICMPv6 echo request. The classic pcap is truncated to 96 bytes per packet.
+var captures = []string{"../testfiles/flows.pcap", "../testfiles/flows.pcapng"}
+
+var start = time.Unix(1496001019, 0)
+
+func readPackets(t *testing.T, name string) []meter.Packet {
+	f, err := os.Open(name)
+	assert.Equal(t, nil, err)
+	defer f.Close()
+
+	r, err := meter.NewReader(f)
+	assert.Equal(t, nil, err)
+	var packets []meter.Packet
+	for {
+		p, err := r.ReadPacket()
+		if err == io.EOF {
+			return packets
+		}
+		assert.Equal(t, nil, err)
+		if err != nil {
+			return packets
+		}
+		p.Data = bytes.Clone(p.Data)
+		packets = append(packets, p)
+	}
+}
+
+func TestReadPacket(t *testing.T) {
+	for _, name := range captures {
+		packets := readPackets(t, name)
+		assert.Equal(t, 8, len(packets))
+		assert.Equal(t, meter.LinkTypeEthernet, packets[0].LinkType)
+		assert.Equal(t, start, packets[0].Time)
+		assert.Equal(t, start.Add(30*time.Millisecond), packets[3].Time)
+		assert.Equal(t, start.Add(100*time.Second), packets[7].Time)
+		assert.Equal(t, 14+4+552, packets[3].Length)
+	}
+	assert.Equal(t, 96, len(readPackets(t, captures[0])[3].Data))
+	assert.Equal(t, 14+4+552, len(readPackets(t, captures[1])[3].Data))
+}
+
+func TestReadInvalid(t *testing.T) {
+	_, err := meter.NewReader(bytes.NewReader([]byte("not a capture file at all")))
+	assert.ErrorIs(t, err, errors.ErrCaptureFormat)
+
+	data, err := os.ReadFile(captures[1])
+	assert.Equal(t, nil, err)
+	r, err := meter.NewReader(bytes.NewReader(data[:len(data)-10]))
+	assert.Equal(t, nil, err)
+	for err == nil {
+		_, err = r.ReadPacket()
+	}
+	assert.ErrorIs(t, err, errors.ErrCaptureFormat)
+}
+
+func meterFlows(t *testing.T, name string, opts meter.Options) ([]flow.Flow, meter.Stats) {
+	var flows []flow.Flow
+	m := meter.New(opts, func(expired []flow.Flow) error {
+		flows = append(flows, expired...)
+		return nil
+	})
+	for _, p := range readPackets(t, name) {
+		assert.Equal(t, nil, m.Add(&p))
+	}
+	assert.Equal(t, nil, m.Flush())
+	return flows, m.Stats()
+}
+
+func TestMeterUnidirectional(t *testing.T) {
+	for _, name := range captures {
+		flows, stats := meterFlows(t, name, meter.Options{})
+		assert.Equal(t, meter.Stats{Packets: 8, Skipped: 1, Flows: 5}, stats)
+		assert.Equal(t, 5, len(flows))
+
+		f := flows[0]
+		assert.Equal(t, netip.MustParseAddr("192.168.0.1"), f.SrcAddr)
+		assert.Equal(t, netip.MustParseAddr("192.168.0.2"), f.DstAddr)
+		assert.Equal(t, uint16(40000), f.SrcPort)
+		assert.Equal(t, uint16(80), f.DstPort)
+		assert.Equal(t, uint8(6), f.Prot)
+		assert.Equal(t, uint64(60+52+552), f.Bytes)
+		assert.Equal(t, uint64(3), f.Packets)
+		assert.Equal(t, uint8(0x1a), f.TcpFlags)
+		assert.Equal(t, uint16(10), f.SrcVlan)
+		assert.Equal(t, flow.MAC{2, 0, 0, 0, 0, 1}, f.InSrcMac)
+		assert.Equal(t, flow.MAC{2, 0, 0, 0, 0, 2}, f.OutDstMac)
+		assert.Equal(t, start, f.First)
+		assert.Equal(t, start.Add(30*time.Millisecond), f.Last)
+		assert.Equal(t, false, f.Has(fields.OutBytes))
+
+		assert.Equal(t, uint16(80), flows[1].SrcPort)
+		assert.Equal(t, uint8(0x12), flows[1].TcpFlags)
+		assert.Equal(t, uint64(100), flows[2].Bytes)
+		assert.Equal(t, uint8(17), flows[2].Prot)
+		assert.Equal(t, false, flows[2].Has(fields.SrcVlan))
+		assert.Equal(t, netip.MustParseAddr("2001:db8::2"), flows[3].DstAddr)
+		assert.Equal(t, uint8(128), flows[3].IcmpType)
+		assert.Equal(t, uint64(104), flows[3].Bytes)
+
+		// The last packet comes after the inactive timeout and starts a new flow.
+		assert.Equal(t, uint8(0x11), flows[4].TcpFlags)
+		assert.Equal(t, start.Add(100*time.Second), flows[4].First)
+	}
+}
+
+func TestMeterBidirectional(t *testing.T) {
+	flows, _ := meterFlows(t, captures[0], meter.Options{Bidirectional: true, InactiveTimeout: 5 * time.Minute})
+	assert.Equal(t, 3, len(flows))
+
+	f := flows[0]
+	assert.Equal(t, netip.MustParseAddr("192.168.0.1"), f.SrcAddr)
+	assert.Equal(t, uint64(60+52+552+52), f.Bytes)
+	assert.Equal(t, uint64(4), f.Packets)
+	assert.Equal(t, uint64(60), f.OutBytes)
+	assert.Equal(t, uint64(1), f.OutPackets)
+	assert.Equal(t, uint8(0x1b), f.TcpFlags)
+	assert.Equal(t, start.Add(100*time.Second), f.Last)
+	assert.Equal(t, true, f.Has(fields.OutBytes))
+
+	// The active timeout splits the connection.
+	flows, _ = meterFlows(t, captures[0], meter.Options{Bidirectional: true, ActiveTimeout: 50 * time.Second, InactiveTimeout: 5 * time.Minute})
+	assert.Equal(t, 4, len(flows))
+}
+
+func TestConvert(t *testing.T) {
+	in, err := os.Open(captures[1])
+	assert.Equal(t, nil, err)
+	defer in.Close()
+
+	var out file.File
+	err = out.OpenWrite("../tmp/meter.tmp", "meter", false, 0, false)
+	assert.Equal(t, nil, err)
+	stats, err := meter.Convert(in, &out, meter.Options{})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint64(5), stats.Flows)
+	out.Close()
+
+	var check file.File
+	err = check.OpenRead("../tmp/meter.tmp", false, false)
+	assert.Equal(t, nil, err)
+	defer check.Close()
+	var bytes uint64
+	n := 0
+	for r, err := range check.Records() {
+		assert.Equal(t, nil, err)
+		f, err := r.ToFlow()
+		assert.Equal(t, nil, err)
+		bytes += f.Bytes
+		n++
+	}
+	assert.Equal(t, 5, n)
+	assert.Equal(t, uint64(664+60+100+104+52), bytes)
+}
@@ -0,0 +1,296 @@
+package meter
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+	"time"
+
+	"github.com/matejnesuta/libnf-go/api/errors"
+)
+
+// A list of supported link types of captured packets.
+const (
+	LinkTypeNull     = 0   // BSD loopback, the address family in host byte order.
+	LinkTypeEthernet = 1   // Ethernet, with any number of VLAN tags.
+	LinkTypeRaw      = 101 // Raw IPv4 or IPv6 packets.
+	LinkTypeLinuxSLL = 113 // Linux cooked capture, e.g. from tcpdump -i any.
+	LinkTypeIPv4     = 228 // Raw IPv4 packets.
+	LinkTypeIPv6     = 229 // Raw IPv6 packets.
+)
+
+// maxPacketLen bounds the captured length of a packet, larger values mean
+// that the capture is corrupted.
+const maxPacketLen = 256 * 1024
+
+const (
+	pcapMagic        = 0xa1b2c3d4
+	pcapMagicNano    = 0xa1b23c4d
+	pcapngSection    = 0x0a0d0d0a
+	pcapngByteOrder  = 0x1a2b3c4d
+	pcapngInterface  = 1
+	pcapngPacket     = 2
+	pcapngSimple     = 3
+	pcapngEnhanced   = 6
+	pcapngOptTsresol = 9
+)
+
+// Packet is a captured packet.
+type Packet struct {
+	Time     time.Time
+	LinkType int
+	Data     []byte // Captured bytes, possibly truncated to the snapshot length.
+	Length   int    // Length of the packet on the wire.
+}
+
+type pcapngInterfaceInfo struct {
+	linkType int
+	resol    uint8 // if_tsresol option, microseconds if not present.
+}
+
+// Reader reads packets from a classic pcap or a pcapng capture. The format is
+// detected from the first bytes of the capture.
+type Reader struct {
+	r     *bufio.Reader
+	order binary.ByteOrder
+	buf   []byte
+
+	ng         bool
+	interfaces []pcapngInterfaceInfo // Interfaces of the current pcapng section.
+	linkType   int                   // Link type of a classic pcap.
+	nano       bool                  // Nanosecond timestamps of a classic pcap.
+}
+
+func formatError(format string, args ...any) error {
+	return fmt.Errorf("%w: "+format, append([]any{errors.ErrCaptureFormat}, args...)...)
+}
+
+// NewReader returns a reader of the capture and reads its header. Returns an
+// error wrapping errors.ErrCaptureFormat if r is not a pcap or pcapng capture.
+func NewReader(r io.Reader) (*Reader, error) {
+	pr := &Reader{r: bufio.NewReaderSize(r, 64*1024)}
+	magic, err := pr.r.Peek(4)
+	if err != nil {
+		return nil, formatError("capture of %d bytes", len(magic))
+	}
+
+	if binary.BigEndian.Uint32(magic) == pcapngSection {
+		pr.ng = true
+		if _, _, err := pr.readBlock(); err != nil {
+			return nil, err
+		}
+		return pr, nil
+	}
+
+	header, err := pr.read(24)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case binary.LittleEndian.Uint32(header) == pcapMagic || binary.LittleEndian.Uint32(header) == pcapMagicNano:
+		pr.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(header) == pcapMagic || binary.BigEndian.Uint32(header) == pcapMagicNano:
+		pr.order = binary.BigEndian
+	default:
+		return nil, formatError("unknown magic number %#x", binary.BigEndian.Uint32(header))
+	}
+	pr.nano = pr.order.Uint32(header) == pcapMagicNano
+	// The upper bits of the link type may hold the FCS length.
+	pr.linkType = int(pr.order.Uint32(header[20:]) & 0xffff)
+	return pr, nil
+}
+
+// read returns the next n bytes of the capture, valid until the next read.
+func (r *Reader) read(n int) ([]byte, error) {
+	if cap(r.buf) < n {
+		r.buf = make([]byte, n)
+	}
+	b := r.buf[:n]
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, formatError("truncated capture")
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+// ReadPacket returns the next packet of the capture. The data of the packet
+// is valid until the next call. Returns io.EOF at the end of the capture.
+func (r *Reader) ReadPacket() (Packet, error) {
+	if r.ng {
+		return r.readPcapngPacket()
+	}
+
+	header, err := r.read(16)
+	if err != nil {
+		return Packet{}, err
+	}
+	sec := int64(r.order.Uint32(header[0:]))
+	frac := int64(r.order.Uint32(header[4:]))
+	captured := int(r.order.Uint32(header[8:]))
+	length := int(r.order.Uint32(header[12:]))
+	if captured > maxPacketLen {
+		return Packet{}, formatError("packet of %d bytes", captured)
+	}
+	if !r.nano {
+		frac *= 1000
+	}
+	data, err := r.read(captured)
+	if err == io.EOF {
+		return Packet{}, formatError("truncated capture")
+	} else if err != nil {
+		return Packet{}, err
+	}
+	return Packet{Time: time.Unix(sec, frac), LinkType: r.linkType, Data: data, Length: length}, nil
+}
+
+// readBlock reads the next pcapng block and returns its type and body.
+// A section header block sets the byte order of the following blocks.
+func (r *Reader) readBlock() (uint32, []byte, error) {
+	header, err := r.r.Peek(12)
+	if err == io.EOF && len(header) == 0 {
+		return 0, nil, io.EOF
+	} else if len(header) < 8 {
+		return 0, nil, formatError("truncated capture")
+	}
+
+	if binary.BigEndian.Uint32(header) == pcapngSection {
+		if len(header) < 12 {
+			return 0, nil, formatError("truncated capture")
+		}
+		switch {
+		case binary.BigEndian.Uint32(header[8:]) == pcapngByteOrder:
+			r.order = binary.BigEndian
+		case binary.LittleEndian.Uint32(header[8:]) == pcapngByteOrder:
+			r.order = binary.LittleEndian
+		default:
+			return 0, nil, formatError("unknown byte-order magic %#x", binary.BigEndian.Uint32(header[8:]))
+		}
+		r.interfaces = r.interfaces[:0]
+	}
+
+	typ := r.order.Uint32(header)
+	length := int(r.order.Uint32(header[4:]))
+	if length < 12 || length%4 != 0 || length > maxPacketLen+64 {
+		return 0, nil, formatError("block of %d bytes", length)
+	}
+	block, err := r.read(length)
+	if err == io.EOF {
+		return 0, nil, formatError("truncated capture")
+	} else if err != nil {
+		return 0, nil, err
+	}
+	return typ, block[8 : length-4], nil
+}
+
+func (r *Reader) readPcapngPacket() (Packet, error) {
+	for {
+		typ, body, err := r.readBlock()
+		if err != nil {
+			return Packet{}, err
+		}
+
+		var iface, captured, length int
+		var ts uint64
+		var data []byte
+		switch typ {
+		case pcapngInterface:
+			if len(body) < 8 {
+				return Packet{}, formatError("interface description block of %d bytes", len(body))
+			}
+			info := pcapngInterfaceInfo{linkType: int(r.order.Uint16(body)), resol: 6}
+			if resol, ok := r.option(body[8:], pcapngOptTsresol); ok && len(resol) == 1 {
+				info.resol = resol[0]
+			}
+			r.interfaces = append(r.interfaces, info)
+			continue
+		case pcapngEnhanced:
+			if len(body) < 20 {
+				return Packet{}, formatError("enhanced packet block of %d bytes", len(body))
+			}
+			iface = int(r.order.Uint32(body))
+			ts = uint64(r.order.Uint32(body[4:]))<<32 | uint64(r.order.Uint32(body[8:]))
+			captured = int(r.order.Uint32(body[12:]))
+			length = int(r.order.Uint32(body[16:]))
+			data = body[20:]
+		case pcapngPacket:
+			if len(body) < 20 {
+				return Packet{}, formatError("packet block of %d bytes", len(body))
+			}
+			iface = int(r.order.Uint16(body))
+			ts = uint64(r.order.Uint32(body[4:]))<<32 | uint64(r.order.Uint32(body[8:]))
+			captured = int(r.order.Uint32(body[12:]))
+			length = int(r.order.Uint32(body[16:]))
+			data = body[20:]
+		case pcapngSimple:
+			if len(body) < 4 {
+				return Packet{}, formatError("simple packet block of %d bytes", len(body))
+			}
+			length = int(r.order.Uint32(body))
+			data = body[4:]
+			captured = min(length, len(data))
+		default:
+			// Statistics, name resolution and custom blocks.
+			continue
+		}
+
+		if iface >= len(r.interfaces) {
+			return Packet{}, formatError("packet of undefined interface %d", iface)
+		}
+		if captured > len(data) {
+			return Packet{}, formatError("packet of %d bytes in a block of %d bytes", captured, len(data))
+		}
+		info := r.interfaces[iface]
+		return Packet{Time: timestamp(ts, info.resol), LinkType: info.linkType, Data: data[:captured], Length: length}, nil
+	}
+}
+
+// option returns the value of the first pcapng option with the given code.
+func (r *Reader) option(b []byte, code uint16) ([]byte, bool) {
+	for len(b) >= 4 {
+		c, n := r.order.Uint16(b), int(r.order.Uint16(b[2:]))
+		if c == 0 || len(b) < 4+n {
+			break
+		}
+		if c == code {
+			return b[4 : 4+n], true
+		}
+		b = b[4+(n+3)&^3:]
+	}
+	return nil, false
+}
+
+// timestamp converts a pcapng timestamp in units given by the if_tsresol
+// option: a negative power of 10, or of 2 if the most significant bit is set.
+func timestamp(ts uint64, resol uint8) time.Time {
+	exp := uint(resol & 0x7f)
+	if resol&0x80 != 0 {
+		if exp == 0 {
+			return time.Unix(int64(ts), 0)
+		}
+		exp = min(exp, 63)
+		hi, lo := bits.Mul64(ts&(1<<exp-1), uint64(time.Second))
+		return time.Unix(int64(ts>>exp), int64(hi<<(64-exp)|lo>>exp))
+	}
+	if exp > 19 {
+		exp = 19
+	}
+	unit := uint64(1)
+	for range exp {
+		unit *= 10
+	}
+	sec, frac := ts/unit, ts%unit
+	if exp <= 9 {
+		for range 9 - exp {
+			frac *= 10
+		}
+	} else {
+		for range exp - 9 {
+			frac /= 10
+		}
+	}
+	return time.Unix(int64(sec), int64(frac))
+}
@@ -0,0 +1,212 @@
+// Package parallel reads multiple nfdump files concurrently and feeds the
+// records into a single sink, such as memheapv2.MemHeapV2, memheap.MemHeap
+// or a callback function.
+//
+// Each file is read by exactly one worker. Every worker is locked to its OS thread,
+// owns its own record and, when the sink is a memheap.MemHeap, merges its thread
+// data into the heap when it finishes.
+package parallel
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/matejnesuta/libnf-go/api/errors"
+	"github.com/matejnesuta/libnf-go/api/file"
+	"github.com/matejnesuta/libnf-go/api/filter"
+	"github.com/matejnesuta/libnf-go/api/record"
+)
+
+// Sink receives the records read by the workers. WriteRecord is called
+// concurrently from multiple goroutines, so it must be safe for concurrent use.
+// Both memheapv2.MemHeapV2 and memheap.MemHeap implement this interface.
+type Sink interface {
+	WriteRecord(r *record.Record) error
+}
+
+// SinkFunc adapts an ordinary function to the Sink interface.
+// The record passed to the function is reused by the worker, so it is only
+// valid until the function returns.
+type SinkFunc func(r *record.Record) error
+
+// WriteRecord calls f(r).
+func (f SinkFunc) WriteRecord(r *record.Record) error {
+	return f(r)
+}
+
+// threadMerger is implemented by sinks which keep per-thread data, like memheap.MemHeap.
+type threadMerger interface {
+	MergeThreads() error
+}
+
+// libnf record allocation and filter compilation are not safe to call from
+// multiple threads at once.
+var allocMux sync.Mutex
+
+// ParallelReader reads a list of files with a bounded number of workers.
+type ParallelReader struct {
+	files   []string
+	workers int
+	filter  string
+	sink    Sink
+	read    atomic.Uint64
+	matched atomic.Uint64
+}
+
+// NewParallelReader creates a reader for the given files.
+//
+// Parameters:
+//   - files: paths of the nfdump files to read.
+//   - workers: maximum number of files read at once. Zero or a negative value uses runtime.NumCPU().
+//   - filterExpr: optional filter expression. Only matching records are written to the sink.
+//   - sink: destination of the records.
+func NewParallelReader(files []string, workers int, filterExpr string, sink Sink) *ParallelReader {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > len(files) {
+		workers = len(files)
+	}
+	return &ParallelReader{
+		files:   files,
+		workers: workers,
+		filter:  filterExpr,
+		sink:    sink,
+	}
+}
+
+// Read returns the number of records read from the files.
+func (p *ParallelReader) Read() uint64 {
+	return p.read.Load()
+}
+
+// Matched returns the number of records which passed the filter and were written to the sink.
+func (p *ParallelReader) Matched() uint64 {
+	return p.matched.Load()
+}
+
+// Run reads all files and blocks until they are processed, an error occurs
+// or the context is cancelled. Every worker compiles a filter of its own, so
+// no filter is matched from multiple threads at once.
+//
+// The first error stops all workers and is returned. Errors related to a file
+// are wrapped with its path and can be checked with errors.Is. If the context is
+// cancelled, ctx.Err() is returned.
+func (p *ParallelReader) Run(ctx context.Context) error {
+	// An invalid expression is reported before any file is read.
+	if p.filter != "" {
+		var flt filter.Filter
+		if err := flt.Init(p.filter); err != nil {
+			return err
+		}
+		flt.Free()
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	jobs := make(chan string)
+	go func() {
+		defer close(jobs)
+		for _, path := range p.files {
+			select {
+			case jobs <- path:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < p.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p.worker(ctx, jobs); err != nil {
+				cancel(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return context.Cause(ctx)
+}
+
+func (p *ParallelReader) worker(ctx context.Context, jobs <-chan string) (err error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	allocMux.Lock()
+	rec, err := record.NewRecord()
+	allocMux.Unlock()
+	if err != nil {
+		return err
+	}
+	defer rec.Free()
+
+	var flt filter.Filter
+	if p.filter != "" {
+		allocMux.Lock()
+		err = flt.Init(p.filter)
+		allocMux.Unlock()
+		if err != nil {
+			return err
+		}
+		defer flt.Free()
+	}
+
+	if merger, ok := p.sink.(threadMerger); ok {
+		defer func() {
+			if mergeErr := merger.MergeThreads(); err == nil && mergeErr != errors.ErrMemHeapEnd {
+				err = mergeErr
+			}
+		}()
+	}
+
+	for path := range jobs {
+		if err := p.readFile(ctx, path, &rec, &flt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *ParallelReader) readFile(ctx context.Context, path string, rec *record.Record, flt *filter.Filter) error {
+	var f file.File
+	if err := f.OpenRead(path, false, false); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	defer f.Close()
+
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		err := f.GetNextRecord(rec)
+		if err == errors.ErrFileEof {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		p.read.Add(1)
+
+		if p.filter != "" {
+			match, err := flt.Match(*rec)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			if !match {
+				continue
+			}
+		}
+
+		if err = p.sink.WriteRecord(rec); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		p.matched.Add(1)
+	}
+}
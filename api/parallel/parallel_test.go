@@ -0,0 +1,154 @@
+package parallel_test
+
+import (
+	"context"
+	goerrors "errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/matejnesuta/libnf-go/api/errors"
+	"github.com/matejnesuta/libnf-go/api/fields"
+	"github.com/matejnesuta/libnf-go/api/memheap"
+	"github.com/matejnesuta/libnf-go/api/memheapv2"
+	"github.com/matejnesuta/libnf-go/api/parallel"
+	"github.com/matejnesuta/libnf-go/api/record"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testFiles = []string{
+	"../testfiles/nfcapd.201705281555",
+	"../testfiles/nfcapd.201705281555",
+	"../testfiles/nfcapd.201705281555",
+}
+
+func TestReadWithCallback(t *testing.T) {
+	var count atomic.Uint64
+	sink := parallel.SinkFunc(func(r *record.Record) error {
+		count.Add(1)
+		return nil
+	})
+
+	reader := parallel.NewParallelReader(testFiles, 2, "", sink)
+	err := reader.Run(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3*2035), count.Load())
+	assert.Equal(t, uint64(3*2035), reader.Read())
+	assert.Equal(t, uint64(3*2035), reader.Matched())
+}
+
+func TestReadWithFilter(t *testing.T) {
+	var count atomic.Uint64
+	sink := parallel.SinkFunc(func(r *record.Record) error {
+		prot, err := r.Prot()
+		assert.Nil(t, err)
+		assert.Equal(t, uint8(17), prot)
+		count.Add(1)
+		return nil
+	})
+
+	reader := parallel.NewParallelReader(testFiles, 0, "proto udp", sink)
+	err := reader.Run(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), count.Load())
+	assert.Equal(t, uint64(3*2035), reader.Read())
+	assert.Equal(t, uint64(3), reader.Matched())
+}
+
+func TestReadWithFilterOnManyWorkers(t *testing.T) {
+	var count atomic.Uint64
+	sink := parallel.SinkFunc(func(r *record.Record) error {
+		count.Add(1)
+		return nil
+	})
+
+	files := append(append([]string{}, testFiles...), testFiles...)
+	reader := parallel.NewParallelReader(files, len(files), "proto tcp", sink)
+	err := reader.Run(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(6*2034), count.Load())
+	assert.Equal(t, uint64(6*2035), reader.Read())
+}
+
+func TestReadIntoMemHeapV2(t *testing.T) {
+	heap := memheapv2.NewMemHeapV2(4)
+	heap.SortAggrOptions(fields.Prot, memheapv2.AggrKey, memheapv2.SortAsc, 0, 0)
+	heap.SortAggrOptions(fields.AggrFlows, memheapv2.AggrSum, memheapv2.SortNone, 0, 0)
+
+	reader := parallel.NewParallelReader(testFiles, 3, "", heap)
+	err := reader.Run(context.Background())
+	assert.Nil(t, err)
+
+	flows := make(map[uint8]uint64)
+	for r, err := range heap.Records() {
+		assert.Nil(t, err)
+		prot, _ := r.Prot()
+		flows[prot], _ = r.Flows()
+	}
+	assert.Equal(t, map[uint8]uint64{6: 3 * 2034, 17: 3}, flows)
+}
+
+func TestReadIntoMemHeap(t *testing.T) {
+	heap, err := memheap.NewMemHeap()
+	assert.Nil(t, err)
+	defer heap.Free()
+	heap.SetAggrOptions(fields.Prot, memheap.AggrKey, memheap.SortAsc, 0, 0)
+	heap.SetAggrOptions(fields.AggrFlows, memheap.AggrSum, memheap.SortNone, 0, 0)
+
+	reader := parallel.NewParallelReader(testFiles, 3, "", &heap)
+	err = reader.Run(context.Background())
+	assert.Nil(t, err)
+
+	rec, _ := record.NewRecord()
+	defer rec.Free()
+	flows := make(map[uint8]uint64)
+	for heap.GetNextRecord(&rec) == nil {
+		prot, _ := rec.Prot()
+		flows[prot], _ = rec.Flows()
+	}
+	assert.Equal(t, map[uint8]uint64{6: 3 * 2034, 17: 3}, flows)
+}
+
+func TestReadNonexistentFile(t *testing.T) {
+	sink := parallel.SinkFunc(func(r *record.Record) error { return nil })
+	files := append([]string{"nonexistent-file.tmp"}, testFiles...)
+
+	err := parallel.NewParallelReader(files, 2, "", sink).Run(context.Background())
+	assert.Equal(t, true, goerrors.Is(err, errors.ErrCannotOpenFile))
+}
+
+func TestSinkErrorStopsReading(t *testing.T) {
+	sinkErr := goerrors.New("sink is full")
+	var count atomic.Uint64
+	sink := parallel.SinkFunc(func(r *record.Record) error {
+		if count.Add(1) == 100 {
+			return sinkErr
+		}
+		return nil
+	})
+
+	reader := parallel.NewParallelReader(testFiles, 1, "", sink)
+	err := reader.Run(context.Background())
+	assert.Equal(t, true, goerrors.Is(err, sinkErr))
+	assert.Equal(t, uint64(100), count.Load())
+}
+
+func TestCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var count atomic.Uint64
+	sink := parallel.SinkFunc(func(r *record.Record) error {
+		count.Add(1)
+		return nil
+	})
+
+	err := parallel.NewParallelReader(testFiles, 2, "", sink).Run(ctx)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, uint64(0), count.Load())
+}
+
+func TestInvalidFilter(t *testing.T) {
+	sink := parallel.SinkFunc(func(r *record.Record) error { return nil })
+	err := parallel.NewParallelReader(testFiles, 2, "uhhhhhhhhhhhhhhhhhhhhhhhhh", sink).Run(context.Background())
+	assert.ErrorIs(t, err, errors.ErrOtherMsg)
+}
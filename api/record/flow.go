@@ -0,0 +1,244 @@
+package record
+
+import (
+	"bytes"
+	"net/netip"
+	"runtime"
+	"time"
+	"unsafe"
+
+	"github.com/matejnesuta/libnf-go/api/errors"
+	"github.com/matejnesuta/libnf-go/api/fields"
+	"github.com/matejnesuta/libnf-go/api/flow"
+	"github.com/matejnesuta/libnf-go/internal"
+)
+
+func bytesToAddr(buf *[16]byte, ipv4 bool) netip.Addr {
+	if ipv4 {
+		return netip.AddrFrom4([4]byte(buf[12:]))
+	}
+	return netip.AddrFrom16(*buf)
+}
+
+// flowField exchanges one field of flow.Flow with libnf. The C value of the
+// field is stored in a slot of size bytes of the buffer passed to libnf. get
+// copies the value from the slot into the flow, set from the flow into the slot.
+type flowField struct {
+	field int
+	size  int
+	get   func(f *flow.Flow, v unsafe.Pointer, family uint32)
+	set   func(f *flow.Flow, v unsafe.Pointer)
+}
+
+// flowValue returns a field whose C value has the layout of T.
+func flowValue[T any](field int, member func(f *flow.Flow) *T) flowField {
+	var zero T
+	return flowField{
+		field: field,
+		size:  int(unsafe.Sizeof(zero)),
+		get:   func(f *flow.Flow, v unsafe.Pointer, _ uint32) { *member(f) = *(*T)(v) },
+		set:   func(f *flow.Flow, v unsafe.Pointer) { *(*T)(v) = *member(f) },
+	}
+}
+
+// flowTime returns a timestamp field, stored by libnf in milliseconds.
+func flowTime(field int, member func(f *flow.Flow) *time.Time) flowField {
+	return flowField{
+		field: field,
+		size:  8,
+		get:   func(f *flow.Flow, v unsafe.Pointer, _ uint32) { *member(f) = time.UnixMilli(*(*int64)(v)) },
+		set:   func(f *flow.Flow, v unsafe.Pointer) { *(*int64)(v) = member(f).UnixMilli() },
+	}
+}
+
+// flowAddr returns an address field. The IP version is decided as by isIPv4.
+func flowAddr(field int, member func(f *flow.Flow) *netip.Addr) flowField {
+	return flowField{
+		field: field,
+		size:  16,
+		get: func(f *flow.Flow, v unsafe.Pointer, family uint32) {
+			buf := (*[16]byte)(v)
+			*member(f) = bytesToAddr(buf, familyIsIPv4(field, family, buf))
+		},
+		set: func(f *flow.Flow, v unsafe.Pointer) { *(*[16]byte)(v) = addrToBytes(member(f).Unmap()) },
+	}
+}
+
+// flowString returns a NUL-terminated string field.
+func flowString(field int, member func(f *flow.Flow) *string) flowField {
+	return flowField{
+		field: field,
+		size:  maxString,
+		get: func(f *flow.Flow, v unsafe.Pointer, _ uint32) {
+			buf := (*[maxString]byte)(v)
+			n := bytes.IndexByte(buf[:], 0)
+			if n < 0 {
+				n = len(buf)
+			}
+			*member(f) = string(buf[:n])
+		},
+		set: func(f *flow.Flow, v unsafe.Pointer) {
+			buf := (*[maxString]byte)(v)
+			n := copy(buf[:len(buf)-1], *member(f))
+			buf[n] = 0
+		},
+	}
+}
+
+// maxString is the size of the buffer of string values, LNF_MAX_STRING.
+const maxString = 512
+
+// flowFields lists the fields of flow.Flow, in the order of flow.Fields.
+var flowFields = [...]flowField{
+	flowTime(fields.First, func(f *flow.Flow) *time.Time { return &f.First }),
+	flowTime(fields.Last, func(f *flow.Flow) *time.Time { return &f.Last }),
+	flowValue(fields.Received, func(f *flow.Flow) *uint64 { return &f.Received }),
+	flowValue(fields.Doctets, func(f *flow.Flow) *uint64 { return &f.Bytes }),
+	flowValue(fields.Dpkts, func(f *flow.Flow) *uint64 { return &f.Packets }),
+	flowValue(fields.OutBytes, func(f *flow.Flow) *uint64 { return &f.OutBytes }),
+	flowValue(fields.OutPkts, func(f *flow.Flow) *uint64 { return &f.OutPackets }),
+	flowValue(fields.AggrFlows, func(f *flow.Flow) *uint64 { return &f.Flows }),
+	flowValue(fields.SrcPort, func(f *flow.Flow) *uint16 { return &f.SrcPort }),
+	flowValue(fields.DstPort, func(f *flow.Flow) *uint16 { return &f.DstPort }),
+	flowValue(fields.TcpFlags, func(f *flow.Flow) *uint8 { return &f.TcpFlags }),
+	flowAddr(fields.SrcAddr, func(f *flow.Flow) *netip.Addr { return &f.SrcAddr }),
+	flowAddr(fields.DstAddr, func(f *flow.Flow) *netip.Addr { return &f.DstAddr }),
+	flowAddr(fields.IpNextHop, func(f *flow.Flow) *netip.Addr { return &f.NextHop }),
+	flowValue(fields.SrcMask, func(f *flow.Flow) *uint8 { return &f.SrcMask }),
+	flowValue(fields.DstMask, func(f *flow.Flow) *uint8 { return &f.DstMask }),
+	flowValue(fields.Tos, func(f *flow.Flow) *uint8 { return &f.Tos }),
+	flowValue(fields.DstTos, func(f *flow.Flow) *uint8 { return &f.DstTos }),
+	flowValue(fields.SrcAS, func(f *flow.Flow) *uint32 { return &f.SrcAS }),
+	flowValue(fields.DstAS, func(f *flow.Flow) *uint32 { return &f.DstAS }),
+	flowValue(fields.BgpNextAdjacentAS, func(f *flow.Flow) *uint32 { return &f.BgpNextAdjacentAS }),
+	flowValue(fields.BgpPrevAdjacentAS, func(f *flow.Flow) *uint32 { return &f.BgpPrevAdjacentAS }),
+	flowAddr(fields.BgpNextHop, func(f *flow.Flow) *netip.Addr { return &f.BgpNextHop }),
+	flowValue(fields.Prot, func(f *flow.Flow) *uint8 { return &f.Prot }),
+	flowValue(fields.SrcVlan, func(f *flow.Flow) *uint16 { return &f.SrcVlan }),
+	flowValue(fields.DstVlan, func(f *flow.Flow) *uint16 { return &f.DstVlan }),
+	flowValue(fields.InSrcMac, func(f *flow.Flow) *flow.MAC { return &f.InSrcMac }),
+	flowValue(fields.OutSrcMac, func(f *flow.Flow) *flow.MAC { return &f.OutSrcMac }),
+	flowValue(fields.InDstMac, func(f *flow.Flow) *flow.MAC { return &f.InDstMac }),
+	flowValue(fields.OutDstMac, func(f *flow.Flow) *flow.MAC { return &f.OutDstMac }),
+	flowValue(fields.MplsLabel, func(f *flow.Flow) *fields.Mpls { return &f.MplsLabel }),
+	flowValue(fields.Input, func(f *flow.Flow) *uint32 { return &f.Input }),
+	flowValue(fields.Output, func(f *flow.Flow) *uint32 { return &f.Output }),
+	flowValue(fields.Dir, func(f *flow.Flow) *uint8 { return &f.Dir }),
+	flowValue(fields.FwdStatus, func(f *flow.Flow) *uint8 { return &f.FwdStatus }),
+	flowAddr(fields.IpRouter, func(f *flow.Flow) *netip.Addr { return &f.IpRouter }),
+	flowValue(fields.EngineType, func(f *flow.Flow) *uint8 { return &f.EngineType }),
+	flowValue(fields.EngineId, func(f *flow.Flow) *uint8 { return &f.EngineId }),
+	flowValue(fields.EventTime, func(f *flow.Flow) *uint64 { return &f.EventTime }),
+	flowValue(fields.ConnId, func(f *flow.Flow) *uint32 { return &f.ConnId }),
+	flowValue(fields.IcmpCode, func(f *flow.Flow) *uint8 { return &f.IcmpCode }),
+	flowValue(fields.IcmpType, func(f *flow.Flow) *uint8 { return &f.IcmpType }),
+	flowValue(fields.FwXEvent, func(f *flow.Flow) *uint16 { return &f.FwXEvent }),
+	flowValue(fields.FwEvent, func(f *flow.Flow) *uint8 { return &f.FwEvent }),
+	flowAddr(fields.XlateSrcIp, func(f *flow.Flow) *netip.Addr { return &f.XlateSrcIp }),
+	flowAddr(fields.XlateDstIp, func(f *flow.Flow) *netip.Addr { return &f.XlateDstIp }),
+	flowValue(fields.XlateSrcPort, func(f *flow.Flow) *uint16 { return &f.XlateSrcPort }),
+	flowValue(fields.XlateDstPort, func(f *flow.Flow) *uint16 { return &f.XlateDstPort }),
+	flowValue(fields.IngressAclId, func(f *flow.Flow) *uint32 { return &f.IngressAclId }),
+	flowValue(fields.IngressAceId, func(f *flow.Flow) *uint32 { return &f.IngressAceId }),
+	flowValue(fields.IngressXaceId, func(f *flow.Flow) *uint32 { return &f.IngressXaceId }),
+	flowValue(fields.EgressAclId, func(f *flow.Flow) *uint32 { return &f.EgressAclId }),
+	flowValue(fields.EgressAceId, func(f *flow.Flow) *uint32 { return &f.EgressAceId }),
+	flowValue(fields.EgressXaceId, func(f *flow.Flow) *uint32 { return &f.EgressXaceId }),
+	flowString(fields.Username, func(f *flow.Flow) *string { return &f.Username }),
+	flowValue(fields.IngressVrfid, func(f *flow.Flow) *uint32 { return &f.IngressVrfid }),
+	flowValue(fields.EventFlag, func(f *flow.Flow) *uint8 { return &f.EventFlag }),
+	flowValue(fields.EgressVrfid, func(f *flow.Flow) *uint32 { return &f.EgressVrfid }),
+	flowValue(fields.BlockStart, func(f *flow.Flow) *uint16 { return &f.BlockStart }),
+	flowValue(fields.BlockEnd, func(f *flow.Flow) *uint16 { return &f.BlockEnd }),
+	flowValue(fields.BlockStep, func(f *flow.Flow) *uint16 { return &f.BlockStep }),
+	flowValue(fields.BlockSize, func(f *flow.Flow) *uint16 { return &f.BlockSize }),
+	flowValue(fields.ClientNwDelayUsec, func(f *flow.Flow) *uint64 { return &f.ClientNwDelayUsec }),
+	flowValue(fields.ServerNwDelayUsec, func(f *flow.Flow) *uint64 { return &f.ServerNwDelayUsec }),
+	flowValue(fields.ApplLatencyUsec, func(f *flow.Flow) *uint64 { return &f.ApplLatencyUsec }),
+	flowAddr(fields.ExporterIp, func(f *flow.Flow) *netip.Addr { return &f.ExporterIp }),
+	flowValue(fields.ExporterId, func(f *flow.Flow) *uint32 { return &f.ExporterId }),
+	flowValue(fields.ExporterVersion, func(f *flow.Flow) *uint32 { return &f.ExporterVersion }),
+	flowValue(fields.SequenceFailures, func(f *flow.Flow) *uint32 { return &f.SequenceFailures }),
+	flowValue(fields.SamplerMode, func(f *flow.Flow) *uint16 { return &f.SamplerMode }),
+	flowValue(fields.SamplerInterval, func(f *flow.Flow) *uint32 { return &f.SamplerInterval }),
+	flowValue(fields.SamplerId, func(f *flow.Flow) *uint32 { return &f.SamplerId }),
+}
+
+// The fields exchanged by ToFlowInto and FromFlow, followed by fields.InetFamily,
+// which ToFlowInto reads to tell the IP version of the flow addresses.
+var flowIDs, flowOffsets = func() (ids, offsets [len(flowFields) + 1]int32) {
+	offset := 0
+	for i, ff := range flowFields {
+		ids[i], offsets[i] = int32(ff.field), int32(offset)
+		offset += (ff.size + 7) &^ 7
+	}
+	ids[len(flowFields)], offsets[len(flowFields)] = int32(fields.InetFamily), int32(offset)
+	return ids, offsets
+}()
+
+// flowBuffer holds the values of all fields of flowFields and the address family.
+// Every slot starts at a multiple of 8 bytes, no slot is larger than maxString.
+type flowBuffer [(len(flowFields)*16 + maxString + 8) / 8]uint64
+
+func (b *flowBuffer) at(i int) unsafe.Pointer {
+	return unsafe.Add(unsafe.Pointer(b), flowOffsets[i])
+}
+
+// ToFlow converts the record to a flow.Flow, which holds no C memory.
+// See ToFlowInto for details.
+func (r *Record) ToFlow() (flow.Flow, error) {
+	var f flow.Flow
+	err := r.ToFlowInto(&f)
+	return f, err
+}
+
+// ToFlowInto converts the record into the caller-provided flow.Flow, which is reset first.
+//
+// All fields are read with a single call to libnf. Fields that are not set in
+// the record are left zero and are not marked in f.Present.
+func (r *Record) ToFlowInto(f *flow.Flow) error {
+	if !r.Allocated() {
+		return errors.ErrRecordNotAllocated
+	}
+	*f = flow.Flow{}
+
+	var buf flowBuffer
+	var present [len(flowIDs)]byte
+	internal.Rec_fget_list(r.ptr, uintptr(unsafe.Pointer(&flowIDs)), uintptr(unsafe.Pointer(&flowOffsets)),
+		len(flowIDs), uintptr(unsafe.Pointer(&buf)), uintptr(unsafe.Pointer(&present)))
+	runtime.KeepAlive(r)
+
+	var family uint32
+	if present[len(flowFields)] != 0 {
+		family = *(*uint32)(buf.at(len(flowFields)))
+	}
+	for i := range flowFields {
+		if present[i] != 0 {
+			flowFields[i].get(f, buf.at(i), family)
+			f.Present.Add(flowFields[i].field)
+		}
+	}
+	return nil
+}
+
+// FromFlow clears the record and sets every field marked present in f.Present,
+// with a single call to libnf. Use flow.Flow.MarkNonZero to mark the fields of
+// a flow built by hand.
+func (r *Record) FromFlow(f *flow.Flow) error {
+	if !r.Allocated() {
+		return errors.ErrRecordNotAllocated
+	}
+
+	var buf flowBuffer
+	var present [len(flowIDs)]byte
+	for i := range flowFields {
+		if f.Present.Has(flowFields[i].field) {
+			flowFields[i].set(f, buf.at(i))
+			present[i] = 1
+		}
+	}
+	internal.Rec_fset_list(r.ptr, uintptr(unsafe.Pointer(&flowIDs)), uintptr(unsafe.Pointer(&flowOffsets)),
+		len(flowFields), uintptr(unsafe.Pointer(&buf)), uintptr(unsafe.Pointer(&present)))
+	runtime.KeepAlive(r)
+	return nil
+}
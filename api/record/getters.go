@@ -0,0 +1,129 @@
+package record
+
+import (
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/matejnesuta/libnf-go/api/errors"
+	"github.com/matejnesuta/libnf-go/api/fields"
+)
+
+func checkField[T any](r *Record, field int) error {
+	if !r.Allocated() {
+		return errors.ErrRecordNotAllocated
+	}
+
+	expectedType, ok := fields.FieldTypes[field]
+	if !ok {
+		return errors.ErrUnknownFld
+	}
+	if _, ok := expectedType.(T); ok {
+		return nil
+	}
+
+	// netip.Addr and netip.Prefix are alternative representations of net.IP fields.
+	var zero T
+	switch any(&zero).(type) {
+	case *netip.Addr, *netip.Prefix:
+		if _, ok := expectedType.(net.IP); ok {
+			return nil
+		}
+	}
+	return errors.ErrMismatchingDataTypes
+}
+
+// Get retrieves the value of a specific field from the record as the type T.
+//
+// The type T is checked against fields.FieldTypes before the value is read,
+// so a wrong type results in an error instead of a failed type assertion.
+//
+// Returns the zero value of T and an error if:
+//   - ErrRecordNotAllocated: record is not allocated
+//   - ErrUnknownFld: unknown field
+//   - ErrMismatchingDataTypes: T does not match the data type of the field
+//   - ErrNotSet: field is not set
+func Get[T fields.FldDataType](r *Record, field int) (T, error) {
+	var zero T
+	if err := checkField[T](r, field); err != nil {
+		return zero, err
+	}
+
+	var err error
+	switch p := any(&zero).(type) {
+	case *netip.Addr:
+		*p, err = getAddr(r, field)
+		return zero, err
+	case *netip.Prefix:
+		*p, err = getPrefix(r, field)
+		return zero, err
+	}
+
+	val, err := r.GetField(field)
+	if err != nil {
+		return zero, err
+	}
+	return val.(T), nil
+}
+
+// First returns the timestamp of the first packet of the flow (fields.First).
+func (r *Record) First() (time.Time, error) { return Get[time.Time](r, fields.First) }
+
+// Last returns the timestamp of the last packet of the flow (fields.Last).
+func (r *Record) Last() (time.Time, error) { return Get[time.Time](r, fields.Last) }
+
+// Bytes returns the number of bytes in the flow (fields.Doctets).
+func (r *Record) Bytes() (uint64, error) { return Get[uint64](r, fields.Doctets) }
+
+// Packets returns the number of packets in the flow (fields.Dpkts).
+func (r *Record) Packets() (uint64, error) { return Get[uint64](r, fields.Dpkts) }
+
+// Flows returns the number of aggregated flows (fields.AggrFlows).
+func (r *Record) Flows() (uint64, error) { return Get[uint64](r, fields.AggrFlows) }
+
+// SrcAddr returns the source IP address of the flow (fields.SrcAddr).
+func (r *Record) SrcAddr() (netip.Addr, error) { return r.GetAddr(fields.SrcAddr) }
+
+// DstAddr returns the destination IP address of the flow (fields.DstAddr).
+func (r *Record) DstAddr() (netip.Addr, error) { return r.GetAddr(fields.DstAddr) }
+
+// NextHop returns the IP address of the next hop router (fields.IpNextHop).
+func (r *Record) NextHop() (netip.Addr, error) { return r.GetAddr(fields.IpNextHop) }
+
+// SrcPort returns the source port of the flow (fields.SrcPort).
+func (r *Record) SrcPort() (uint16, error) { return Get[uint16](r, fields.SrcPort) }
+
+// DstPort returns the destination port of the flow (fields.DstPort).
+func (r *Record) DstPort() (uint16, error) { return Get[uint16](r, fields.DstPort) }
+
+// Prot returns the IP protocol number of the flow (fields.Prot).
+func (r *Record) Prot() (uint8, error) { return Get[uint8](r, fields.Prot) }
+
+// TcpFlags returns the cumulative TCP flags of the flow (fields.TcpFlags).
+func (r *Record) TcpFlags() (uint8, error) { return Get[uint8](r, fields.TcpFlags) }
+
+// SrcAS returns the source autonomous system number (fields.SrcAS).
+func (r *Record) SrcAS() (uint32, error) { return Get[uint32](r, fields.SrcAS) }
+
+// DstAS returns the destination autonomous system number (fields.DstAS).
+func (r *Record) DstAS() (uint32, error) { return Get[uint32](r, fields.DstAS) }
+
+// Input returns the SNMP index of the input interface (fields.Input).
+func (r *Record) Input() (uint32, error) { return Get[uint32](r, fields.Input) }
+
+// Output returns the SNMP index of the output interface (fields.Output).
+func (r *Record) Output() (uint32, error) { return Get[uint32](r, fields.Output) }
+
+// Bps returns the computed bits per second of the flow (fields.CalcBps).
+func (r *Record) Bps() (float64, error) { return Get[float64](r, fields.CalcBps) }
+
+// Pps returns the computed packets per second of the flow (fields.CalcPps).
+func (r *Record) Pps() (float64, error) { return Get[float64](r, fields.CalcPps) }
+
+// Bpp returns the computed bytes per packet of the flow (fields.CalcBpp).
+func (r *Record) Bpp() (float64, error) { return Get[float64](r, fields.CalcBpp) }
+
+// Brec1 returns the basic record containing the most common flow fields (fields.Brec1).
+func (r *Record) Brec1() (fields.BasicRecord1, error) {
+	return Get[fields.BasicRecord1](r, fields.Brec1)
+}
@@ -0,0 +1,239 @@
+package record
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/matejnesuta/libnf-go/api/errors"
+	"github.com/matejnesuta/libnf-go/api/fields"
+)
+
+// jsonAcl is the JSON representation of fields.Acl.
+type jsonAcl struct {
+	AclId  uint32 `json:"acl_id"`
+	AceId  uint32 `json:"ace_id"`
+	XaceId uint32 `json:"xace_id"`
+}
+
+// jsonFields lists the fields encoded by MarshalJSON, in the order of the field constants.
+// Aliases, computed and pair fields, fields.Brec1 and fields.InetFamily only repeat
+// the values of other fields and the ACL members are encoded as part of their ACL.
+var jsonFields = func() []fields.Info {
+	skip := map[int]bool{
+		fields.Brec1:         true,
+		fields.InetFamily:    true,
+		fields.IngressAclId:  true,
+		fields.IngressAceId:  true,
+		fields.IngressXaceId: true,
+		fields.EgressAclId:   true,
+		fields.EgressAceId:   true,
+		fields.EgressXaceId:  true,
+	}
+	var list []fields.Info
+	for _, info := range fields.All() {
+		if !info.IsAlias() && !info.Computed && !info.Pair && !skip[info.Field] {
+			list = append(list, info)
+		}
+	}
+	return list
+}()
+
+// MarshalJSON encodes the record as a JSON object keyed by the libnf field names
+// (e.g. "srcip", "dstport", "bytes"). Fields which are not set are omitted.
+//
+// Addresses and MAC addresses are encoded as strings, timestamps as RFC 3339
+// strings in UTC with millisecond precision, ACLs as objects with the acl_id,
+// ace_id and xace_id members and the MPLS label stack as an array of label
+// stack entries without the trailing zero entries.
+func (r *Record) MarshalJSON() ([]byte, error) {
+	return r.AppendJSON(nil)
+}
+
+// AppendJSON appends the encoding produced by MarshalJSON to b and returns
+// the extended buffer.
+func (r *Record) AppendJSON(b []byte) ([]byte, error) {
+	if !r.Allocated() {
+		return b, errors.ErrRecordNotAllocated
+	}
+
+	b = append(b, '{')
+	first := true
+	for _, info := range jsonFields {
+		value, err := r.GetField(info.Field)
+		if err == errors.ErrNotSet {
+			continue
+		} else if err != nil {
+			return b, err
+		}
+		if !first {
+			b = append(b, ',')
+		}
+		first = false
+		b = strconv.AppendQuote(b, info.Name)
+		b = append(b, ':')
+		b, err = appendJSONValue(b, value)
+		if err != nil {
+			return b, err
+		}
+	}
+	return append(b, '}'), nil
+}
+
+func appendJSONValue(b []byte, value any) ([]byte, error) {
+	switch v := value.(type) {
+	case uint8:
+		return strconv.AppendUint(b, uint64(v), 10), nil
+	case uint16:
+		return strconv.AppendUint(b, uint64(v), 10), nil
+	case uint32:
+		return strconv.AppendUint(b, uint64(v), 10), nil
+	case uint64:
+		return strconv.AppendUint(b, v, 10), nil
+	case net.IP:
+		return strconv.AppendQuote(b, v.String()), nil
+	case net.HardwareAddr:
+		return strconv.AppendQuote(b, v.String()), nil
+	case time.Time:
+		return strconv.AppendQuote(b, v.UTC().Format(jsonTimeLayout)), nil
+	case string:
+		data, err := json.Marshal(v)
+		return append(b, data...), err
+	case fields.Acl:
+		data, err := json.Marshal(jsonAcl(v))
+		return append(b, data...), err
+	case fields.Mpls:
+		n := len(v)
+		for n > 0 && v[n-1] == 0 {
+			n--
+		}
+		b = append(b, '[')
+		for i, entry := range v[:n] {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = strconv.AppendUint(b, uint64(entry), 10)
+		}
+		return append(b, ']'), nil
+	default:
+		return b, fmt.Errorf("record: cannot encode %T as JSON", value)
+	}
+}
+
+const jsonTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// UnmarshalJSON replaces the contents of the record with the fields of a JSON
+// object produced by MarshalJSON. The record must be previously allocated.
+//
+// Besides the libnf field names, their aliases (e.g. the nfdump format tokens
+// "sa" and "dp") are accepted as keys. Timestamps may also be given as numbers
+// of milliseconds since the Unix epoch and fields with a null value are left
+// unset. Keys which do not name a field that can be set result in an error
+// wrapping errors.ErrUnknownFld.
+func (r *Record) UnmarshalJSON(data []byte) error {
+	if !r.Allocated() {
+		return errors.ErrRecordNotAllocated
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return err
+	} else if object == nil {
+		return fmt.Errorf("record: cannot decode JSON %s into a record", bytes.TrimSpace(data))
+	}
+
+	if err := r.Clear(); err != nil {
+		return err
+	}
+	for name, raw := range object {
+		field, ok := fields.ByName(name)
+		info, _ := fields.Lookup(field)
+		if !ok || info.Computed || info.Pair || field == fields.Brec1 {
+			return fmt.Errorf("%w: %q", errors.ErrUnknownFld, name)
+		} else if string(raw) == "null" {
+			continue
+		}
+		if err := setJSONValue(r, field, raw); err != nil {
+			return fmt.Errorf("record: invalid value of %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func setJSONValue(r *Record, field int, raw json.RawMessage) error {
+	switch fields.FieldTypes[field].(type) {
+	case uint8:
+		return setJSON[uint8](r, field, raw)
+	case uint16:
+		return setJSON[uint16](r, field, raw)
+	case uint32:
+		return setJSON[uint32](r, field, raw)
+	case uint64:
+		return setJSON[uint64](r, field, raw)
+	case string:
+		return setJSON[string](r, field, raw)
+	case net.IP:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return err
+		}
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return err
+		}
+		return SetField(r, field, addr)
+	case net.HardwareAddr:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return err
+		}
+		mac, err := net.ParseMAC(s)
+		if err != nil {
+			return err
+		} else if len(mac) != 6 {
+			return fmt.Errorf("%q is not a 48-bit MAC address", s)
+		}
+		return SetField(r, field, mac)
+	case time.Time:
+		var ms int64
+		if err := json.Unmarshal(raw, &ms); err == nil {
+			return SetField(r, field, time.UnixMilli(ms))
+		}
+		var t time.Time
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return err
+		}
+		return SetField(r, field, t)
+	case fields.Acl:
+		var acl jsonAcl
+		if err := json.Unmarshal(raw, &acl); err != nil {
+			return err
+		}
+		return SetField(r, field, fields.Acl(acl))
+	case fields.Mpls:
+		var entries []uint32
+		if err := json.Unmarshal(raw, &entries); err != nil {
+			return err
+		}
+		var mpls fields.Mpls
+		if len(entries) > len(mpls) {
+			return fmt.Errorf("more than %d MPLS labels", len(mpls))
+		}
+		copy(mpls[:], entries)
+		return SetField(r, field, mpls)
+	default:
+		return errors.ErrUnknownFld
+	}
+}
+
+func setJSON[T uint8 | uint16 | uint32 | uint64 | string](r *Record, field int, raw json.RawMessage) error {
+	var v T
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return err
+	}
+	return SetField(r, field, v)
+}
@@ -0,0 +1,143 @@
+package record
+
+import (
+	"net"
+	"net/netip"
+	"time"
+	"unsafe"
+
+	"github.com/matejnesuta/libnf-go/api/fields"
+)
+
+// rawBrec1 mirrors the memory layout of the C lnf_brec1_t structure, so it can
+// be filled by libnf directly without allocating a SWIG wrapper.
+type rawBrec1 struct {
+	first   uint64
+	last    uint64
+	srcaddr [16]byte
+	dstaddr [16]byte
+	prot    uint8
+	srcport uint16
+	dstport uint16
+	bytes   uint64
+	pkts    uint64
+	flows   uint64
+}
+
+func getSimpleInto[T uint8 | uint16 | uint32 | uint64 | float64](r *Record, field int) (T, error) {
+	if err := checkField[T](r, field); err != nil {
+		return 0, err
+	}
+	return getSimpleDataType[T](r, field)
+}
+
+// GetUint8 reads an 8-bit field without allocating any memory.
+// Returns ErrMismatchingDataTypes if the field is not an uint8 field.
+func (r *Record) GetUint8(field int) (uint8, error) { return getSimpleInto[uint8](r, field) }
+
+// GetUint16 reads a 16-bit field without allocating any memory.
+// Returns ErrMismatchingDataTypes if the field is not an uint16 field.
+func (r *Record) GetUint16(field int) (uint16, error) { return getSimpleInto[uint16](r, field) }
+
+// GetUint32 reads a 32-bit field without allocating any memory.
+// Returns ErrMismatchingDataTypes if the field is not an uint32 field.
+func (r *Record) GetUint32(field int) (uint32, error) { return getSimpleInto[uint32](r, field) }
+
+// GetUint64 reads a 64-bit field without allocating any memory.
+// Returns ErrMismatchingDataTypes if the field is not an uint64 field.
+func (r *Record) GetUint64(field int) (uint64, error) { return getSimpleInto[uint64](r, field) }
+
+// GetFloat64 reads a computed floating point field (e.g. fields.CalcBps) without allocating any memory.
+// Returns ErrMismatchingDataTypes if the field is not a float64 field.
+func (r *Record) GetFloat64(field int) (float64, error) { return getSimpleInto[float64](r, field) }
+
+// GetTime reads a timestamp field without allocating any memory.
+// Returns ErrMismatchingDataTypes if the field is not a time field.
+func (r *Record) GetTime(field int) (time.Time, error) {
+	if err := checkField[time.Time](r, field); err != nil {
+		return time.Time{}, err
+	}
+	var val int64
+	err := callFget(r, field, uintptr(unsafe.Pointer(&val)))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(val), nil
+}
+
+// GetIPInto reads an IP address field into the caller-provided buffer without
+// allocating any memory. The address is stored in the same 16-byte form libnf
+// uses, where an IPv4 address occupies the last 4 bytes.
+// Returns ErrMismatchingDataTypes if the field is not an IP address field.
+func (r *Record) GetIPInto(field int, buf *[16]byte) error {
+	if err := checkField[net.IP](r, field); err != nil {
+		return err
+	}
+	return callFget(r, field, uintptr(unsafe.Pointer(buf)))
+}
+
+// GetMacInto reads a MAC address field into the caller-provided buffer without
+// allocating any memory.
+// Returns ErrMismatchingDataTypes if the field is not a MAC address field.
+func (r *Record) GetMacInto(field int, buf *[6]byte) error {
+	if err := checkField[net.HardwareAddr](r, field); err != nil {
+		return err
+	}
+	return callFget(r, field, uintptr(unsafe.Pointer(buf)))
+}
+
+// GetBrec1Into reads the fields.Brec1 field into the caller-provided structure.
+//
+// The SrcAddr and DstAddr slices of brec are reused when they have enough
+// capacity, so reading into the same structure repeatedly does not allocate.
+func (r *Record) GetBrec1Into(brec *fields.BasicRecord1) error {
+	if err := checkField[fields.BasicRecord1](r, fields.Brec1); err != nil {
+		return err
+	}
+	var raw rawBrec1
+	err := callFget(r, fields.Brec1, uintptr(unsafe.Pointer(&raw)))
+	if err != nil {
+		return err
+	}
+
+	brec.First = time.UnixMilli(int64(raw.first))
+	brec.Last = time.UnixMilli(int64(raw.last))
+	brec.Prot = raw.prot
+	brec.SrcPort = raw.srcport
+	brec.DstPort = raw.dstport
+	brec.Bytes = raw.bytes
+	brec.Pkts = raw.pkts
+	brec.Flows = raw.flows
+	ipv4 := isIPv4(r, fields.Brec1, &raw.srcaddr)
+	brec.SrcAddr = appendIP(brec.SrcAddr[:0], &raw.srcaddr, ipv4)
+	brec.DstAddr = appendIP(brec.DstAddr[:0], &raw.dstaddr, ipv4)
+	return nil
+}
+
+func appendIP(dst []byte, data *[16]byte, ipv4 bool) []byte {
+	if ipv4 {
+		return append(dst, data[12:]...)
+	}
+	return append(dst, data[:]...)
+}
+
+// GetAddr reads an IP address field as a netip.Addr without allocating any memory.
+// The IP version of flow addresses is taken from fields.InetFamily.
+// Returns ErrMismatchingDataTypes if the field is not an IP address field.
+func (r *Record) GetAddr(field int) (netip.Addr, error) {
+	if err := checkField[netip.Addr](r, field); err != nil {
+		return netip.Addr{}, err
+	}
+	return getAddr(r, field)
+}
+
+// GetPrefix reads an IP address field together with its network mask
+// (fields.SrcMask or fields.DstMask for source and destination addresses).
+// If the mask is not set or zero, or the field has no mask, a single-host prefix is returned.
+// Returns ErrMismatchingDataTypes if the field is not an IP address field.
+func (r *Record) GetPrefix(field int) (netip.Prefix, error) {
+	if err := checkField[netip.Prefix](r, field); err != nil {
+		return netip.Prefix{}, err
+	}
+	return getPrefix(r, field)
+}
@@ -0,0 +1,54 @@
+package record
+
+import (
+	"runtime"
+
+	"github.com/matejnesuta/libnf-go/api/errors"
+	"github.com/matejnesuta/libnf-go/internal"
+)
+
+// MarshalBinary encodes all fields of the record, including extension fields,
+// in the libnf raw TLV format. The result can be restored with UnmarshalBinary,
+// also by another process or on another host.
+func (r *Record) MarshalBinary() ([]byte, error) {
+	return r.AppendBinary(nil)
+}
+
+// AppendBinary appends the encoding produced by MarshalBinary to b and returns
+// the extended buffer. Reusing the buffer avoids an allocation per record.
+func (r *Record) AppendBinary(b []byte) ([]byte, error) {
+	if !r.Allocated() {
+		return b, errors.ErrRecordNotAllocated
+	}
+
+	n := len(b)
+	b = append(b, make([]byte, internal.REC_RAW_TLV_BUFSIZE)...)
+	status, size := internal.Rec_get_raw(r.ptr, internal.REC_RAW_TLV, b[n:])
+	runtime.KeepAlive(r)
+	if status == internal.ERR_NOMEM {
+		return b[:n], errors.ErrNoMem
+	} else if status != internal.OK {
+		return b[:n], errors.Wrap("record get raw", "", status, errors.ErrOther)
+	}
+	return b[:n+size], nil
+}
+
+// UnmarshalBinary replaces the contents of the record with data produced by MarshalBinary.
+// The record must be previously allocated.
+func (r *Record) UnmarshalBinary(data []byte) error {
+	if !r.Allocated() {
+		return errors.ErrRecordNotAllocated
+	} else if len(data) == 0 {
+		return errors.ErrCorrupt
+	}
+
+	internal.Rec_clear(r.ptr)
+	status := internal.Rec_set_raw(r.ptr, data)
+	runtime.KeepAlive(r)
+	if status == internal.ERR_NOMEM {
+		return errors.ErrNoMem
+	} else if status != internal.OK {
+		return errors.Wrap("record set raw", "", status, errors.ErrCorrupt)
+	}
+	return nil
+}
@@ -3,19 +3,35 @@ package record
 import (
 	"encoding/binary"
 	"net"
+	"net/netip"
+	"runtime"
 	"strings"
+	"syscall"
 	"time"
 	"unsafe"
 
 	"github.com/matejnesuta/libnf-go/api/errors"
 	"github.com/matejnesuta/libnf-go/api/fields"
+	"github.com/matejnesuta/libnf-go/api/internal/handle"
 	"github.com/matejnesuta/libnf-go/internal"
 )
 
 // Record represents a flow record object.
+//
+// Copies of a Record refer to the same underlying C record. Once one of the
+// copies is freed, all of them report Allocated() == false and return
+// ErrRecordNotAllocated, instead of accessing the freed memory.
+// Use Clone to get an independent copy.
 type Record struct {
-	ptr       uintptr
-	allocated bool
+	ptr uintptr
+	h   *handle.Handle // Shared by all copies, tracks whether the record was freed.
+}
+
+// Writer is implemented by the destinations of records, e.g. file.File,
+// file.RotatingWriter, ring.Ring, memheap.MemHeap and exporter.Exporter.
+// The record is only valid during the call, WriteRecord must not retain it.
+type Writer interface {
+	WriteRecord(r *Record) error
 }
 
 // GetPtr returns the internal pointer to the underlying C record structure.
@@ -25,7 +41,7 @@ func (r *Record) GetPtr() uintptr {
 
 // Allocated returns whether the record object has been successfully allocated.
 func (r *Record) Allocated() bool {
-	return r.allocated
+	return !r.h.Released()
 }
 
 func isAllBytesZero(data []byte) bool {
@@ -60,15 +76,93 @@ func convertIpToBytes(ip net.IP) []byte {
 	return []byte(ip.To16())
 }
 
-func convertToIP(data []byte) net.IP {
-	if isAllBytesZero(data[:12]) {
+func convertToIP(data []byte, ipv4 bool) net.IP {
+	if ipv4 {
 		return net.IP(data[12:]).To4() // IPv4 Address
 	}
 	return net.IP(data) // IPv6 Address
 }
 
+// familyFields lists the address fields whose IP version is reported by fields.InetFamily.
+var familyFields = map[int]struct{}{
+	fields.SrcAddr:       {},
+	fields.DstAddr:       {},
+	fields.SrcAddrAlias:  {},
+	fields.DstAddrAlias:  {},
+	fields.PairAddr:      {},
+	fields.PairAddrAlias: {},
+	fields.Brec1:         {},
+}
+
+// maskFields maps address fields to the fields holding their network mask.
+var maskFields = map[int]int{
+	fields.SrcAddr:      fields.SrcMask,
+	fields.DstAddr:      fields.DstMask,
+	fields.SrcAddrAlias: fields.SrcMask,
+	fields.DstAddrAlias: fields.DstMask,
+}
+
+// isIPv4 decides whether the address read from the field is an IPv4 address.
+// Flow addresses use fields.InetFamily, which libnf derives from the record flags.
+// The remaining address fields carry no family information in the libnf API,
+// so for them the layout libnf uses for IPv4 values (12 leading zero bytes) is checked.
+func isIPv4(r *Record, field int, data *[16]byte) bool {
+	var family uint32
+	if _, ok := familyFields[field]; ok {
+		family, _ = getSimpleDataType[uint32](r, fields.InetFamily)
+	}
+	return familyIsIPv4(field, family, data)
+}
+
+// familyIsIPv4 is isIPv4 for the value of fields.InetFamily already read from
+// the record, 0 if it is unknown.
+func familyIsIPv4(field int, family uint32, data *[16]byte) bool {
+	if _, ok := familyFields[field]; ok && family != 0 {
+		return family == syscall.AF_INET
+	}
+	return isAllBytesZero(data[:12])
+}
+
+func getAddr(r *Record, field int) (netip.Addr, error) {
+	var buf [16]byte
+	err := callFget(r, field, uintptr(unsafe.Pointer(&buf)))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	if isIPv4(r, field, &buf) {
+		return netip.AddrFrom4([4]byte(buf[12:])), nil
+	}
+	return netip.AddrFrom16(buf), nil
+}
+
+func getPrefix(r *Record, field int) (netip.Prefix, error) {
+	addr, err := getAddr(r, field)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	bits := addr.BitLen()
+	if maskField, ok := maskFields[field]; ok {
+		mask, err := getSimpleDataType[uint8](r, maskField)
+		if err == nil && mask > 0 && int(mask) < bits {
+			bits = int(mask)
+		}
+	}
+	return addr.Prefix(bits)
+}
+
+func addrToBytes(addr netip.Addr) [16]byte {
+	if addr.Is4() {
+		var buf [16]byte
+		v4 := addr.As4()
+		copy(buf[12:], v4[:])
+		return buf
+	}
+	return addr.As16()
+}
+
 func callFget(r *Record, field int, fieldPtr uintptr) error {
 	status := internal.Rec_fget(r.ptr, field, uintptr(fieldPtr))
+	runtime.KeepAlive(r)
 	if status == internal.ERR_NOTSET {
 		return errors.ErrNotSet
 	}
@@ -91,7 +185,7 @@ func getIP(r *Record, field int) (any, error) {
 	if err != nil {
 		return nil, err
 	}
-	return convertToIP(ipBuf), nil
+	return convertToIP(ipBuf, isIPv4(r, field, (*[16]byte)(ipBuf))), nil
 }
 
 func getTime(r *Record, field int) (any, error) {
@@ -138,8 +232,9 @@ func getBasicRecord1(r *Record, field int) (any, error) {
 	srcaddr := unsafe.Slice((*byte)(unsafe.Pointer(brec.GetSrcaddr().GetData())), 16)
 	dstaddr := unsafe.Slice((*byte)(unsafe.Pointer(brec.GetDstaddr().GetData())), 16)
 
-	output.SrcAddr = convertToIP(srcaddr)
-	output.DstAddr = convertToIP(dstaddr)
+	ipv4 := isIPv4(r, field, (*[16]byte)(srcaddr))
+	output.SrcAddr = convertToIP(srcaddr, ipv4)
+	output.DstAddr = convertToIP(dstaddr, ipv4)
 	return output, nil
 }
 
@@ -189,7 +284,7 @@ func getString(r *Record, field int) (any, error) {
 //   - ErrUnknownFld: unknown field
 //   - ErrRecordNotAllocated: record is not allocated
 func (r *Record) GetField(field int) (any, error) {
-	if !r.allocated {
+	if !r.Allocated() {
 		return nil, errors.ErrRecordNotAllocated
 	}
 
@@ -269,7 +364,7 @@ func ipToUint32Array(ip net.IP) [4]uint32 {
 //   - Record is not allocated
 //   - Mismatching data type for field
 func SetField[T fields.FldDataType](r *Record, field int, value T) error {
-	if !r.allocated {
+	if !r.Allocated() {
 		return errors.ErrRecordNotAllocated
 	}
 
@@ -311,6 +406,14 @@ func SetField[T fields.FldDataType](r *Record, field int, value T) error {
 		val := v
 		internal.Rec_fset(r.ptr, field, uintptr(unsafe.Pointer(&val)))
 
+	case float64:
+		_, ok := expectedType.(float64)
+		if !ok {
+			return errors.ErrMismatchingDataTypes
+		}
+		val := v
+		internal.Rec_fset(r.ptr, field, uintptr(unsafe.Pointer(&val)))
+
 	case net.IP:
 		_, ok := expectedType.(net.IP)
 		if !ok {
@@ -319,6 +422,26 @@ func SetField[T fields.FldDataType](r *Record, field int, value T) error {
 		addr := convertIpToBytes(v)
 		internal.Rec_fset(r.ptr, field, uintptr(unsafe.Pointer(&addr[0])))
 
+	case netip.Addr:
+		_, ok := expectedType.(net.IP)
+		if !ok {
+			return errors.ErrMismatchingDataTypes
+		}
+		addr := addrToBytes(v.Unmap())
+		internal.Rec_fset(r.ptr, field, uintptr(unsafe.Pointer(&addr)))
+
+	case netip.Prefix:
+		_, ok := expectedType.(net.IP)
+		if !ok {
+			return errors.ErrMismatchingDataTypes
+		}
+		addr := addrToBytes(v.Masked().Addr())
+		internal.Rec_fset(r.ptr, field, uintptr(unsafe.Pointer(&addr)))
+		if maskField, ok := maskFields[field]; ok {
+			mask := uint8(v.Bits())
+			internal.Rec_fset(r.ptr, maskField, uintptr(unsafe.Pointer(&mask)))
+		}
+
 	case time.Time:
 		_, ok := expectedType.(time.Time)
 		if !ok {
@@ -398,6 +521,7 @@ func SetField[T fields.FldDataType](r *Record, field int, value T) error {
 		return errors.ErrUnknownFld
 	}
 
+	runtime.KeepAlive(r)
 	return nil
 }
 
@@ -412,9 +536,9 @@ func NewRecord() (Record, error) {
 	if status == internal.ERR_NOMEM {
 		return r, errors.ErrNoMem
 	} else if status == internal.ERR_OTHER {
-		return r, errors.ErrOther
+		return r, errors.Wrap("record init", "", status, errors.ErrOther)
 	}
-	r.allocated = true
+	r.h = handle.New("Record", r.ptr, internal.Rec_free)
 	return r, nil
 }
 
@@ -422,9 +546,9 @@ func NewRecord() (Record, error) {
 //
 // Returns an error if the record has not been allocated.
 func (r *Record) Free() error {
-	if r.allocated {
+	if r.Allocated() {
+		r.h.Release()
 		internal.Rec_free(r.ptr)
-		r.allocated = false
 		return nil
 	}
 	return errors.ErrRecordNotAllocated
@@ -432,24 +556,46 @@ func (r *Record) Free() error {
 
 // Clear resets all fields of the initialized record object to zero.
 func (r *Record) Clear() error {
-	if r.allocated {
+	if r.Allocated() {
 		internal.Rec_clear(r.ptr)
+		runtime.KeepAlive(r)
 		return nil
 	}
 	return errors.ErrRecordNotAllocated
 }
 
+// Clone returns a deep copy of the record in a newly allocated record.
+// The copy is independent of r and must be freed separately.
+//
+// Returns an error if the record is not allocated or the allocation fails.
+func (r *Record) Clone() (Record, error) {
+	if !r.Allocated() {
+		return Record{}, errors.ErrRecordNotAllocated
+	}
+	c, err := NewRecord()
+	if err != nil {
+		return Record{}, err
+	}
+	if err = c.CopyFrom(*r); err != nil {
+		c.Free()
+		return Record{}, err
+	}
+	return c, nil
+}
+
 // CopyFrom copies the contents of another record into the current record.
 //
 // Returns an error if either record is not allocated or if the copy fails.
 func (r *Record) CopyFrom(other Record) error {
-	if !r.allocated || !other.allocated {
+	if !r.Allocated() || !other.Allocated() {
 		return errors.ErrRecordNotAllocated
 	}
 
 	status := internal.Rec_copy(r.ptr, other.ptr)
+	runtime.KeepAlive(r)
+	runtime.KeepAlive(other.h)
 	if status == internal.ERR_OTHER {
-		return errors.ErrOther
+		return errors.Wrap("record copy", "", status, errors.ErrOther)
 	}
 	return nil
 }
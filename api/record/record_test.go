@@ -1,13 +1,17 @@
 package record_test
 
 import (
+	"encoding/json"
 	"net"
+	"net/netip"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/matejnesuta/libnf-go/api/errors"
 	"github.com/matejnesuta/libnf-go/api/fields"
 	"github.com/matejnesuta/libnf-go/api/file"
+	"github.com/matejnesuta/libnf-go/api/flow"
 	"github.com/matejnesuta/libnf-go/api/record"
 
 	"github.com/stretchr/testify/assert"
@@ -404,6 +408,47 @@ func TestCopyToUnallocatedRecord(t *testing.T) {
 	assert.Equal(t, errors.ErrRecordNotAllocated, err)
 }
 
+func TestCloneRecord(t *testing.T) {
+	rec, err := record.NewRecord()
+	assert.Equal(t, nil, err)
+	defer rec.Free()
+	assert.Equal(t, nil, record.SetField(&rec, fields.Dpkts, uint64(20)))
+
+	clone, err := rec.Clone()
+	assert.Equal(t, nil, err)
+	defer clone.Free()
+	assert.Equal(t, nil, record.SetField(&rec, fields.Dpkts, uint64(30)))
+
+	val, err := clone.Packets()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint64(20), val)
+	val, err = rec.Packets()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint64(30), val)
+}
+
+func TestCloneUnallocatedRecord(t *testing.T) {
+	var rec record.Record
+	clone, err := rec.Clone()
+	assert.Equal(t, errors.ErrRecordNotAllocated, err)
+	assert.Equal(t, false, clone.Allocated())
+}
+
+func TestFreeCopiedRecord(t *testing.T) {
+	rec, err := record.NewRecord()
+	assert.Equal(t, nil, err)
+	alias := rec
+
+	assert.Equal(t, nil, rec.Free())
+	assert.Equal(t, false, alias.Allocated())
+	assert.Equal(t, errors.ErrRecordNotAllocated, alias.Free())
+
+	_, err = alias.GetField(fields.Dpkts)
+	assert.Equal(t, errors.ErrRecordNotAllocated, err)
+	err = record.SetField(&alias, fields.Dpkts, uint64(1))
+	assert.Equal(t, errors.ErrRecordNotAllocated, err)
+}
+
 func TestClearRecord(t *testing.T) {
 	var ptr file.File
 	err := ptr.OpenRead("../testfiles/ipv4-file.tmp", false, false)
@@ -739,3 +784,603 @@ func TestSetFieldUnallocatedRecord(t *testing.T) {
 	err = record.SetField(&rec, fields.SrcAddr, net.IPv4(192, 168, 0, 1).To4())
 	assert.Equal(t, errors.ErrRecordNotAllocated, err)
 }
+
+func TestGetTypedField(t *testing.T) {
+	var ptr file.File
+	err := ptr.OpenRead("../testfiles/ipv4-file.tmp", false, false)
+	assert.Equal(t, nil, err)
+	defer ptr.Close()
+
+	rec, err := record.NewRecord()
+	defer rec.Free()
+	assert.Equal(t, nil, err)
+	ptr.GetNextRecord(&rec)
+
+	port, err := record.Get[uint16](&rec, fields.SrcPort)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint16(1123), port)
+
+	brec, err := record.Get[fields.BasicRecord1](&rec, fields.Brec1)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint64(12345), brec.Bytes)
+
+	ip, err := record.Get[net.IP](&rec, fields.SrcAddr)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, net.IPv4(192, 168, 0, 1).To4(), ip)
+}
+
+func TestGetTypedFieldMismatchingDataTypes(t *testing.T) {
+	rec, err := record.NewRecord()
+	assert.Equal(t, nil, err)
+	defer rec.Free()
+	record.SetField(&rec, fields.SrcPort, uint16(80))
+
+	port, err := record.Get[uint32](&rec, fields.SrcPort)
+	assert.Equal(t, errors.ErrMismatchingDataTypes, err)
+	assert.Equal(t, uint32(0), port)
+
+	_, err = record.Get[uint16](&rec, 999)
+	assert.Equal(t, errors.ErrUnknownFld, err)
+
+	_, err = record.Get[uint16](&rec, fields.DstPort)
+	assert.Equal(t, errors.ErrNotSet, err)
+}
+
+func TestGetTypedFieldFromUnallocatedRecord(t *testing.T) {
+	var rec record.Record
+	_, err := record.Get[uint16](&rec, fields.SrcPort)
+	assert.Equal(t, errors.ErrRecordNotAllocated, err)
+	_, err = rec.Bytes()
+	assert.Equal(t, errors.ErrRecordNotAllocated, err)
+}
+
+func TestConvenienceGetters(t *testing.T) {
+	var ptr file.File
+	err := ptr.OpenRead("../testfiles/ipv4-file.tmp", false, false)
+	assert.Equal(t, nil, err)
+	defer ptr.Close()
+
+	rec, err := record.NewRecord()
+	defer rec.Free()
+	assert.Equal(t, nil, err)
+	ptr.GetNextRecord(&rec)
+
+	srcAddr, err := rec.SrcAddr()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, netip.MustParseAddr("192.168.0.1"), srcAddr)
+
+	dstAddr, err := rec.DstAddr()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, netip.MustParseAddr("192.168.0.2"), dstAddr)
+
+	bytes, err := rec.Bytes()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint64(12345), bytes)
+
+	pkts, err := rec.Packets()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint64(20), pkts)
+
+	first, err := rec.First()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, time.UnixMilli(11220), first)
+
+	last, err := rec.Last()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, time.UnixMilli(11229), last)
+
+	prot, err := rec.Prot()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint8(6), prot)
+
+	dstPort, err := rec.DstPort()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint16(80), dstPort)
+
+	_, err = rec.NextHop()
+	assert.Equal(t, errors.ErrNotSet, err)
+}
+
+func TestGetBrec1Into(t *testing.T) {
+	var ptr file.File
+	err := ptr.OpenRead("../testfiles/ipv6-file.tmp", false, false)
+	assert.Equal(t, nil, err)
+	defer ptr.Close()
+
+	rec, err := record.NewRecord()
+	defer rec.Free()
+	assert.Equal(t, nil, err)
+	ptr.GetNextRecord(&rec)
+
+	val, err := rec.GetField(fields.Brec1)
+	assert.Equal(t, nil, err)
+
+	var brec fields.BasicRecord1
+	err = rec.GetBrec1Into(&brec)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, val, brec)
+}
+
+func TestGetIPInto(t *testing.T) {
+	var ptr file.File
+	err := ptr.OpenRead("../testfiles/ipv4-file.tmp", false, false)
+	assert.Equal(t, nil, err)
+	defer ptr.Close()
+
+	rec, err := record.NewRecord()
+	defer rec.Free()
+	assert.Equal(t, nil, err)
+	ptr.GetNextRecord(&rec)
+
+	var buf [16]byte
+	err = rec.GetIPInto(fields.SrcAddr, &buf)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []byte{192, 168, 0, 1}, buf[12:])
+
+	err = rec.GetIPInto(fields.SrcPort, &buf)
+	assert.Equal(t, errors.ErrMismatchingDataTypes, err)
+
+	err = rec.GetIPInto(fields.IpNextHop, &buf)
+	assert.Equal(t, errors.ErrNotSet, err)
+}
+
+func TestGetUint64WithoutAllocation(t *testing.T) {
+	var ptr file.File
+	err := ptr.OpenRead("../testfiles/ipv4-file.tmp", false, false)
+	assert.Equal(t, nil, err)
+	defer ptr.Close()
+
+	rec, err := record.NewRecord()
+	defer rec.Free()
+	assert.Equal(t, nil, err)
+	ptr.GetNextRecord(&rec)
+
+	bytes, err := rec.GetUint64(fields.Doctets)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint64(12345), bytes)
+
+	_, err = rec.GetUint64(fields.SrcPort)
+	assert.Equal(t, errors.ErrMismatchingDataTypes, err)
+
+	var brec fields.BasicRecord1
+	var buf [16]byte
+	rec.GetBrec1Into(&brec)
+	allocs := testing.AllocsPerRun(100, func() {
+		rec.GetUint64(fields.Doctets)
+		rec.GetIPInto(fields.SrcAddr, &buf)
+		rec.GetBrec1Into(&brec)
+	})
+	assert.Equal(t, float64(0), allocs)
+}
+
+func benchmarkScan(b *testing.B, read func(rec *record.Record)) {
+	var ptr file.File
+	rec, _ := record.NewRecord()
+	defer rec.Free()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ptr.OpenRead("../testfiles/nfcapd.201705281555", false, false)
+		for ptr.GetNextRecord(&rec) == nil {
+			read(&rec)
+		}
+		ptr.Close()
+	}
+}
+
+func BenchmarkGetFieldBrec1(b *testing.B) {
+	benchmarkScan(b, func(rec *record.Record) {
+		rec.GetField(fields.Brec1)
+	})
+}
+
+func BenchmarkGetBrec1Into(b *testing.B) {
+	var brec fields.BasicRecord1
+	benchmarkScan(b, func(rec *record.Record) {
+		rec.GetBrec1Into(&brec)
+	})
+}
+
+func BenchmarkGetFieldIP(b *testing.B) {
+	benchmarkScan(b, func(rec *record.Record) {
+		rec.GetField(fields.SrcAddr)
+		rec.GetField(fields.DstAddr)
+	})
+}
+
+func BenchmarkGetIPInto(b *testing.B) {
+	var buf [16]byte
+	benchmarkScan(b, func(rec *record.Record) {
+		rec.GetIPInto(fields.SrcAddr, &buf)
+		rec.GetIPInto(fields.DstAddr, &buf)
+	})
+}
+
+func BenchmarkGetFieldUint64(b *testing.B) {
+	benchmarkScan(b, func(rec *record.Record) {
+		rec.GetField(fields.Doctets)
+		rec.GetField(fields.Dpkts)
+	})
+}
+
+func BenchmarkGetUint64(b *testing.B) {
+	benchmarkScan(b, func(rec *record.Record) {
+		rec.GetUint64(fields.Doctets)
+		rec.GetUint64(fields.Dpkts)
+	})
+}
+
+func TestSetFieldNetipAddr(t *testing.T) {
+	rec, err := record.NewRecord()
+	assert.Equal(t, nil, err)
+	defer rec.Free()
+
+	err = record.SetField(&rec, fields.SrcAddr, netip.MustParseAddr("10.0.0.1"))
+	assert.Equal(t, nil, err)
+	addr, err := record.Get[netip.Addr](&rec, fields.SrcAddr)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, netip.MustParseAddr("10.0.0.1"), addr)
+	assert.Equal(t, true, addr.Is4())
+
+	val, err := rec.GetField(fields.SrcAddr)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, net.IPv4(10, 0, 0, 1).To4(), val)
+
+	err = record.SetField(&rec, fields.SrcAddr, netip.MustParseAddr("2001:db8::1"))
+	assert.Equal(t, nil, err)
+	addr, err = rec.GetAddr(fields.SrcAddr)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, netip.MustParseAddr("2001:db8::1"), addr)
+
+	family, err := rec.GetUint32(fields.InetFamily)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint32(syscall.AF_INET6), family)
+}
+
+func TestSetFieldNetipAddrMismatchingDataTypes(t *testing.T) {
+	rec, err := record.NewRecord()
+	assert.Equal(t, nil, err)
+	defer rec.Free()
+
+	err = record.SetField(&rec, fields.SrcPort, netip.MustParseAddr("10.0.0.1"))
+	assert.Equal(t, errors.ErrMismatchingDataTypes, err)
+	_, err = record.Get[netip.Addr](&rec, fields.SrcPort)
+	assert.Equal(t, errors.ErrMismatchingDataTypes, err)
+}
+
+func TestSetFieldNetipPrefix(t *testing.T) {
+	rec, err := record.NewRecord()
+	assert.Equal(t, nil, err)
+	defer rec.Free()
+
+	err = record.SetField(&rec, fields.DstAddr, netip.MustParsePrefix("192.168.10.20/24"))
+	assert.Equal(t, nil, err)
+
+	prefix, err := rec.GetPrefix(fields.DstAddr)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, netip.MustParsePrefix("192.168.10.0/24"), prefix)
+
+	mask, err := rec.GetUint8(fields.DstMask)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint8(24), mask)
+
+	err = record.SetField(&rec, fields.SrcAddr, netip.MustParseAddr("10.1.2.3"))
+	assert.Equal(t, nil, err)
+	prefix, err = record.Get[netip.Prefix](&rec, fields.SrcAddr)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, netip.MustParsePrefix("10.1.2.3/32"), prefix)
+}
+
+func TestToFlow(t *testing.T) {
+	var ptr file.File
+	err := ptr.OpenRead("../testfiles/ipv4-file.tmp", false, false)
+	assert.Equal(t, nil, err)
+	defer ptr.Close()
+	rec, err := record.NewRecord()
+	assert.Equal(t, nil, err)
+	defer rec.Free()
+	assert.Equal(t, nil, ptr.GetNextRecord(&rec))
+
+	f, err := rec.ToFlow()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, netip.MustParseAddr("192.168.0.1"), f.SrcAddr)
+	assert.Equal(t, netip.MustParseAddr("192.168.0.2"), f.DstAddr)
+	assert.Equal(t, uint16(1123), f.SrcPort)
+	assert.Equal(t, uint16(80), f.DstPort)
+	assert.Equal(t, uint8(6), f.Prot)
+	assert.Equal(t, uint64(12345), f.Bytes)
+	assert.Equal(t, uint64(20), f.Packets)
+	assert.Equal(t, time.UnixMilli(11220), f.First)
+	assert.Equal(t, time.UnixMilli(11229), f.Last)
+	assert.Equal(t, true, f.Has(fields.SrcAddr))
+	assert.Equal(t, true, f.Has(fields.Doctets))
+}
+
+func TestFromFlowRoundTrip(t *testing.T) {
+	f := flow.Flow{
+		First:     time.UnixMilli(1000),
+		Last:      time.UnixMilli(2000),
+		SrcAddr:   netip.MustParseAddr("2001:db8::1"),
+		DstAddr:   netip.MustParseAddr("2001:db8::2"),
+		NextHop:   netip.MustParseAddr("10.0.0.1"),
+		SrcPort:   443,
+		DstPort:   51000,
+		Prot:      6,
+		Bytes:     1500,
+		Packets:   3,
+		SrcAS:     64512,
+		InSrcMac:  flow.MAC{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
+		MplsLabel: fields.Mpls{1, 2, 3},
+		Username:  "alice",
+	}
+	f.MarkNonZero()
+
+	rec, err := record.NewRecord()
+	assert.Equal(t, nil, err)
+	defer rec.Free()
+	assert.Equal(t, nil, rec.FromFlow(&f))
+
+	val, err := rec.GetField(fields.SrcAS)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint32(64512), val)
+
+	back, err := rec.ToFlow()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, f.SrcAddr, back.SrcAddr)
+	assert.Equal(t, f.DstAddr, back.DstAddr)
+	assert.Equal(t, f.NextHop, back.NextHop)
+	assert.Equal(t, f.SrcPort, back.SrcPort)
+	assert.Equal(t, f.DstPort, back.DstPort)
+	assert.Equal(t, f.Bytes, back.Bytes)
+	assert.Equal(t, f.First, back.First)
+	assert.Equal(t, f.SrcAS, back.SrcAS)
+	assert.Equal(t, f.InSrcMac, back.InSrcMac)
+	assert.Equal(t, f.MplsLabel, back.MplsLabel)
+	assert.Equal(t, f.Username, back.Username)
+}
+
+func TestToFlowUnallocatedRecord(t *testing.T) {
+	var rec record.Record
+	_, err := rec.ToFlow()
+	assert.Equal(t, errors.ErrRecordNotAllocated, err)
+	assert.Equal(t, errors.ErrRecordNotAllocated, rec.FromFlow(&flow.Flow{}))
+}
+
+func TestToFlowIPv4CompatibleAddr(t *testing.T) {
+	rec, err := record.NewRecord()
+	assert.Equal(t, nil, err)
+	defer rec.Free()
+	assert.Equal(t, nil, record.SetField(&rec, fields.SrcAddr, netip.MustParseAddr("::10.0.0.1")))
+	assert.Equal(t, nil, record.SetField(&rec, fields.DstAddr, netip.MustParseAddr("2001:db8::1")))
+
+	f, err := rec.ToFlow()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, netip.MustParseAddr("::10.0.0.1"), f.SrcAddr)
+	assert.Equal(t, true, f.SrcAddr.Is6())
+	assert.Equal(t, netip.MustParseAddr("2001:db8::1"), f.DstAddr)
+}
+
+func BenchmarkToFlow(b *testing.B) {
+	var f flow.Flow
+	benchmarkScan(b, func(rec *record.Record) {
+		rec.ToFlowInto(&f)
+	})
+}
+
+func BenchmarkFromFlow(b *testing.B) {
+	var f flow.Flow
+	out, _ := record.NewRecord()
+	defer out.Free()
+	benchmarkScan(b, func(rec *record.Record) {
+		rec.ToFlowInto(&f)
+		out.FromFlow(&f)
+	})
+}
+
+// rawSkippedFields cannot be set on their own: computed fields, pair fields
+// used only by filters, the address family derived from addresses, and the terminator.
+var rawSkippedFields = map[int]bool{
+	fields.CalcDuration:  true,
+	fields.CalcBps:       true,
+	fields.CalcPps:       true,
+	fields.CalcBpp:       true,
+	fields.PairPort:      true,
+	fields.PairAddr:      true,
+	fields.PairAddrAlias: true,
+	fields.PairAs:        true,
+	fields.PairIf:        true,
+	fields.PairVlan:      true,
+	fields.InetFamily:    true,
+	fields.Term:          true,
+}
+
+func setSampleValue(t *testing.T, rec *record.Record, field int) {
+	var err error
+	switch fields.FieldTypes[field].(type) {
+	case uint8:
+		err = record.SetField(rec, field, uint8(7))
+	case uint16:
+		err = record.SetField(rec, field, uint16(1234))
+	case uint32:
+		err = record.SetField(rec, field, uint32(123456))
+	case uint64:
+		err = record.SetField(rec, field, uint64(1234567890))
+	case time.Time:
+		err = record.SetField(rec, field, time.UnixMilli(1496000000123))
+	case net.IP:
+		err = record.SetField(rec, field, net.ParseIP("2001:db8::1"))
+	case net.HardwareAddr:
+		err = record.SetField(rec, field, net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff})
+	case fields.Mpls:
+		err = record.SetField(rec, field, fields.Mpls{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
+	case fields.Acl:
+		err = record.SetField(rec, field, fields.Acl{AclId: 1, AceId: 2, XaceId: 3})
+	case string:
+		err = record.SetField(rec, field, "user")
+	case fields.BasicRecord1:
+		err = record.SetField(rec, field, fields.BasicRecord1{
+			First:   time.UnixMilli(1000),
+			Last:    time.UnixMilli(2000),
+			SrcAddr: net.ParseIP("10.0.0.1"),
+			DstAddr: net.ParseIP("10.0.0.2"),
+			Prot:    17,
+			SrcPort: 53,
+			DstPort: 5353,
+			Bytes:   100,
+			Pkts:    2,
+			Flows:   1,
+		})
+	default:
+		t.Fatalf("no sample value for field %d", field)
+	}
+	assert.Equal(t, nil, err)
+}
+
+func TestMarshalBinaryRoundTrip(t *testing.T) {
+	rec, err := record.NewRecord()
+	assert.Equal(t, nil, err)
+	defer rec.Free()
+	restored, err := record.NewRecord()
+	assert.Equal(t, nil, err)
+	defer restored.Free()
+
+	for field := range fields.FieldTypes {
+		if rawSkippedFields[field] {
+			continue
+		}
+		rec.Clear()
+		setSampleValue(t, &rec, field)
+
+		data, err := rec.MarshalBinary()
+		assert.Equal(t, nil, err)
+		assert.Equal(t, nil, restored.UnmarshalBinary(data))
+
+		expected, err := rec.GetField(field)
+		assert.Equal(t, nil, err)
+		actual, err := restored.GetField(field)
+		assert.Equal(t, nil, err, "field %d", field)
+		assert.Equal(t, expected, actual, "field %d", field)
+	}
+}
+
+func TestMarshalBinaryFromFile(t *testing.T) {
+	var ptr file.File
+	err := ptr.OpenRead("../testfiles/nfcapd.201705281555", false, false)
+	assert.Equal(t, nil, err)
+	defer ptr.Close()
+	restored, err := record.NewRecord()
+	assert.Equal(t, nil, err)
+	defer restored.Free()
+
+	var buf []byte
+	for rec, err := range ptr.Records() {
+		assert.Equal(t, nil, err)
+		buf, err = rec.AppendBinary(buf[:0])
+		assert.Equal(t, nil, err)
+		assert.Equal(t, nil, restored.UnmarshalBinary(buf))
+
+		expected, _ := rec.ToFlow()
+		actual, _ := restored.ToFlow()
+		assert.Equal(t, expected, actual)
+	}
+}
+
+func TestMarshalBinaryUnallocatedRecord(t *testing.T) {
+	var rec record.Record
+	_, err := rec.MarshalBinary()
+	assert.Equal(t, errors.ErrRecordNotAllocated, err)
+	assert.Equal(t, errors.ErrRecordNotAllocated, rec.UnmarshalBinary([]byte{1}))
+}
+
+func TestUnmarshalBinaryEmpty(t *testing.T) {
+	rec, err := record.NewRecord()
+	assert.Equal(t, nil, err)
+	defer rec.Free()
+	assert.Equal(t, errors.ErrCorrupt, rec.UnmarshalBinary(nil))
+}
+
+func TestMarshalJSON(t *testing.T) {
+	rec, err := record.NewRecord()
+	assert.Equal(t, nil, err)
+	defer rec.Free()
+
+	assert.Equal(t, nil, record.SetField(&rec, fields.First, time.UnixMilli(1496000000123)))
+	assert.Equal(t, nil, record.SetField(&rec, fields.SrcAddr, net.ParseIP("192.168.0.1")))
+	assert.Equal(t, nil, record.SetField(&rec, fields.DstPort, uint16(80)))
+	assert.Equal(t, nil, record.SetField(&rec, fields.InSrcMac, net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}))
+	assert.Equal(t, nil, record.SetField(&rec, fields.MplsLabel, fields.Mpls{1, 2}))
+	assert.Equal(t, nil, record.SetField(&rec, fields.IngressAcl, fields.Acl{AclId: 1, AceId: 2, XaceId: 3}))
+
+	data, err := json.Marshal(&rec)
+	assert.Equal(t, nil, err)
+	var object map[string]any
+	assert.Equal(t, nil, json.Unmarshal(data, &object))
+	assert.Equal(t, "2017-05-28T19:33:20.123Z", object["first"])
+	assert.Equal(t, "192.168.0.1", object["srcip"])
+	assert.Equal(t, float64(80), object["dstport"])
+	assert.Equal(t, "aa:bb:cc:dd:ee:ff", object["insrcmac"])
+	assert.Equal(t, []any{float64(1), float64(2)}, object["mpls"])
+	assert.Equal(t, map[string]any{"acl_id": float64(1), "ace_id": float64(2), "xace_id": float64(3)}, object["ingressacl"])
+	assert.NotContains(t, object, "iacl")
+	assert.NotContains(t, object, "bps")
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	rec, err := record.NewRecord()
+	assert.Equal(t, nil, err)
+	defer rec.Free()
+
+	data := `{"ts": 1496000000123, "sa": "2001:db8::1", "dstport": 443, "proto": 6, "username": "user", "outsrcmac": null}`
+	assert.Equal(t, nil, json.Unmarshal([]byte(data), &rec))
+
+	first, err := rec.First()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(1496000000123), first.UnixMilli())
+	addr, err := rec.SrcAddr()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, netip.MustParseAddr("2001:db8::1"), addr)
+	port, err := rec.DstPort()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint16(443), port)
+	name, err := record.Get[string](&rec, fields.Username)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "user", name)
+}
+
+func TestUnmarshalJSONErrors(t *testing.T) {
+	rec, err := record.NewRecord()
+	assert.Equal(t, nil, err)
+	defer rec.Free()
+
+	assert.ErrorIs(t, rec.UnmarshalJSON([]byte(`{"nosuchfield": 1}`)), errors.ErrUnknownFld)
+	assert.ErrorIs(t, rec.UnmarshalJSON([]byte(`{"bps": 1}`)), errors.ErrUnknownFld)
+	assert.NotEqual(t, nil, rec.UnmarshalJSON([]byte(`{"srcport": 70000}`)))
+	assert.NotEqual(t, nil, rec.UnmarshalJSON([]byte(`{"srcip": "not an address"}`)))
+	assert.NotEqual(t, nil, rec.UnmarshalJSON([]byte(`[1, 2]`)))
+
+	var unallocated record.Record
+	_, err = unallocated.MarshalJSON()
+	assert.Equal(t, errors.ErrRecordNotAllocated, err)
+	assert.Equal(t, errors.ErrRecordNotAllocated, unallocated.UnmarshalJSON([]byte(`{}`)))
+}
+
+func TestMarshalJSONFromFile(t *testing.T) {
+	var ptr file.File
+	err := ptr.OpenRead("../testfiles/nfcapd.201705281555", false, false)
+	assert.Equal(t, nil, err)
+	defer ptr.Close()
+	restored, err := record.NewRecord()
+	assert.Equal(t, nil, err)
+	defer restored.Free()
+
+	for rec, err := range ptr.Records() {
+		assert.Equal(t, nil, err)
+		data, err := rec.MarshalJSON()
+		assert.Equal(t, nil, err)
+		assert.Equal(t, nil, restored.UnmarshalJSON(data))
+
+		expected, _ := rec.ToFlow()
+		actual, _ := restored.ToFlow()
+		assert.Equal(t, expected, actual)
+	}
+}
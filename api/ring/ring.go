@@ -1,9 +1,14 @@
 package ring
 
 import (
+	"context"
+	"iter"
+	"runtime"
+	"time"
 	"unsafe"
 
 	"github.com/matejnesuta/libnf-go/api/errors"
+	"github.com/matejnesuta/libnf-go/api/internal/handle"
 	"github.com/matejnesuta/libnf-go/api/record"
 	"github.com/matejnesuta/libnf-go/internal"
 )
@@ -12,9 +17,16 @@ import (
 // It is implemented using shared memory. Multiple readers and writers can use the
 // same ring buffer concurrently, even across separate processes.
 type Ring struct {
-	ptr uintptr
+	ptr          uintptr
+	blocking     bool           // Reads wait for new records instead of returning errors.ErrFileEof.
+	pollInterval time.Duration  // How often an empty ring is checked for new records in blocking mode.
+	h            *handle.Handle // Shared by all copies, tracks whether the ring was freed.
 }
 
+// DefaultPollInterval is the default interval in which an empty ring is checked
+// for new records by blocking reads.
+const DefaultPollInterval = 5 * time.Millisecond
+
 const (
 	// RingTotal is used with Ring.Info() method to retrieve the total number of records
 	// properly received since initialization.
@@ -34,30 +46,31 @@ const (
 //   - forceRelease: removes the shared memory buffer on release.
 //   - nonBlockingReading: enables non-blocking reads.
 //
+// The ring is always read in non-blocking mode by libnf. Blocking reads are
+// emulated by polling the ring, so they can be interrupted with GetNextRecordContext.
+//
 // If the process exits without calling Free, the shared memory segment remains
 // allocated. It is recommended to use forceInit or forceRelease in at least one
 // process (typically the main writer).
 //
 // Returns a Ring instance or an error if the initialization fails.
 func NewRing(filename string, forceInit bool, forceRelease bool, nonBlockingReading bool) (Ring, error) {
-	ring := Ring{}
-	var flags int
+	ring := Ring{blocking: !nonBlockingReading, pollInterval: DefaultPollInterval}
+	flags := internal.RING_NO_BLOCK
 	if forceInit {
 		flags |= internal.RING_FORCE_INIT
 	}
 	if forceRelease {
 		flags |= internal.RING_FORCE_RELEASE
 	}
-	if nonBlockingReading {
-		flags |= internal.RING_NO_BLOCK
-	}
 
 	status := internal.Ring_init(&ring.ptr, filename, flags)
 	if status == internal.ERR_NOMEM {
 		return ring, errors.ErrNoMem
 	} else if status == internal.ERR_OTHER {
-		return ring, errors.ErrOther
+		return ring, errors.Wrap("ring init", filename, status, errors.ErrOther)
 	}
+	ring.h = handle.New("Ring", ring.ptr, func(ptr uintptr) { internal.Ring_free(ptr) })
 	return ring, nil
 }
 
@@ -67,32 +80,101 @@ func NewRing(filename string, forceInit bool, forceRelease bool, nonBlockingRead
 // The returned integer holds the corresponding counter value.
 // Returns an error if the request fails.
 func (r *Ring) Info(infoType int) (int, error) {
+	if r.h.Released() {
+		return 0, errors.ErrRingNotAllocated
+	}
 	var info uint64
 	status := internal.Ring_info(r.ptr, infoType, uintptr(unsafe.Pointer(&info)), int64(8))
+	runtime.KeepAlive(r)
 	if status == internal.ERR_OTHER {
-		return 0, errors.ErrOther
+		return 0, errors.Wrap("ring info", "", status, errors.ErrOther)
 	}
 	return status, nil
 }
 
+// SetPollInterval sets how often an empty ring is checked for new records
+// by blocking reads. Non-positive values reset the interval to DefaultPollInterval.
+func (r *Ring) SetPollInterval(d time.Duration) {
+	if d <= 0 {
+		d = DefaultPollInterval
+	}
+	r.pollInterval = d
+}
+
 // GetNextRecord reads the next record from the ring buffer into the provided Record.
 //
-// The caller must ensure the Record is allocated. If no records are available,
-// this returns errors.ErrFileEof. If the reader is too slow, some records may be lost.
+// The caller must ensure the Record is allocated. In non-blocking mode, this returns
+// errors.ErrFileEof if no records are available. In blocking mode, it waits until
+// a record is written. If the reader is too slow, some records may be lost.
 //
 // Use Ring.Info(RingLost) to retrieve the number of lost records.
 func (r *Ring) GetNextRecord(rec *record.Record) error {
-	if !rec.Allocated() {
+	return r.GetNextRecordContext(context.Background(), rec)
+}
+
+// GetNextRecordContext works like GetNextRecord, but returns ctx.Err() as soon
+// as the context is canceled or its deadline expires while waiting for a record.
+func (r *Ring) GetNextRecordContext(ctx context.Context, rec *record.Record) error {
+	if r.h.Released() {
+		return errors.ErrRingNotAllocated
+	} else if !rec.Allocated() {
 		return errors.ErrRecordNotAllocated
 	}
 
-	status := internal.Ring_read(r.ptr, rec.GetPtr())
-	if status == internal.EOF {
-		return errors.ErrFileEof
-	} else if status == internal.ERR_OTHER {
-		return errors.ErrOther
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		status := internal.Ring_read(r.ptr, rec.GetPtr())
+		runtime.KeepAlive(r)
+		runtime.KeepAlive(rec)
+		if status == internal.ERR_OTHER {
+			return errors.Wrap("ring read", "", status, errors.ErrOther)
+		} else if status != internal.EOF {
+			return nil
+		} else if !r.blocking {
+			return errors.ErrFileEof
+		}
+
+		timer := time.NewTimer(r.pollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Records returns an iterator over the records read from the ring buffer.
+//
+// The yielded record is allocated once and reused for every step, so it is
+// only valid until the next iteration. It is freed when the loop ends.
+// In non-blocking mode the iteration stops once no more records are
+// available. In blocking mode it runs until the caller breaks out of the loop.
+// Any other error is yielded once together with a nil record.
+func (r *Ring) Records() iter.Seq2[*record.Record, error] {
+	return func(yield func(*record.Record, error) bool) {
+		rec, err := record.NewRecord()
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer rec.Free()
+
+		for {
+			err = r.GetNextRecord(&rec)
+			if err == errors.ErrFileEof {
+				return
+			} else if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(&rec, nil) {
+				return
+			}
+		}
 	}
-	return nil
 }
 
 // WriteRecord writes the given record into the ring buffer.
@@ -100,15 +182,19 @@ func (r *Ring) GetNextRecord(rec *record.Record) error {
 // The caller must ensure the Record is allocated. Returns an error if memory
 // allocation fails or another error occurs.
 func (r *Ring) WriteRecord(rec *record.Record) error {
-	if !rec.Allocated() {
+	if r.h.Released() {
+		return errors.ErrRingNotAllocated
+	} else if !rec.Allocated() {
 		return errors.ErrRecordNotAllocated
 	}
 
 	status := internal.Ring_write(r.ptr, rec.GetPtr())
+	runtime.KeepAlive(r)
+	runtime.KeepAlive(rec)
 	if status == internal.ERR_NOMEM {
 		return errors.ErrNoMem
 	} else if status == internal.ERR_OTHER {
-		return errors.ErrOther
+		return errors.Wrap("ring write", "", status, errors.ErrOther)
 	}
 	return nil
 }
@@ -117,7 +203,12 @@ func (r *Ring) WriteRecord(rec *record.Record) error {
 //
 // If this is the last instance, and the forceRelease flag was set during initialization,
 // the shared memory segment is also removed.
+// Returns ErrRingNotAllocated if the ring, or any copy of it, was already freed.
 func (r *Ring) Free() error {
+	if r.h.Released() {
+		return errors.ErrRingNotAllocated
+	}
+	r.h.Release()
 	internal.Ring_free(r.ptr)
 	return nil
 }
@@ -1,8 +1,10 @@
 package ring_test
 
 import (
+	"context"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/matejnesuta/libnf-go/api/errors"
 	"github.com/matejnesuta/libnf-go/api/fields"
@@ -74,3 +76,91 @@ func TestHappyPath(t *testing.T) {
 		assert.Equal(t, uint64(i), val)
 	}
 }
+
+func TestRecordsIterator(t *testing.T) {
+	r, err := ring.NewRing("libnf-go", true, false, true)
+	assert.Nil(t, err)
+	defer r.Free()
+	rec, err := record.NewRecord()
+	assert.Nil(t, err)
+	defer rec.Free()
+
+	for i := 0; i < 10; i++ {
+		record.SetField(&rec, fields.Dpkts, uint64(i))
+		err = r.WriteRecord(&rec)
+		assert.Nil(t, err)
+	}
+
+	i := 0
+	for rec, err := range r.Records() {
+		assert.Nil(t, err)
+		val, _ := rec.GetField(fields.Dpkts)
+		assert.Equal(t, uint64(i), val)
+		i++
+	}
+	assert.Equal(t, 10, i)
+}
+
+func TestGetNextRecordContextDeadline(t *testing.T) {
+	r, err := ring.NewRing("libnf-go", true, false, false)
+	assert.Nil(t, err)
+	defer r.Free()
+	rec, err := record.NewRecord()
+	assert.Nil(t, err)
+	defer rec.Free()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = r.GetNextRecordContext(ctx, &rec)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestGetNextRecordContextWaitsForWriter(t *testing.T) {
+	r, err := ring.NewRing("libnf-go", true, false, false)
+	assert.Nil(t, err)
+	defer r.Free()
+	rec, err := record.NewRecord()
+	assert.Nil(t, err)
+	defer rec.Free()
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		w, _ := record.NewRecord()
+		defer w.Free()
+		record.SetField(&w, fields.Dpkts, uint64(42))
+		r.WriteRecord(&w)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = r.GetNextRecordContext(ctx, &rec)
+	assert.Nil(t, err)
+	val, _ := rec.GetField(fields.Dpkts)
+	assert.Equal(t, uint64(42), val)
+}
+
+func TestGetNextRecordContextNonBlocking(t *testing.T) {
+	r, err := ring.NewRing("libnf-go", true, false, true)
+	assert.Nil(t, err)
+	defer r.Free()
+	rec, err := record.NewRecord()
+	assert.Nil(t, err)
+	defer rec.Free()
+
+	err = r.GetNextRecordContext(context.Background(), &rec)
+	assert.Equal(t, errors.ErrFileEof, err)
+}
+
+func TestFreeCopiedRing(t *testing.T) {
+	r, err := ring.NewRing("libnf-go", true, false, true)
+	assert.Nil(t, err)
+	alias := r
+	rec, err := record.NewRecord()
+	assert.Nil(t, err)
+	defer rec.Free()
+
+	assert.Nil(t, r.Free())
+	assert.Equal(t, errors.ErrRingNotAllocated, alias.Free())
+	assert.Equal(t, errors.ErrRingNotAllocated, alias.WriteRecord(&rec))
+	assert.Equal(t, errors.ErrRingNotAllocated, alias.GetNextRecord(&rec))
+}
@@ -0,0 +1,329 @@
+// Package source reads nfcapd files from one or more directories as a single
+// stream of records, similarly to the -R and -M options of nfdump.
+//
+// Files are selected by the timestamp in their name (nfcapd.YYYYMMDDhhmm or
+// nfcapd.YYYYMMDDhhmmss), which marks the start of the interval captured in the
+// file. Directory hierarchies created by nfcapd -S are searched recursively.
+// Like nfdump -t, a source with a time window also checks every record and
+// skips flows which do not lie within the window.
+package source
+
+import (
+	"io/fs"
+	"iter"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/matejnesuta/libnf-go/api/errors"
+	"github.com/matejnesuta/libnf-go/api/fields"
+	"github.com/matejnesuta/libnf-go/api/file"
+	"github.com/matejnesuta/libnf-go/api/record"
+)
+
+// A list of policies for files which cannot be opened or read.
+const (
+	// StopOnError returns the error from GetNextRecord and ends the stream.
+	StopOnError int = 0
+	// SkipOnError skips the rest of the file and continues with the next one.
+	// Skipped files are reported by the Skipped method.
+	SkipOnError int = 1
+)
+
+var nameRegexp = regexp.MustCompile(`^nfcapd\.(\d{12}|\d{14})$`)
+
+// SkippedFile describes a file which was skipped because of an error.
+type SkippedFile struct {
+	Path string
+	Err  error
+}
+
+// Source represents an ordered set of nfcapd files read as one record stream.
+type Source struct {
+	files   []string
+	index   int
+	current file.File
+	policy  int
+	skipped []SkippedFile
+	err     error // Error which stopped the stream with StopOnError.
+
+	start, end time.Time // Time window of the records, zero if open.
+}
+
+type candidate struct {
+	path  string
+	time  time.Time
+	order int
+}
+
+// ParseTime returns the timestamp encoded in the name of an nfcapd file.
+// The timestamp is interpreted in the local time zone, as nfcapd does.
+// The second return value is false if the name does not match the nfcapd naming scheme.
+func ParseTime(name string) (time.Time, bool) {
+	m := nameRegexp.FindStringSubmatch(filepath.Base(name))
+	if m == nil {
+		return time.Time{}, false
+	}
+	layout := "200601021504"
+	if len(m[1]) == 14 {
+		layout = "20060102150405"
+	}
+	t, err := time.ParseInLocation(layout, m[1], time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// FindFiles searches the given directories for nfcapd files which may hold
+// flows of the closed interval [start, end]. These are the files whose timestamp
+// lies within the interval and, in every directory, the last file starting before
+// start, whose interval covers start. A zero start or end leaves the interval
+// open on that side.
+//
+// Files are ordered by their timestamp. Files with the same timestamp from
+// multiple directories are ordered in the same way as the directories.
+func FindFiles(dirs []string, start time.Time, end time.Time) ([]string, error) {
+	var candidates []candidate
+	for order, dir := range dirs {
+		var covering *candidate // Last file of the directory starting before start.
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			t, ok := ParseTime(d.Name())
+			if !ok {
+				return nil
+			}
+			c := candidate{path: path, time: t, order: order}
+			if !start.IsZero() && t.Before(start) {
+				if covering == nil || t.After(covering.time) {
+					covering = &c
+				}
+				return nil
+			}
+			if !end.IsZero() && t.After(end) {
+				return nil
+			}
+			candidates = append(candidates, c)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if covering != nil && !slices.ContainsFunc(candidates, func(c candidate) bool {
+			return c.order == order && c.time.Equal(start)
+		}) {
+			candidates = append(candidates, *covering)
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if !candidates[i].time.Equal(candidates[j].time) {
+			return candidates[i].time.Before(candidates[j].time)
+		}
+		if candidates[i].order != candidates[j].order {
+			return candidates[i].order < candidates[j].order
+		}
+		return candidates[i].path < candidates[j].path
+	})
+
+	files := make([]string, len(candidates))
+	for i, c := range candidates {
+		files[i] = c.path
+	}
+	return files, nil
+}
+
+// NewSource creates a record stream over the flows of [start, end] in all nfcapd
+// files of the given directories. See FindFiles for the selection of the files.
+// Records whose first packet is before start or whose last packet is after end
+// are skipped, as by nfdump -t.
+//
+// The policy parameter is one of StopOnError or SkipOnError.
+func NewSource(dirs []string, start time.Time, end time.Time, policy int) (*Source, error) {
+	files, err := FindFiles(dirs, start, end)
+	if err != nil {
+		return nil, err
+	}
+	s := NewSourceFromFiles(files, policy)
+	s.start, s.end = start, end
+	return s, nil
+}
+
+// NewSourceFromFiles creates a record stream over the given files in the given order.
+//
+// The policy parameter is one of StopOnError or SkipOnError.
+func NewSourceFromFiles(files []string, policy int) *Source {
+	return &Source{
+		files:  files,
+		index:  -1,
+		policy: policy,
+	}
+}
+
+// Files returns the list of files read by the source.
+func (s *Source) Files() []string {
+	return s.files
+}
+
+// CurrentFile returns the path of the file the last record was read from.
+// It returns an empty string before the first record is read.
+func (s *Source) CurrentFile() string {
+	if s.index < 0 || s.index >= len(s.files) {
+		return ""
+	}
+	return s.files[s.index]
+}
+
+// Skipped returns the files skipped because of an error when SkipOnError is used.
+func (s *Source) Skipped() []SkippedFile {
+	return s.skipped
+}
+
+// handleError applies the error policy. It returns the error if reading should stop.
+func (s *Source) handleError(err error) error {
+	if s.policy != SkipOnError {
+		s.err = err
+		return err
+	}
+	s.skipped = append(s.skipped, SkippedFile{Path: s.files[s.index], Err: err})
+	if s.current.Opened() {
+		s.current.Close()
+	}
+	return nil
+}
+
+// openNext closes the current file and opens the next one.
+// Returns errors.ErrFileEof when there are no more files.
+func (s *Source) openNext() error {
+	if s.current.Opened() {
+		s.current.Close()
+	}
+	for s.index+1 < len(s.files) {
+		s.index++
+		err := s.current.OpenRead(s.files[s.index], false, false)
+		if err == nil {
+			return nil
+		}
+		if err = s.handleError(err); err != nil {
+			return err
+		}
+	}
+	s.index = len(s.files)
+	return errors.ErrFileEof
+}
+
+// GetNextRecord reads the next record from the stream into the given record.
+// The record must be previously allocated.
+//
+// When the end of a file is reached, the next file is opened transparently.
+// Returns errors.ErrFileEof after the last record of the last file. With
+// StopOnError, the error which stopped the stream is returned by every further
+// call until Close or Reset. Use CurrentFile to find out which file the record
+// came from.
+func (s *Source) GetNextRecord(r *record.Record) error {
+	if !r.Allocated() {
+		return errors.ErrRecordNotAllocated
+	}
+	if s.err != nil {
+		return s.err
+	}
+	if s.index >= len(s.files) {
+		return errors.ErrFileEof
+	}
+
+	for {
+		if !s.current.Opened() {
+			if err := s.openNext(); err != nil {
+				return err
+			}
+		}
+
+		err := s.current.GetNextRecord(r)
+		if err == nil {
+			if s.inWindow(r) {
+				return nil
+			}
+			continue
+		} else if err == errors.ErrFileEof {
+			s.current.Close()
+			continue
+		}
+		if err = s.handleError(err); err != nil {
+			return err
+		}
+	}
+}
+
+// inWindow reports whether the record lies within the time window of the source.
+// Records without timestamps are kept.
+func (s *Source) inWindow(r *record.Record) bool {
+	if !s.start.IsZero() {
+		if first, err := r.GetTime(fields.First); err == nil && first.Before(s.start) {
+			return false
+		}
+	}
+	if !s.end.IsZero() {
+		if last, err := r.GetTime(fields.Last); err == nil && last.After(s.end) {
+			return false
+		}
+	}
+	return true
+}
+
+// Records returns an iterator over all records in the stream.
+//
+// The yielded record is allocated once and reused for every step, so it is
+// only valid until the next iteration. It is freed when the loop ends.
+// Iteration stops silently after the last file. Any other error is yielded
+// once together with a nil record.
+func (s *Source) Records() iter.Seq2[*record.Record, error] {
+	return func(yield func(*record.Record, error) bool) {
+		rec, err := record.NewRecord()
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer rec.Free()
+
+		for {
+			err = s.GetNextRecord(&rec)
+			if err == errors.ErrFileEof {
+				return
+			} else if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(&rec, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Reset closes the currently opened file and rewinds the stream to the start
+// of the first file. The list of skipped files and a stored error are cleared.
+func (s *Source) Reset() {
+	if s.current.Opened() {
+		s.current.Close()
+	}
+	s.index = -1
+	s.skipped = nil
+	s.err = nil
+}
+
+// Close closes the currently opened file. The source cannot be read afterwards.
+func (s *Source) Close() error {
+	if s.current.Opened() {
+		s.current.Close()
+	}
+	s.index = len(s.files)
+	s.err = nil
+	return nil
+}
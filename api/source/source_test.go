@@ -0,0 +1,220 @@
+package source_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matejnesuta/libnf-go/api/errors"
+	"github.com/matejnesuta/libnf-go/api/file"
+	"github.com/matejnesuta/libnf-go/api/record"
+	"github.com/matejnesuta/libnf-go/api/source"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func copyFile(t *testing.T, src string, dst string) {
+	data, err := os.ReadFile(src)
+	assert.Nil(t, err)
+	assert.Nil(t, os.MkdirAll(filepath.Dir(dst), 0755))
+	assert.Nil(t, os.WriteFile(dst, data, 0644))
+}
+
+func flows(t *testing.T, path string) uint64 {
+	info, err := file.Stat(path)
+	assert.Nil(t, err)
+	return info.Flows.Total
+}
+
+func TestParseTime(t *testing.T) {
+	ts, ok := source.ParseTime("/data/2017/05/28/nfcapd.201705281555")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, time.Date(2017, 5, 28, 15, 55, 0, 0, time.Local), ts)
+
+	ts, ok = source.ParseTime("nfcapd.20170528155530")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, time.Date(2017, 5, 28, 15, 55, 30, 0, time.Local), ts)
+
+	_, ok = source.ParseTime("nfcapd.current.1234")
+	assert.Equal(t, false, ok)
+}
+
+func TestFindFilesInTimeWindow(t *testing.T) {
+	dir1 := t.TempDir()
+	dir2 := t.TempDir()
+	copyFile(t, "../testfiles/ipv4-file.tmp", filepath.Join(dir1, "2025/02/16/nfcapd.202502161800"))
+	copyFile(t, "../testfiles/ipv4-file.tmp", filepath.Join(dir1, "2025/02/16/nfcapd.202502161755"))
+	copyFile(t, "../testfiles/ipv4-file.tmp", filepath.Join(dir1, "2025/02/16/nfcapd.202502161750"))
+	copyFile(t, "../testfiles/ipv4-file.tmp", filepath.Join(dir1, "nfcapd.current.1234"))
+	copyFile(t, "../testfiles/ipv6-file.tmp", filepath.Join(dir2, "nfcapd.202502161755"))
+
+	start := time.Date(2025, 2, 16, 17, 55, 0, 0, time.Local)
+	end := time.Date(2025, 2, 16, 18, 0, 0, 0, time.Local)
+	files, err := source.FindFiles([]string{dir1, dir2}, start, end)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir1, "2025/02/16/nfcapd.202502161755"),
+		filepath.Join(dir2, "nfcapd.202502161755"),
+		filepath.Join(dir1, "2025/02/16/nfcapd.202502161800"),
+	}, files)
+
+	files, err = source.FindFiles([]string{dir1}, time.Time{}, time.Time{})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(files))
+}
+
+func TestFindFilesCoveringStart(t *testing.T) {
+	dir1 := t.TempDir()
+	dir2 := t.TempDir()
+	copyFile(t, "../testfiles/ipv4-file.tmp", filepath.Join(dir1, "nfcapd.202502161750"))
+	copyFile(t, "../testfiles/ipv4-file.tmp", filepath.Join(dir1, "nfcapd.202502161755"))
+	copyFile(t, "../testfiles/ipv4-file.tmp", filepath.Join(dir1, "nfcapd.202502161800"))
+	copyFile(t, "../testfiles/ipv6-file.tmp", filepath.Join(dir2, "nfcapd.202502161745"))
+
+	// The files starting at 17:55 in the first and at 17:45 in the second
+	// directory hold the flows of 17:57.
+	start := time.Date(2025, 2, 16, 17, 57, 0, 0, time.Local)
+	end := time.Date(2025, 2, 16, 17, 59, 0, 0, time.Local)
+	files, err := source.FindFiles([]string{dir1, dir2}, start, end)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir2, "nfcapd.202502161745"),
+		filepath.Join(dir1, "nfcapd.202502161755"),
+	}, files)
+}
+
+func TestReadRecordsInTimeWindow(t *testing.T) {
+	dir := t.TempDir()
+	copyFile(t, "../testfiles/nfcapd.201705281555", filepath.Join(dir, "nfcapd.201705281555"))
+
+	// The file holds flows from 13:53:46.933 to 13:56:41.076 UTC.
+	start := time.Date(2017, 5, 28, 13, 55, 0, 0, time.UTC)
+	src, err := source.NewSource([]string{dir}, start, time.Time{}, source.StopOnError)
+	assert.Nil(t, err)
+	defer src.Close()
+
+	count := 0
+	for rec, err := range src.Records() {
+		assert.Nil(t, err)
+		first, err := rec.First()
+		assert.Nil(t, err)
+		assert.Equal(t, false, first.Before(start))
+		count++
+	}
+	assert.Greater(t, count, 0)
+	assert.Less(t, count, 2035)
+}
+
+func TestFindFilesInNonexistentDirectory(t *testing.T) {
+	_, err := source.FindFiles([]string{"nonexistent-dir"}, time.Time{}, time.Time{})
+	assert.NotNil(t, err)
+}
+
+func TestReadAllFiles(t *testing.T) {
+	dir := t.TempDir()
+	copyFile(t, "../testfiles/nfcapd.201705281555", filepath.Join(dir, "nfcapd.201705281555"))
+	copyFile(t, "../testfiles/ipv4-file.tmp", filepath.Join(dir, "nfcapd.201705281600"))
+	copyFile(t, "../testfiles/ipv6-file.tmp", filepath.Join(dir, "nfcapd.201705281605"))
+
+	src, err := source.NewSource([]string{dir}, time.Time{}, time.Time{}, source.StopOnError)
+	assert.Nil(t, err)
+	defer src.Close()
+
+	rec, err := record.NewRecord()
+	assert.Nil(t, err)
+	defer rec.Free()
+
+	perFile := make(map[string]uint64)
+	var order []string
+	for {
+		err = src.GetNextRecord(&rec)
+		if err != nil {
+			break
+		}
+		name := filepath.Base(src.CurrentFile())
+		if len(order) == 0 || order[len(order)-1] != name {
+			order = append(order, name)
+		}
+		perFile[name]++
+	}
+	assert.Equal(t, errors.ErrFileEof, err)
+	assert.Equal(t, []string{"nfcapd.201705281555", "nfcapd.201705281600", "nfcapd.201705281605"}, order)
+	for _, f := range src.Files() {
+		assert.Equal(t, flows(t, f), perFile[filepath.Base(f)])
+	}
+	assert.Equal(t, errors.ErrFileEof, src.GetNextRecord(&rec))
+}
+
+func TestSkipCorruptFile(t *testing.T) {
+	dir := t.TempDir()
+	copyFile(t, "../testfiles/ipv4-file.tmp", filepath.Join(dir, "nfcapd.201705281600"))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "nfcapd.201705281605"), []byte("not an nfdump file"), 0644))
+	copyFile(t, "../testfiles/ipv6-file.tmp", filepath.Join(dir, "nfcapd.201705281610"))
+
+	src, err := source.NewSource([]string{dir}, time.Time{}, time.Time{}, source.SkipOnError)
+	assert.Nil(t, err)
+	defer src.Close()
+
+	var count uint64
+	for _, err := range src.Records() {
+		assert.Nil(t, err)
+		count++
+	}
+	expected := flows(t, filepath.Join(dir, "nfcapd.201705281600")) + flows(t, filepath.Join(dir, "nfcapd.201705281610"))
+	assert.Equal(t, expected, count)
+	assert.Equal(t, 1, len(src.Skipped()))
+	assert.Equal(t, filepath.Join(dir, "nfcapd.201705281605"), src.Skipped()[0].Path)
+	assert.ErrorIs(t, src.Skipped()[0].Err, errors.ErrCannotOpenFile)
+}
+
+func TestStopOnCorruptFile(t *testing.T) {
+	dir := t.TempDir()
+	copyFile(t, "../testfiles/ipv4-file.tmp", filepath.Join(dir, "nfcapd.201705281600"))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "nfcapd.201705281605"), []byte("not an nfdump file"), 0644))
+
+	src, err := source.NewSource([]string{dir}, time.Time{}, time.Time{}, source.StopOnError)
+	assert.Nil(t, err)
+	defer src.Close()
+
+	rec, err := record.NewRecord()
+	assert.Nil(t, err)
+	defer rec.Free()
+	for {
+		err = src.GetNextRecord(&rec)
+		if err != nil {
+			break
+		}
+	}
+	assert.ErrorIs(t, err, errors.ErrCannotOpenFile)
+	assert.Equal(t, filepath.Join(dir, "nfcapd.201705281605"), src.CurrentFile())
+	assert.Equal(t, 0, len(src.Skipped()))
+}
+
+func TestStopOnErrorSticks(t *testing.T) {
+	files := []string{"../testfiles/nonexistent", "../testfiles/ipv4-file.tmp"}
+	src := source.NewSourceFromFiles(files, source.StopOnError)
+
+	rec, err := record.NewRecord()
+	assert.Nil(t, err)
+	defer rec.Free()
+
+	first := src.GetNextRecord(&rec)
+	assert.ErrorIs(t, first, errors.ErrCannotOpenFile)
+	assert.Equal(t, first, src.GetNextRecord(&rec))
+	assert.Equal(t, files[0], src.CurrentFile())
+
+	src.Reset()
+	assert.Equal(t, "", src.CurrentFile())
+	assert.ErrorIs(t, src.GetNextRecord(&rec), errors.ErrCannotOpenFile)
+	assert.Equal(t, files[0], src.CurrentFile())
+
+	assert.Nil(t, src.Close())
+	assert.Equal(t, errors.ErrFileEof, src.GetNextRecord(&rec))
+}
+
+func TestReadIntoUnallocatedRecord(t *testing.T) {
+	src := source.NewSourceFromFiles([]string{"../testfiles/ipv4-file.tmp"}, source.StopOnError)
+	var rec record.Record
+	assert.Equal(t, errors.ErrRecordNotAllocated, src.GetNextRecord(&rec))
+}
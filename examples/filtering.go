@@ -6,7 +6,6 @@ import (
 	"github.com/matejnesuta/libnf-go/api/fields"
 	"github.com/matejnesuta/libnf-go/api/file"
 	"github.com/matejnesuta/libnf-go/api/filter"
-	"github.com/matejnesuta/libnf-go/api/record"
 )
 
 func Filtering() {
@@ -18,23 +17,17 @@ func Filtering() {
 	}
 	defer ptr.Close()
 
-	rec, err := record.NewRecord()
-	if err != nil {
-		fmt.Println(err)
-	}
-	defer rec.Free()
-
 	var filter filter.Filter
 	filter.Init("dst port 53 and proto tcp")
 	defer filter.Free()
 	var num_of_matches uint64 = 0
 	printHeader()
-	for {
-		err = ptr.GetNextRecord(&rec)
+	for rec, err := range ptr.Records() {
 		if err != nil {
+			fmt.Println(err)
 			break
 		}
-		if match, _ := filter.Match(rec); !match {
+		if match, _ := filter.Match(*rec); !match {
 			continue
 		}
 		val, _ := rec.GetField(fields.Brec1)
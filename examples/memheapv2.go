@@ -6,7 +6,6 @@ import (
 	"github.com/matejnesuta/libnf-go/api/fields"
 	"github.com/matejnesuta/libnf-go/api/file"
 	memheap "github.com/matejnesuta/libnf-go/api/memheapv2"
-	"github.com/matejnesuta/libnf-go/api/record"
 )
 
 func MemHeapV2() {
@@ -34,17 +33,14 @@ func MemHeapV2() {
 	heap.SortAggrOptions(fields.CalcBpp, memheap.AggrAuto, memheap.SortAsc, 0, 0)
 	heap.SortAggrOptions(fields.CalcPps, memheap.AggrAuto, memheap.SortNone, 0, 0)
 
-	rec, _ := record.NewRecord()
-	defer rec.Free()
-
 	var i uint64 = 0
 
-	for {
-		err = ptr.GetNextRecord(&rec)
+	for rec, err := range ptr.Records() {
 		if err != nil {
+			fmt.Println(err)
 			break
 		}
-		err = heap.WriteRecord(&rec)
+		err = heap.WriteRecord(rec)
 		if err != nil {
 			fmt.Println(err)
 		}
@@ -53,13 +49,7 @@ func MemHeapV2() {
 	fmt.Println("Total records in file: ", i)
 	i = 0
 
-	cursor, err := heap.FirstRecordPosition()
-	if err != nil {
-		panic(err)
-	}
-	for {
-
-		err := heap.GetRecord(&cursor, &rec)
+	for rec, err := range heap.Records() {
 		if err != nil {
 			break
 		}
@@ -82,10 +72,6 @@ func MemHeapV2() {
 		}
 		i++
 		fmt.Println(brec.First.Format("2006-01-02 15:04:05"), brec.Last.Sub(brec.First).Seconds(), brec.SrcAddr, brec.Bytes, brec.Pkts, brec.Flows, bpp, bps, pps)
-		cursor, err = heap.NextRecordPosition(cursor)
-		if err != nil {
-			break
-		}
 	}
 	fmt.Println("Total records in heap: ", i)
 }
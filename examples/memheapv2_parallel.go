@@ -1,14 +1,13 @@
 package examples
 
 import (
+	"context"
 	"fmt"
-	"runtime"
 	"strconv"
-	"sync"
 
 	"github.com/matejnesuta/libnf-go/api/fields"
-	"github.com/matejnesuta/libnf-go/api/file"
 	memheap "github.com/matejnesuta/libnf-go/api/memheapv2"
+	"github.com/matejnesuta/libnf-go/api/parallel"
 	"github.com/matejnesuta/libnf-go/api/record"
 )
 
@@ -40,50 +39,17 @@ func MemHeapV2P() {
 	heap.SortAggrOptions(fields.CalcBpp, memheap.AggrAuto, memheap.SortAsc, 0, 0)
 	heap.SortAggrOptions(fields.CalcPps, memheap.AggrAuto, memheap.SortNone, 0, 0)
 
-	var i uint64 = 0
-	var wg sync.WaitGroup
-	recordMux := &sync.Mutex{}
-	incrementMux := &sync.Mutex{}
-
+	var files []string
 	for x := 1; x < 6; x++ {
-		wg.Add(1)
-		go func() {
-			runtime.LockOSThread()         // Lock the goroutine to the OS thread
-			defer runtime.UnlockOSThread() // Unlock the goroutine from the OS thread
-			defer wg.Done()
-			var ptr file.File
-			err := ptr.OpenRead("api/testfiles/comparison/"+strconv.Itoa(x)+".tmp", false, false)
-
-			if err != nil {
-				fmt.Println(err)
-			}
-			defer ptr.Close()
-			recordMux.Lock()
-			rec, err := record.NewRecord()
-			recordMux.Unlock()
-			if err != nil {
-				fmt.Println(err)
-				return
-			}
-			defer rec.Free()
-			for {
-				err = ptr.GetNextRecord(&rec)
-				if err != nil {
-					break
-				}
-				incrementMux.Lock()
-				i++
-				incrementMux.Unlock()
-				err = heap.WriteRecord(&rec)
-				if err != nil {
-					fmt.Println(err)
-				}
-			}
-		}()
+		files = append(files, "api/testfiles/comparison/"+strconv.Itoa(x)+".tmp")
 	}
-	wg.Wait() // Wait for all workers to finish processing
-	fmt.Println("Total records in file: ", i)
-	i = 0
+	reader := parallel.NewParallelReader(files, 5, "", &heap)
+	err = reader.Run(context.Background())
+	if err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println("Total records in file: ", reader.Read())
+	var i uint64 = 0
 	cursor, err := heap.FirstRecordPosition()
 	if err != nil {
 		panic(err)
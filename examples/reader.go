@@ -5,7 +5,6 @@ import (
 
 	"github.com/matejnesuta/libnf-go/api/fields"
 	"github.com/matejnesuta/libnf-go/api/file"
-	"github.com/matejnesuta/libnf-go/api/record"
 )
 
 func Reader() {
@@ -17,15 +16,9 @@ func Reader() {
 	}
 	defer ptr.Close()
 
-	rec, err := record.NewRecord()
-	if err != nil {
-		fmt.Println(err)
-	}
-	defer rec.Free()
-
-	for {
-		err = ptr.GetNextRecord(&rec)
+	for rec, err := range ptr.Records() {
 		if err != nil {
+			fmt.Println(err)
 			break
 		}
 		val, _ := rec.GetField(fields.Brec1)
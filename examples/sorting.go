@@ -6,7 +6,6 @@ import (
 	"github.com/matejnesuta/libnf-go/api/fields"
 	"github.com/matejnesuta/libnf-go/api/file"
 	memheap "github.com/matejnesuta/libnf-go/api/memheapv2"
-	"github.com/matejnesuta/libnf-go/api/record"
 )
 
 func Sorting() {
@@ -18,12 +17,6 @@ func Sorting() {
 	}
 	defer ptr.Close()
 
-	rec, err := record.NewRecord()
-	if err != nil {
-		fmt.Println(err)
-	}
-	defer rec.Free()
-
 	heap := memheap.NewMemHeapV2(1)
 	if err != nil {
 		fmt.Println(err)
@@ -41,22 +34,20 @@ func Sorting() {
 	// heap.SetAggrOptions(fields.CalcBps, memheap.AggrAuto, memheap.SortDesc, 0, 0)
 
 	var i uint64 = 0
-	for {
-		err = ptr.GetNextRecord(&rec)
+	for rec, err := range ptr.Records() {
 		if err != nil {
+			fmt.Println(err)
 			break
 		}
-		err = heap.WriteRecord(&rec)
+		err = heap.WriteRecord(rec)
 		if err != nil {
 			fmt.Println(err)
 		}
 		i++
 	}
 	fmt.Println("Total records in file: ", i)
-	cursor, _ := heap.FirstRecordPosition()
 	i = 0
-	for {
-		err = heap.GetRecord(&cursor, &rec)
+	for rec, err := range heap.Records() {
 		if err != nil {
 			fmt.Println(err)
 			fmt.Println("Error getting record")
@@ -72,12 +63,6 @@ func Sorting() {
 		}
 		i++
 		fmt.Println(brec.SrcAddr, brec.SrcPort, brec.DstAddr, brec.DstPort, brec.First.UnixMilli(), brec.Bytes, brec.Pkts)
-		cursor, err = heap.NextRecordPosition(cursor)
-		if err != nil {
-			fmt.Println(err)
-			break
-		}
-
 	}
 	fmt.Println("Total records in heap: ", i)
 }
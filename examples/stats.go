@@ -80,28 +80,21 @@ func Stats() {
 		if err != nil {
 			break
 		}
-		val, _ := rec.GetField(fields.Brec1)
-		brec, ok := val.(fields.BasicRecord1)
-		if !ok {
-			panic("Error: Not a BasicRecord1")
+		brec, err := rec.Brec1()
+		if err != nil {
+			panic(err)
 		}
-
-		val, _ = rec.GetField(fields.CalcBps)
-		bps, ok := val.(float64)
-		if !ok {
-			panic("Error: Not a float64")
+		bps, err := rec.Bps()
+		if err != nil {
+			panic(err)
 		}
-
-		val, _ = rec.GetField(fields.CalcPps)
-		pps, ok := val.(float64)
-		if !ok {
-			panic("Error: Not a float64")
+		pps, err := rec.Pps()
+		if err != nil {
+			panic(err)
 		}
-
-		val, _ = rec.GetField(fields.CalcBpp)
-		bpp, ok := val.(float64)
-		if !ok {
-			panic("Error: Not a float64")
+		bpp, err := rec.Bpp()
+		if err != nil {
+			panic(err)
 		}
 
 		fmt.Print(brec.First.Format("2006-01-02 15:04:05"), " ")
@@ -157,28 +150,21 @@ func Stats() {
 			break
 		}
 
-		val, _ := rec.GetField(fields.Brec1)
-		brec, ok := val.(fields.BasicRecord1)
-		if !ok {
-			panic("Error: Not a BasicRecord1")
+		brec, err := rec.Brec1()
+		if err != nil {
+			panic(err)
 		}
-
-		val, _ = rec.GetField(fields.CalcBps)
-		bps, ok := val.(float64)
-		if !ok {
-			panic("Error: Not a float64")
+		bps, err := rec.Bps()
+		if err != nil {
+			panic(err)
 		}
-
-		val, _ = rec.GetField(fields.CalcPps)
-		pps, ok := val.(float64)
-		if !ok {
-			panic("Error: Not a float64")
+		pps, err := rec.Pps()
+		if err != nil {
+			panic(err)
 		}
-
-		val, _ = rec.GetField(fields.CalcBpp)
-		bpp, ok := val.(float64)
-		if !ok {
-			panic("Error: Not a float64")
+		bpp, err := rec.Bpp()
+		if err != nil {
+			panic(err)
 		}
 
 		fmt.Print(brec.First.Format("2006-01-02 15:04:05"), " ")
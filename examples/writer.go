@@ -4,7 +4,6 @@ import (
 	"fmt"
 
 	"github.com/matejnesuta/libnf-go/api/file"
-	"github.com/matejnesuta/libnf-go/api/record"
 )
 
 // Writer is a function that demonstrates how to use the libnf package to write data to a file.
@@ -25,20 +24,13 @@ func Writer() {
 	defer output.Close()
 	defer input.Close()
 
-	rec, err := record.NewRecord()
-	if err != nil {
-		fmt.Println(err)
-	}
-	defer rec.Free()
-
-	// Set the fields of the record
-	for {
-		err = input.GetNextRecord(&rec)
+	for rec, err := range input.Records() {
 		if err != nil {
+			fmt.Println(err)
 			break
 		}
 
-		err = output.WriteRecord(&rec)
+		err = output.WriteRecord(rec)
 		if err != nil {
 			fmt.Println(err)
 		}
@@ -1,6 +1,6 @@
 module github.com/matejnesuta/libnf-go
 
-go 1.22.3
+go 1.24
 
 require (
 	github.com/ianlancetaylor/cgosymbolizer v0.0.0-20250210230444-5fae499d98fc
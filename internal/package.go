@@ -3,13 +3,86 @@ package internal
 // #cgo CFLAGS: -I/usr/local/include
 // #cgo LDFLAGS: -L/usr/local/lib -lnf
 // #include "libnf.h"
+//
+// static void lnf_rec_fget_list(lnf_rec_t *rec, const int *fields, const int *offsets,
+// 		int n, char *buf, char *present) {
+// 	for (int i = 0; i < n; i++) {
+// 		present[i] = lnf_rec_fget(rec, fields[i], buf + offsets[i]) == LNF_OK;
+// 	}
+// }
+//
+// static void lnf_rec_fset_list(lnf_rec_t *rec, const int *fields, const int *offsets,
+// 		int n, char *buf, const char *present) {
+// 	lnf_rec_clear(rec);
+// 	for (int i = 0; i < n; i++) {
+// 		if (present[i]) {
+// 			lnf_rec_fset(rec, fields[i], buf + offsets[i]);
+// 		}
+// 	}
+// }
 import "C"
 import (
+	"bytes"
 	"unsafe"
 )
 
 func Error() string {
 	buf := make([]byte, MAX_STRING)                                    // Allocate buffer in Go
 	C.lnf_error((*C.char)(unsafe.Pointer(&buf[0])), C.int(MAX_STRING)) // Call SWIG-wrapped C function
-	return string(buf)                                                 // Convert C buffer to Go string
+	if i := bytes.IndexByte(buf, 0); i >= 0 {                          // Strip the NUL padding
+		buf = buf[:i]
+	}
+	return string(buf) // Convert C buffer to Go string
+}
+
+// Rec_get_raw serializes the record into buf in the given raw format version.
+// Returns the libnf status and the number of bytes written to buf.
+func Rec_get_raw(rec uintptr, version int, buf []byte) (int, int) {
+	var size C.size_t
+	status := C.lnf_rec_get_raw(
+		(*C.lnf_rec_t)(unsafe.Pointer(rec)),
+		C.int(version),
+		(*C.char)(unsafe.Pointer(&buf[0])),
+		C.size_t(len(buf)),
+		&size,
+	)
+	return int(status), int(size)
+}
+
+// Rec_set_raw restores the record from data produced by Rec_get_raw.
+func Rec_set_raw(rec uintptr, buf []byte) int {
+	return int(C.lnf_rec_set_raw(
+		(*C.lnf_rec_t)(unsafe.Pointer(rec)),
+		(*C.char)(unsafe.Pointer(&buf[0])),
+		C.size_t(len(buf)),
+	))
+}
+
+// Rec_fget_list reads n fields of the record with a single cgo call. The value
+// of fields[i] is stored in buf at offsets[i], and present[i] is set to 1 if
+// libnf returned the field, or to 0 otherwise. fields and offsets point to
+// int32 arrays and present to a byte array of n elements.
+func Rec_fget_list(rec uintptr, fields uintptr, offsets uintptr, n int, buf uintptr, present uintptr) {
+	C.lnf_rec_fget_list(
+		(*C.lnf_rec_t)(unsafe.Pointer(rec)),
+		(*C.int)(unsafe.Pointer(fields)),
+		(*C.int)(unsafe.Pointer(offsets)),
+		C.int(n),
+		(*C.char)(unsafe.Pointer(buf)),
+		(*C.char)(unsafe.Pointer(present)),
+	)
+}
+
+// Rec_fset_list clears the record and sets every field fields[i] whose
+// present[i] is not 0 to the value stored in buf at offsets[i], with a single
+// cgo call. The arguments have the same layout as for Rec_fget_list.
+func Rec_fset_list(rec uintptr, fields uintptr, offsets uintptr, n int, buf uintptr, present uintptr) {
+	C.lnf_rec_fset_list(
+		(*C.lnf_rec_t)(unsafe.Pointer(rec)),
+		(*C.int)(unsafe.Pointer(fields)),
+		(*C.int)(unsafe.Pointer(offsets)),
+		C.int(n),
+		(*C.char)(unsafe.Pointer(buf)),
+		(*C.char)(unsafe.Pointer(present)),
+	)
 }